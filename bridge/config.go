@@ -2,9 +2,13 @@ package bridge
 
 import (
 	"encoding/json"
+	"sync"
 
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/d2"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/discovery"
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/log"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
 	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
 )
@@ -15,8 +19,16 @@ type ConfigBridge struct {
 	configPath string
 
 	// Dependencies.
-	config config.Service
-	logger log.Logger
+	config    config.Service
+	discovery discovery.Service
+	logger    log.Logger
+
+	// Installs found by the last discovery, that haven't been added yet.
+	candidates []discovery.Candidate
+	mux        sync.Mutex
+
+	// Shared config being imported.
+	plan *config.ImportPlan
 
 	// Models.
 	GameModel *core.QAbstractListModel `property:"games"`
@@ -25,16 +37,30 @@ type ConfigBridge struct {
 	_ string   `property:"buildVersion"`
 	_ []string `property:"availableHDMods"`
 	_ []string `property:"availableMaphackMods"`
+	_ []string `property:"availableHDResolutions"`
 	_ bool     `property:"prerequisitesLoaded"`
 	_ bool     `property:"prerequisitesError"`
+	_ string   `property:"modIssue"`
+	_ bool     `property:"discovering"`
+	_ string   `property:"discoveredGames"`
+	_ string   `property:"importPlan"`
+	_ string   `property:"shareError"`
 
 	// Slots.
 	_ func()                 `slot:"addGame"`
 	_ func(body string) bool `slot:"upsertGame"`
 	_ func(id string)        `slot:"deleteGame"`
-	_ func() bool            `slot:"persistGameModel"`
 	_ func()                 `slot:"getPrerequisites"`
 	_ func()                 `slot:"openConfigPath"`
+
+	_ func(root string)     `slot:"discoverGames"`
+	_ func(location string) `slot:"addDiscoveredGame"`
+
+	_ func(path string) bool                `slot:"exportConfig"`
+	_ func(path string) bool                `slot:"readImport"`
+	_ func(index int, location string) bool `slot:"setImportLocation"`
+	_ func(replace bool) bool               `slot:"applyImport"`
+	_ func()                                `slot:"cancelImport"`
 }
 
 // Connect will connect the QML signals to functions in Go.
@@ -42,50 +68,214 @@ func (c *ConfigBridge) Connect() {
 	c.ConnectUpsertGame(c.upsertGame)
 	c.ConnectAddGame(c.addGame)
 	c.ConnectDeleteGame(c.deleteGame)
-	c.ConnectPersistGameModel(c.persistGameModel)
 	c.ConnectGetPrerequisites(c.getPrerequisites)
 	c.ConnectOpenConfigPath(c.openConfigPath)
+	c.ConnectDiscoverGames(c.discoverGames)
+	c.ConnectAddDiscoveredGame(c.addDiscoveredGame)
+	c.ConnectExportConfig(c.exportConfig)
+	c.ConnectReadImport(c.readImport)
+	c.ConnectSetImportLocation(c.setImportLocation)
+	c.ConnectApplyImport(c.applyImport)
+	c.ConnectCancelImport(c.cancelImport)
 }
 
-// addGame will add a game to the game model.
+// addGame will add a game to the config, the game model follows.
 func (c *ConfigBridge) addGame() {
-	c.config.AddGame()
+	if err := c.config.AddGame(); err != nil {
+		c.logger.Error(err)
+	}
 }
 
-// upsertGame will update the game model.
-func (c *ConfigBridge) upsertGame(body string) bool {
-	var request config.UpdateGameRequest
-	if err := json.Unmarshal([]byte(body), &request); err != nil {
+// discoverGames will look for installs in the common locations, and in the given root if set.
+func (c *ConfigBridge) discoverGames(root string) {
+	c.SetDiscovering(true)
+
+	// Do the work on another thread not to lock the GUI.
+	go func() {
+		defer c.SetDiscovering(false)
+
+		var roots []string
+		if root != "" {
+			roots = append(roots, d2.LocalPath(root))
+		}
+
+		candidates, err := c.discovery.Discover(roots)
+		if err != nil {
+			c.logger.Error(err)
+			return
+		}
+
+		c.setCandidates(candidates)
+	}()
+}
+
+// addDiscoveredGame will add the discovered install to the config.
+func (c *ConfigBridge) addDiscoveredGame(location string) {
+	if err := c.config.AddGameAt(location); err != nil {
+		c.logger.Error(err)
+		return
+	}
+
+	c.mux.Lock()
+	candidates := make([]discovery.Candidate, 0, len(c.candidates))
+	for _, candidate := range c.candidates {
+		if candidate.Location != location {
+			candidates = append(candidates, candidate)
+		}
+	}
+	c.mux.Unlock()
+
+	c.setCandidates(candidates)
+}
+
+// setCandidates will show the installs that can be added.
+func (c *ConfigBridge) setCandidates(candidates []discovery.Candidate) {
+	body, err := json.Marshal(candidates)
+	if err != nil {
+		c.logger.Error(err)
+		return
+	}
+
+	c.mux.Lock()
+	c.candidates = candidates
+	c.mux.Unlock()
+
+	c.SetDiscoveredGames(string(body))
+}
+
+// exportConfig will write the config to a file that can be imported on another machine.
+func (c *ConfigBridge) exportConfig(path string) bool {
+	if err := c.config.ExportConfig(d2.LocalPath(path)); err != nil {
 		c.logger.Error(err)
+		c.SetShareError(err.Error())
 		return false
 	}
 
-	err := c.config.UpsertGame(request)
+	c.SetShareError("")
+	return true
+}
+
+// readImport will read the shared config and show the games it would import.
+func (c *ConfigBridge) readImport(path string) bool {
+	plan, err := c.config.ReadImport(d2.LocalPath(path))
 	if err != nil {
 		c.logger.Error(err)
+		c.SetShareError(err.Error())
 		return false
 	}
 
+	c.SetShareError("")
+	c.setPlan(plan)
+
 	return true
 }
 
-// deleteGame will delete the given id from the game model.
-func (c *ConfigBridge) deleteGame(id string) {
-	err := c.config.DeleteGame(id)
+// setImportLocation will import the game at index to another install.
+func (c *ConfigBridge) setImportLocation(index int, location string) bool {
+	c.mux.Lock()
+	plan := c.plan
+	c.mux.Unlock()
+
+	if plan == nil {
+		return false
+	}
+
+	if err := plan.SetLocation(index, location); err != nil {
+		c.logger.Error(err)
+		return false
+	}
+
+	c.setPlan(plan)
+
+	return true
+}
+
+// applyImport will import the games of the shared config being imported.
+func (c *ConfigBridge) applyImport(replace bool) bool {
+	c.mux.Lock()
+	plan := c.plan
+	c.mux.Unlock()
+
+	if plan == nil {
+		return false
+	}
+
+	if err := c.config.ImportConfig(plan, replace); err != nil {
+		c.logger.Error(err)
+		c.SetShareError(err.Error())
+		return false
+	}
+
+	c.SetShareError("")
+	c.setPlan(nil)
+
+	return true
+}
+
+// cancelImport will forget the shared config being imported.
+func (c *ConfigBridge) cancelImport() {
+	c.SetShareError("")
+	c.setPlan(nil)
+}
+
+// setPlan will show the games of the shared config being imported, nothing is shown without one.
+func (c *ConfigBridge) setPlan(plan *config.ImportPlan) {
+	c.mux.Lock()
+	c.plan = plan
+	c.mux.Unlock()
+
+	if plan == nil {
+		c.SetImportPlan("")
+		return
+	}
+
+	body, err := json.Marshal(plan)
 	if err != nil {
 		c.logger.Error(err)
+		return
 	}
+
+	c.SetImportPlan(string(body))
 }
 
-// persistGameModel will persist the current game model to the config.
-func (c *ConfigBridge) persistGameModel() bool {
-	if err := c.config.PersistGameModel(); err != nil {
+// upsertGame will update the game in the config.
+func (c *ConfigBridge) upsertGame(body string) bool {
+	var request config.UpdateGameRequest
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		c.logger.Error(err)
+		return false
+	}
+
+	issues, err := c.config.UpsertGame(request)
+	if err != nil {
 		c.logger.Error(err)
+
+		// Let the user know why the mods can't be used together.
+		if issue, ok := err.(config.ModIssue); ok {
+			c.SetModIssue(issue.Reason)
+		}
+
 		return false
 	}
+
+	// Show the first warning, if any.
+	if len(issues) > 0 {
+		c.SetModIssue(issues[0].Reason)
+	} else {
+		c.SetModIssue("")
+	}
+
 	return true
 }
 
+// deleteGame will delete the given id from the game model.
+func (c *ConfigBridge) deleteGame(id string) {
+	err := c.config.DeleteGame(id)
+	if err != nil {
+		c.logger.Error(err)
+	}
+}
+
 // getPrerequisites will fetch all required config data.
 func (c *ConfigBridge) getPrerequisites() {
 	go func() {
@@ -102,8 +292,8 @@ func (c *ConfigBridge) getPrerequisites() {
 
 		// Default option for no mod at all.
 		defaultMods := []string{config.ModVersionNone}
-		c.SetAvailableHDMods(append(defaultMods, mods.HD...))
-		c.SetAvailableMaphackMods(append(defaultMods, mods.Maphack...))
+		c.SetAvailableHDMods(append(defaultMods, mods.Versions(storage.ModHD)...))
+		c.SetAvailableMaphackMods(append(defaultMods, mods.Versions(storage.ModMaphack)...))
 
 		c.SetPrerequisitesLoaded(true)
 	}()
@@ -115,13 +305,14 @@ func (c *ConfigBridge) openConfigPath() {
 }
 
 // NewConfig returns a new config bridge with all dependencies set up.
-func NewConfig(cs config.Service, gm *config.GameModel, configPath string, logger log.Logger) *ConfigBridge {
+func NewConfig(cs config.Service, ds discovery.Service, gm *config.GameModel, configPath string, logger log.Logger) *ConfigBridge {
 	b := NewConfigBridge(nil)
 
 	b.configPath = configPath
 
 	// Setup dependencies.
 	b.config = cs
+	b.discovery = ds
 	b.logger = logger
 
 	// Setup model.
@@ -130,6 +321,12 @@ func NewConfig(cs config.Service, gm *config.GameModel, configPath string, logge
 	// Set initial state.
 	b.SetPrerequisitesLoaded(false)
 	b.SetPrerequisitesError(false)
+	b.SetModIssue("")
+	b.SetDiscovering(false)
+	b.SetDiscoveredGames("[]")
+	b.SetImportPlan("")
+	b.SetShareError("")
+	b.SetAvailableHDResolutions(config.HDResolutions)
 
 	return b
 }
@@ -1,6 +1,11 @@
 package bridge
 
 import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/d2"
 	"github.com/nokka/slashdiablo-launcher/log"
 	"github.com/therecipe/qt/core"
@@ -15,6 +20,10 @@ type DiabloBridge struct {
 	d2service d2.Service
 	logger    log.Logger
 
+	// Reports of the last verify, used when repairing.
+	reports []d2.VerifyReport
+	mux     sync.Mutex
+
 	// Properties.
 	_ bool    `property:"patching"`
 	_ bool    `property:"errored"`
@@ -24,6 +33,12 @@ type DiabloBridge struct {
 	_ float32 `property:"patchProgress"`
 	_ string  `property:"status"`
 	_ int     `property:"launchDelay"`
+	_ int     `property:"downloadRateLimit"`
+	_ bool    `property:"verifying"`
+	_ bool    `property:"repairNeeded"`
+	_ string  `property:"verifySummary"`
+	_ string  `property:"verifyReport"`
+	_ int     `property:"rogueFiles"`
 
 	// Models.
 	FileModel *core.QAbstractListModel `property:"patchFiles"`
@@ -34,6 +49,19 @@ type DiabloBridge struct {
 	_ func()                 `slot:"applyPatches"`
 	_ func(path string) bool `slot:"applyDEP"`
 	_ func(delay int)        `slot:"updateLaunchDelay"`
+	_ func(limit int)        `slot:"updateDownloadRateLimit"`
+
+	_ func(gameID string, archive string) bool `slot:"installPackage"`
+	_ func(gameID string, name string) bool    `slot:"uninstallPackage"`
+	_ func(gameID string) string               `slot:"listPackages"`
+
+	_ func() `slot:"verifyGames"`
+	_ func() `slot:"repairGames"`
+
+	_ func() bool `slot:"quarantineFiles"`
+
+	_ func(gameID string, target string) `slot:"cloneGame"`
+	_ func(source string, target string) `slot:"bootstrapGame"`
 }
 
 // Connect will connect the QML signals to functions in Go.
@@ -43,6 +71,15 @@ func (b *DiabloBridge) Connect() {
 	b.ConnectValidateVersion(b.validateVersion)
 	b.ConnectApplyDEP(b.applyDEP)
 	b.ConnectUpdateLaunchDelay(b.updateLaunchDelay)
+	b.ConnectUpdateDownloadRateLimit(b.updateDownloadRateLimit)
+	b.ConnectInstallPackage(b.installPackage)
+	b.ConnectUninstallPackage(b.uninstallPackage)
+	b.ConnectListPackages(b.listPackages)
+	b.ConnectVerifyGames(b.verifyGames)
+	b.ConnectRepairGames(b.repairGames)
+	b.ConnectQuarantineFiles(b.quarantineFiles)
+	b.ConnectCloneGame(b.cloneGame)
+	b.ConnectBootstrapGame(b.bootstrapGame)
 }
 
 func (b *DiabloBridge) launchGame() {
@@ -102,6 +139,172 @@ func (b *DiabloBridge) applyPatches() {
 	}()
 }
 
+// verifyGames will hash every file in the games and report the broken ones.
+func (b *DiabloBridge) verifyGames() {
+	b.SetVerifying(true)
+	b.SetRepairNeeded(false)
+	b.SetVerifySummary("")
+
+	// Do the work on another thread not to lock the GUI.
+	go func() {
+		defer b.SetVerifying(false)
+
+		reports, err := b.d2service.Verify()
+		if err != nil {
+			b.logger.Error(err)
+			b.SetVerifySummary("Error al verificar los juegos")
+			return
+		}
+
+		body, err := json.Marshal(reports)
+		if err != nil {
+			b.logger.Error(err)
+			return
+		}
+
+		b.mux.Lock()
+		b.reports = reports
+		b.mux.Unlock()
+
+		var checked, broken, modified int
+		for _, r := range reports {
+			checked += r.Checked
+			broken += len(r.Broken())
+			modified += r.Count(d2.ProblemModified)
+		}
+
+		b.SetVerifyReport(string(body))
+		b.SetVerifySummary(fmt.Sprintf("%d archivos verificados, %d con errores, %d modificados", checked, broken, modified))
+		b.SetRepairNeeded(broken > 0)
+	}()
+}
+
+// repairGames will repair the broken files found by the last verify.
+func (b *DiabloBridge) repairGames() {
+	b.mux.Lock()
+	reports := b.reports
+	b.mux.Unlock()
+
+	// Tell the GUI we've started patching.
+	b.SetPatching(true)
+	b.SetErrored(false)
+	b.SetRepairNeeded(false)
+
+	// Run this on a separate thread so we don't block the UI.
+	go func() {
+		done := make(chan bool, 1)
+
+		progress, state := b.d2service.Repair(reports, done)
+
+		for {
+			select {
+			case percentage := <-progress:
+				b.SetPatchProgress(percentage)
+			case current := <-state:
+				if current.Error != nil {
+					b.logger.Error(current.Error)
+
+					// Update bridge state.
+					b.SetErrored(true)
+					b.SetPatching(false)
+					return
+				}
+
+				if current.Message != "" {
+					b.SetStatus(current.Message)
+				}
+			case <-done:
+				b.SetPatching(false)
+
+				// Verify again, so the user sees what's left.
+				b.verifyGames()
+				b.validateVersion()
+				return
+			}
+		}
+	}()
+}
+
+// cloneGame will copy the install of the game into the target directory and add it as a new game.
+func (b *DiabloBridge) cloneGame(gameID string, target string) {
+	// Cloning is shown the same way as patching.
+	b.SetPatching(true)
+	b.SetErrored(false)
+
+	// Run this on a separate thread so we don't block the UI.
+	go func() {
+		done := make(chan bool, 1)
+
+		progress, state := b.d2service.CloneGame(gameID, target, done)
+
+		for {
+			select {
+			case percentage := <-progress:
+				b.SetPatchProgress(percentage)
+			case current := <-state:
+				if current.Error != nil {
+					b.logger.Error(current.Error)
+
+					// Update bridge state.
+					b.SetErrored(true)
+					b.SetPatching(false)
+					return
+				}
+
+				if current.Message != "" {
+					b.SetStatus(current.Message)
+				}
+			case <-done:
+				b.SetPatching(false)
+
+				// The clone is a new game, it has to be validated too.
+				b.validateVersion()
+				return
+			}
+		}
+	}()
+}
+
+// bootstrapGame will create a new install in the target directory from the original installer files in the source.
+func (b *DiabloBridge) bootstrapGame(source string, target string) {
+	// Installing is shown the same way as patching.
+	b.SetPatching(true)
+	b.SetErrored(false)
+
+	// Run this on a separate thread so we don't block the UI.
+	go func() {
+		done := make(chan bool, 1)
+
+		progress, state := b.d2service.BootstrapGame(source, target, done)
+
+		for {
+			select {
+			case percentage := <-progress:
+				b.SetPatchProgress(percentage)
+			case current := <-state:
+				if current.Error != nil {
+					b.logger.Error(current.Error)
+
+					// Update bridge state.
+					b.SetErrored(true)
+					b.SetPatching(false)
+					return
+				}
+
+				if current.Message != "" {
+					b.SetStatus(current.Message)
+				}
+			case <-done:
+				b.SetPatching(false)
+
+				// The new install is a new game, it has to be validated too.
+				b.validateVersion()
+				return
+			}
+		}
+	}()
+}
+
 func (b *DiabloBridge) validateVersion() {
 	// Update GUI and reset errors.
 	b.SetValidatingVersion(true)
@@ -116,10 +319,23 @@ func (b *DiabloBridge) validateVersion() {
 		}
 
 		b.SetValidVersion(valid)
+		b.SetRogueFiles(len(b.d2service.RogueFiles()))
 		b.SetValidatingVersion(false)
 	}()
 }
 
+// quarantineFiles will move the unknown files found by the last validation out of the games.
+func (b *DiabloBridge) quarantineFiles() bool {
+	if err := b.d2service.QuarantineRogueFiles(); err != nil {
+		b.logger.Error(err)
+		return false
+	}
+
+	b.SetRogueFiles(0)
+
+	return true
+}
+
 func (b *DiabloBridge) applyDEP(path string) bool {
 	err := b.d2service.ApplyDEP(path)
 	if err != nil {
@@ -140,8 +356,64 @@ func (b *DiabloBridge) updateLaunchDelay(delay int) {
 	b.SetLaunchDelay(delay)
 }
 
+func (b *DiabloBridge) updateDownloadRateLimit(limit int) {
+	err := b.d2service.SetDownloadRateLimit(limit)
+	if err != nil {
+		b.logger.Error(err)
+		return
+	}
+
+	// Download rate limit was successfully saved, set it on the bridge.
+	b.SetDownloadRateLimit(limit)
+}
+
+func (b *DiabloBridge) installPackage(gameID string, archive string) bool {
+	if err := b.d2service.InstallPackage(gameID, archive); err != nil {
+		b.logger.Error(err)
+		return false
+	}
+
+	return true
+}
+
+func (b *DiabloBridge) uninstallPackage(gameID string, name string) bool {
+	if err := b.d2service.UninstallPackage(gameID, name); err != nil {
+		b.logger.Error(err)
+		return false
+	}
+
+	return true
+}
+
+// listPackages returns the installed packages of the game as JSON.
+func (b *DiabloBridge) listPackages(gameID string) string {
+	packages, err := b.d2service.ListPackages(gameID)
+	if err != nil {
+		b.logger.Error(err)
+		return "[]"
+	}
+
+	body, err := json.Marshal(packages)
+	if err != nil {
+		b.logger.Error(err)
+		return "[]"
+	}
+
+	return string(body)
+}
+
+// configChanged will keep the launch settings in sync with the config, such as after importing one.
+func (b *DiabloBridge) configChanged(change config.Change) {
+	if change.Kind != config.ChangeSettings && change.Kind != config.ChangeGamesReset {
+		return
+	}
+
+	b.SetLaunchDelay(change.Config.LaunchDelay)
+	b.SetDownloadRateLimit(change.Config.DownloadRateLimit)
+}
+
 // NewDiablo returns a new Diablo bridge with all dependencies set up.
-func NewDiablo(d2s d2.Service, fm *d2.FileModel, launchDelay int, logger log.Logger) *DiabloBridge {
+func NewDiablo(d2s d2.Service, cs config.Service, fm *d2.FileModel, launchDelay int, downloadRateLimit int, logger log.Logger) *DiabloBridge {
 	b := NewDiabloBridge(nil)
 
 	// Set dependencies.
@@ -158,6 +430,10 @@ func NewDiablo(d2s d2.Service, fm *d2.FileModel, launchDelay int, logger log.Log
 	b.SetValidVersion(false)
 	b.SetValidatingVersion(false)
 	b.SetLaunchDelay(launchDelay)
+	b.SetDownloadRateLimit(downloadRateLimit)
+
+	// Follow the changes made to the config.
+	cs.Subscribe(b.configChanged)
 
 	return b
 }
@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/lootfilter"
+	"github.com/nokka/slashdiablo-launcher/log"
+	"github.com/therecipe/qt/core"
+)
+
+// LootFilterBridge is the connection between QML and the loot filter of a game.
+type LootFilterBridge struct {
+	core.QObject
+
+	// Dependencies.
+	lootFilterService lootfilter.Service
+	logger            log.Logger
+
+	// Properties.
+	_ string `property:"error"`
+
+	// Models.
+	RuleModel *core.QAbstractListModel `property:"rules"`
+
+	// Slots.
+	_ func(gameID string) bool `slot:"loadRules"`
+	_ func(index int)          `slot:"toggleRule"`
+	_ func(from int, to int)   `slot:"moveRule"`
+	_ func() bool              `slot:"saveRules"`
+}
+
+// Connect will connect the QML signals to functions in Go.
+func (b *LootFilterBridge) Connect() {
+	b.ConnectLoadRules(b.loadRules)
+	b.ConnectToggleRule(b.toggleRule)
+	b.ConnectMoveRule(b.moveRule)
+	b.ConnectSaveRules(b.saveRules)
+}
+
+func (b *LootFilterBridge) loadRules(gameID string) bool {
+	return b.handle(b.lootFilterService.Load(gameID))
+}
+
+func (b *LootFilterBridge) toggleRule(index int) {
+	b.handle(b.lootFilterService.ToggleRule(index))
+}
+
+func (b *LootFilterBridge) moveRule(from int, to int) {
+	b.handle(b.lootFilterService.MoveRule(from, to))
+}
+
+func (b *LootFilterBridge) saveRules() bool {
+	return b.handle(b.lootFilterService.Save())
+}
+
+// handle will show the error to the user, if any, and tell if the call succeeded.
+func (b *LootFilterBridge) handle(err error) bool {
+	if err != nil {
+		b.logger.Error(err)
+		b.SetError(err.Error())
+		return false
+	}
+
+	b.SetError("")
+
+	return true
+}
+
+// NewLootFilter sets up a loot filter bridge with all dependencies.
+func NewLootFilter(lfs lootfilter.Service, rm *lootfilter.RuleModel, logger log.Logger) *LootFilterBridge {
+	b := NewLootFilterBridge(nil)
+
+	// Setup dependencies.
+	b.lootFilterService = lfs
+	b.logger = logger
+
+	// Setup model.
+	b.SetRules(rm)
+
+	return b
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/clients/hiddengamersdiablo"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/d2"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+	"github.com/nokka/slashdiablo-launcher/log"
+)
+
+// commands can be run from the command line instead of starting the launcher,
+// such as "hiddengamersdiablo-launcher verify".
+var commands = map[string]func(d2s d2.Service, out io.Writer) int{
+	"verify": verifyCommand,
+	"repair": repairCommand,
+}
+
+// runCommand will run the command in the arguments, it returns false if there is none.
+func runCommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+
+	configPath, err := getConfigPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1, true
+	}
+
+	logger := log.NewLogger(configPath)
+
+	store := storage.NewStore(configPath)
+	if err := store.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1, true
+	}
+
+	md := hiddengamersdiablo.NewClient()
+	cs := config.NewService(md, store, config.NewGameModel(nil))
+	d2s := d2.NewService(md, cs, logger, d2.NewFileModel(nil))
+
+	return command(d2s, os.Stdout), true
+}
+
+// verifyCommand will print the verify report of every game, it fails if any of them is broken.
+func verifyCommand(d2s d2.Service, out io.Writer) int {
+	reports, err := d2s.Verify()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	printReports(reports, out)
+
+	for _, r := range reports {
+		if len(r.Broken()) > 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// repairCommand will repair the broken files of every game, and verify them again.
+func repairCommand(d2s d2.Service, out io.Writer) int {
+	reports, err := d2s.Verify()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	done := make(chan bool, 1)
+	progress, state := d2s.Repair(reports, done)
+
+	for {
+		select {
+		case <-progress:
+		case current := <-state:
+			if current.Error != nil {
+				fmt.Fprintln(out, current.Error)
+				return 1
+			}
+
+			if current.Message != "" {
+				fmt.Fprintln(out, current.Message)
+			}
+		case <-done:
+			return verifyCommand(d2s, out)
+		}
+	}
+}
+
+func printReports(reports []d2.VerifyReport, out io.Writer) {
+	for _, r := range reports {
+		fmt.Fprintf(out, "%s: %d archivos verificados, %d con errores\n", r.Location, r.Checked, len(r.Broken()))
+
+		for _, issue := range r.Issues {
+			fmt.Fprintf(out, "  %-10s %s", issue.Problem, issue.Name)
+			if issue.Source != "" {
+				fmt.Fprintf(out, " (%s)", issue.Source)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package manaosdiablo
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 )
 
+// ErrNotFound is returned when the server doesn't publish the requested file.
+var ErrNotFound = errors.New("el archivo no existe en el servidor")
+
 // Client encapsulates the details of the Slashdiablo API.
 type Client struct {
 	address string
@@ -41,6 +45,36 @@ func (c *Client) GetAvailableMods() (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
+// GetAllowedFiles will fetch the executables and libraries allowed in a game install.
+func (c *Client) GetAllowedFiles() (io.ReadCloser, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/allowed_files.json", c.address))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	return resp.Body, nil
+}
+
+// GetRealm will fetch the settings of the realm, such as the required game version.
+func (c *Client) GetRealm() (io.ReadCloser, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/realm.json", c.address))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	return resp.Body, nil
+}
+
 // NewClient returns a new client with all dependencies setup.
 func NewClient() Client {
 	return Client{
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// Kinds of changes made to the config.
+const (
+	// ChangeGameAdded is a game added to the config.
+	ChangeGameAdded = iota
+
+	// ChangeGameUpdated is a game whose settings have changed.
+	ChangeGameUpdated
+
+	// ChangeGameRemoved is a game deleted from the config.
+	ChangeGameRemoved
+
+	// ChangeGamesReset is every game replaced at once, such as when importing a config.
+	ChangeGamesReset
+
+	// ChangeSettings is a change to the launch settings, such as the launch delay.
+	ChangeSettings
+)
+
+// Change is a change made to the config, it's published once it has been written to the store.
+type Change struct {
+	Kind   int
+	GameID string
+
+	// Config is the config as it was written.
+	Config *storage.Config
+}
+
+// Subscribe will call the listener with every change made to the config, in the order they're made.
+func (s *service) Subscribe(listener func(Change)) {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+}
+
+// publish will tell every listener about the change.
+func (s *service) publish(change Change) {
+	s.listenersMutex.Lock()
+	listeners := append([]func(Change){}, s.listeners...)
+	s.listenersMutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(change)
+	}
+}
+
+// update will change the config in the store and publish the change, the config is read,
+// changed and written while locked so changes are never lost. The game ID is the one changed,
+// if any, it's read after changing the config so new games can set it.
+func (s *service) update(kind int, gameID *string, change func(conf *storage.Config) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conf, err := s.store.Read()
+	if err != nil {
+		return err
+	}
+
+	if err := change(conf); err != nil {
+		return err
+	}
+
+	if err := s.store.Write(conf); err != nil {
+		return err
+	}
+
+	var id string
+	if gameID != nil {
+		id = *gameID
+	}
+
+	s.publish(Change{Kind: kind, GameID: id, Config: conf})
+
+	return nil
+}
+
+// findGame returns the game with the given id in the config.
+func findGame(conf *storage.Config, id string) *storage.Game {
+	for i := range conf.Games {
+		if conf.Games[i].ID == id {
+			return &conf.Games[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/clients/hiddengamersdiablo"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// fakeStore keeps the config in memory, encoded the way it's written to disk.
+type fakeStore struct {
+	mux  sync.Mutex
+	body []byte
+
+	// failWrites makes every write fail, such as a full disk.
+	failWrites bool
+}
+
+func (s *fakeStore) Load() error {
+	return nil
+}
+
+func (s *fakeStore) Read() (*storage.Config, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	conf := &storage.Config{Games: make([]storage.Game, 0)}
+	if s.body == nil {
+		return conf, nil
+	}
+
+	if err := json.Unmarshal(s.body, conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func (s *fakeStore) Write(conf *storage.Config) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.failWrites {
+		return errors.New("disco lleno")
+	}
+
+	body, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+
+	s.body = body
+
+	return nil
+}
+
+func (s *fakeStore) setFailWrites(fail bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.failWrites = fail
+}
+
+// newTestService returns a service on a fake store, followed by a game model.
+func newTestService(t *testing.T, games ...storage.Game) (*service, *fakeStore, *GameModel) {
+	t.Helper()
+
+	store := &fakeStore{}
+	if err := store.Write(&storage.Config{Games: append([]storage.Game{}, games...)}); err != nil {
+		t.Fatal(err)
+	}
+
+	model := NewGameModel(nil)
+	s := NewService(hiddengamersdiablo.Client{}, store, model).(*service)
+
+	// Mods are validated without asking the server.
+	s.availableMods = &GameMods{Mods: []Mod{
+		{Name: storage.ModMaphack, Versions: []string{"1.0"}},
+		{Name: storage.ModHD, Versions: []string{"1.0"}, Conflicts: []string{storage.ModMaphack}},
+	}}
+
+	return s, store, model
+}
+
+// modelGame returns the game of the model as it's kept in the store, without what the model doesn't show.
+func modelGame(g *Game) storage.Game {
+	return storage.Game{
+		ID:             g.ID,
+		Location:       g.Location,
+		Instances:      g.Instances,
+		OverrideBHCfg:  g.OverrideBHCfg,
+		Flags:          g.Flags,
+		HDVersion:      g.HDVersion,
+		MaphackVersion: g.MaphackVersion,
+		Mods:           g.Mods,
+		ProtectedFiles: g.ProtectedFiles,
+		HDSettings:     g.HDSettings,
+	}
+}
+
+// assertInSync fails the test if the model doesn't have exactly the games in the store.
+func assertInSync(t *testing.T, store *fakeStore, model *GameModel) {
+	t.Helper()
+
+	conf, err := store.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	games := model.Games()
+	if len(games) != len(conf.Games) {
+		t.Fatalf("expected %d games in the model, got %d", len(conf.Games), len(games))
+	}
+
+	for i := range conf.Games {
+		stored := conf.Games[i]
+		stored.Packages = nil
+
+		want, _ := json.Marshal(stored)
+		got, _ := json.Marshal(modelGame(games[i]))
+
+		if string(want) != string(got) {
+			t.Fatalf("game %d diverged:\nstore: %s\nmodel: %s", i, want, got)
+		}
+	}
+}
+
+func TestUpdateKeepsModelInSync(t *testing.T) {
+	s, store, model := newTestService(t, storage.Game{ID: "loaded", Location: "/games/d2", Instances: 1})
+
+	// The games already in the store are in the model.
+	assertInSync(t, store, model)
+
+	if err := s.AddGame(); err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+
+	if err := s.AddGameAt("/games/d2-clone"); err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+
+	id, err := s.InsertGame(storage.Game{Location: "/games/d2-bootstrap", Instances: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+
+	_, err = s.UpsertGame(UpdateGameRequest{
+		ID:             id,
+		Location:       "/games/d2-bootstrap",
+		Instances:      3,
+		Flags:          []string{"-w"},
+		HDVersion:      "1.0",
+		MaphackVersion: ModVersionNone,
+		HDSettings:     &storage.HDSettings{Resolution: "1280x720", Fullscreen: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+
+	if err := s.UpdatePackages(id, []storage.Package{{Name: "items"}}); err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+
+	if err := s.DeleteGame("loaded"); err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+
+	if err := s.UpdateLaunchDelay(2000); err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+
+	err = s.ImportConfig(&ImportPlan{Games: []ImportGame{{
+		Location: "",
+		game:     storage.Game{Instances: 1, Flags: []string{}, Mods: map[string]string{}},
+	}}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInSync(t, store, model)
+}
+
+func TestFailedUpdateKeepsModelInSync(t *testing.T) {
+	s, store, model := newTestService(t, storage.Game{ID: "loaded", Location: "/games/d2", Instances: 1, MaphackVersion: "1.0"})
+
+	// Rejected by the mods, nothing is written.
+	_, err := s.UpsertGame(UpdateGameRequest{
+		ID:             "loaded",
+		Location:       "/games/d2",
+		Instances:      4,
+		HDVersion:      "1.0",
+		MaphackVersion: "1.0",
+	})
+	if err == nil {
+		t.Fatal("expected conflicting mods to be rejected")
+	}
+	assertInSync(t, store, model)
+
+	// Unknown games.
+	if err := s.UpdatePackages("missing", nil); err != ErrGameNotFound {
+		t.Fatalf("expected ErrGameNotFound, got %v", err)
+	}
+	assertInSync(t, store, model)
+
+	// The store can't be written.
+	store.setFailWrites(true)
+
+	if err := s.AddGame(); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+
+	if err := s.DeleteGame("loaded"); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+
+	store.setFailWrites(false)
+	assertInSync(t, store, model)
+
+	if len(model.Games()) != 1 {
+		t.Fatalf("expected the model to keep the loaded game, got %d games", len(model.Games()))
+	}
+}
+
+func TestConcurrentUpdatesKeepModelInSync(t *testing.T) {
+	s, store, model := newTestService(t)
+
+	// Workers add games and install packages while the user edits them, such as
+	// cloning and repairing games at the same time.
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 10; i++ {
+				id, err := s.InsertGame(storage.Game{Location: fmt.Sprintf("/games/%d-%d", w, i), Instances: 1})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if err := s.UpdatePackages(id, []storage.Package{{Name: fmt.Sprintf("pkg-%d", i)}}); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if i%3 == 0 {
+					if err := s.DeleteGame(id); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	assertInSync(t, store, model)
+}
+
+func TestQueuedChangesApplyInOrder(t *testing.T) {
+	s, store, model := newTestService(t)
+
+	// The Qt thread is busy, the changes wait for it.
+	model.ConnectChangesQueued(func() {})
+
+	if err := s.AddGameAt("/games/d2"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := s.InsertGame(storage.Game{Location: "/games/d2-clone", Instances: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteGame(id); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(model.Games()) != 0 {
+		t.Fatalf("expected the model to be left alone outside of the Qt thread, got %d games", len(model.Games()))
+	}
+
+	// The Qt thread gets to the changes.
+	model.applyQueued()
+	assertInSync(t, store, model)
+
+	// Nothing is applied twice.
+	model.applyQueued()
+	assertInSync(t, store, model)
+}
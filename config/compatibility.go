@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// Severities of a mod issue.
+const (
+	// IssueError means the game can't be patched with the chosen mods.
+	IssueError = "error"
+
+	// IssueWarning means the chosen mods might not work as expected.
+	IssueWarning = "warning"
+)
+
+// ModConstraint describes what a version of a mod needs to work.
+type ModConstraint struct {
+	// Requires are the mods this version depends on, keyed by mod name,
+	// with the versions that work, an empty list means any version works.
+	Requires map[string][]string `json:"requires"`
+
+	// Conflicts are the mods this version can't be installed with, keyed by mod name,
+	// with the versions that conflict, an empty list means every version conflicts.
+	Conflicts map[string][]string `json:"conflicts"`
+
+	// GameVersions are the Diablo II versions this version works with, empty means all of them.
+	GameVersions []string `json:"game_versions"`
+}
+
+// ModIssue describes a problem with the mods chosen for a game, the reason is shown to the user.
+type ModIssue struct {
+	Mod      string `json:"mod"`
+	Severity string `json:"severity"`
+	Reason   string `json:"reason"`
+}
+
+// Error implements the error interface.
+func (i ModIssue) Error() string {
+	return i.Reason
+}
+
+// IssuesError returns the first issue that prevents the game from being patched, if any.
+func IssuesError(issues []ModIssue) error {
+	for _, issue := range issues {
+		if issue.Severity == IssueError {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+// CheckGame returns the issues found with the mods chosen for the game. The supported
+// game versions are only checked if a game version is given.
+func (g *GameMods) CheckGame(game *storage.Game, gameVersion string) []ModIssue {
+	var issues []ModIssue
+
+	mods := g.All()
+
+	for i, mod := range mods {
+		version := game.ModVersion(mod.Name)
+		if !ModEnabled(version) {
+			continue
+		}
+
+		// The version might have been removed from the server.
+		if !contains(mod.Versions, version) {
+			issues = append(issues, ModIssue{
+				Mod:      mod.Name,
+				Severity: IssueWarning,
+				Reason:   fmt.Sprintf("La version %s del mod %s ya no esta disponible", version, mod.Name),
+			})
+		}
+
+		// Mods that can't be installed together at all.
+		for _, other := range mods[i+1:] {
+			if ModEnabled(game.ModVersion(other.Name)) && mod.ConflictsWith(other) {
+				issues = append(issues, ModIssue{
+					Mod:      mod.Name,
+					Severity: IssueError,
+					Reason:   fmt.Sprintf("Los mods %s y %s no se pueden instalar juntos", mod.Name, other.Name),
+				})
+			}
+		}
+
+		constraint, ok := mod.Constraints[version]
+		if !ok {
+			continue
+		}
+
+		if gameVersion != "" && len(constraint.GameVersions) > 0 && !contains(constraint.GameVersions, gameVersion) {
+			issues = append(issues, ModIssue{
+				Mod:      mod.Name,
+				Severity: IssueError,
+				Reason: fmt.Sprintf("El mod %s %s solo funciona con Diablo II %s",
+					mod.Name, version, strings.Join(constraint.GameVersions, ", ")),
+			})
+		}
+
+		for _, name := range sortedKeys(constraint.Requires) {
+			versions := constraint.Requires[name]
+			other := game.ModVersion(name)
+
+			if !ModEnabled(other) {
+				issues = append(issues, ModIssue{
+					Mod:      mod.Name,
+					Severity: IssueError,
+					Reason:   fmt.Sprintf("El mod %s %s requiere el mod %s", mod.Name, version, name),
+				})
+				continue
+			}
+
+			if len(versions) > 0 && !contains(versions, other) {
+				issues = append(issues, ModIssue{
+					Mod:      mod.Name,
+					Severity: IssueError,
+					Reason: fmt.Sprintf("El mod %s %s requiere %s %s",
+						mod.Name, version, name, strings.Join(versions, " o ")),
+				})
+			}
+		}
+
+		for _, name := range sortedKeys(constraint.Conflicts) {
+			versions := constraint.Conflicts[name]
+			other := game.ModVersion(name)
+
+			if ModEnabled(other) && (len(versions) == 0 || contains(versions, other)) {
+				issues = append(issues, ModIssue{
+					Mod:      mod.Name,
+					Severity: IssueError,
+					Reason:   fmt.Sprintf("El mod %s %s no es compatible con %s %s", mod.Name, version, name, other),
+				})
+			}
+		}
+	}
+
+	return issues
+}
+
+// sortedKeys returns the keys of the map in order, so issues are always reported the same way.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,29 +1,199 @@
 package config
 
 import (
+	"strings"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
 	"github.com/therecipe/qt/core"
 )
 
 const (
 	// ModVersionNone is used to determine that no mod version has been chosen for a game.
-	ModVersionNone = "ninguno"
+	ModVersionNone = storage.ModVersionNone
+
+	// settingOverrideBHCfg is the game setting to keep the user's own BH.cfg.
+	settingOverrideBHCfg = "override_bh_cfg"
 )
 
 // Game represents a diablo installation in the configuration.
 type Game struct {
 	core.QObject
 
-	ID             string   `json:"id"`
-	Location       string   `json:"location"`
-	Instances      int      `json:"instances"`
-	OverrideBHCfg  bool     `json:"override_bh_cfg"`
-	Flags          []string `json:"flags"`
-	HDVersion      string   `json:"hd_version"`
-	MaphackVersion string   `json:"maphack_version"`
+	ID             string            `json:"id"`
+	Location       string            `json:"location"`
+	Instances      int               `json:"instances"`
+	OverrideBHCfg  bool              `json:"override_bh_cfg"`
+	Flags          []string          `json:"flags"`
+	HDVersion      string            `json:"hd_version"`
+	MaphackVersion string            `json:"maphack_version"`
+	Mods           map[string]string `json:"mods"`
+	ProtectedFiles []string          `json:"protected_files"`
+
+	// HDSettings are the settings written to the HD mod, nil keeps the ones in the game.
+	HDSettings *storage.HDSettings `json:"hd_settings"`
+}
+
+// newGame returns the game of the game model for the game in the persistent store.
+func newGame(game storage.Game) *Game {
+	g := NewGame(nil)
+	g.set(game)
+
+	return g
 }
 
+// set will update the game with the game in the persistent store.
+func (g *Game) set(game storage.Game) {
+	g.ID = game.ID
+	g.Location = game.Location
+	g.Instances = game.Instances
+	g.OverrideBHCfg = game.OverrideBHCfg
+	g.Flags = game.Flags
+	g.HDVersion = game.HDVersion
+	g.MaphackVersion = game.MaphackVersion
+	g.Mods = game.Mods
+	g.ProtectedFiles = game.ProtectedFiles
+	g.HDSettings = game.HDSettings
+}
+
+// DefaultFlags are the launch flags of new games.
+var DefaultFlags = []string{"-w", "-skiptobnet"}
+
+// HDResolutions are the resolutions the HD mod can be set to.
+var HDResolutions = []string{"800x600", "1068x600", "1280x720", "1344x700", "1600x900", "1920x1080"}
+
 // GameMods represents the mods available for a Diablo II game.
 type GameMods struct {
+	// HD and Maphack are the versions in the legacy format of the document,
+	// only used if no mod descriptors are present.
 	HD      []string `json:"hd"`
 	Maphack []string `json:"maphack"`
+
+	// Mods describes every mod available.
+	Mods []Mod `json:"mods"`
+}
+
+// All returns every mod available, in the order they should be applied.
+func (g *GameMods) All() []Mod {
+	if len(g.Mods) > 0 {
+		return g.Mods
+	}
+
+	// Legacy document, describe the maphack and HD mod the way they've always worked.
+	return []Mod{
+		{
+			Name:        storage.ModMaphack,
+			RemoteDir:   "maphack_{version}",
+			Identifiers: []string{"BH.dll"},
+			Merge:       []string{"BH.cfg"},
+			Versions:    g.Maphack,
+		},
+		{
+			Name:        storage.ModHD,
+			RemoteDir:   "hd_{version}",
+			Identifiers: []string{"D2HD.dll"},
+			Settings:    []string{"D2HD.ini"},
+			Versions:    g.HD,
+		},
+	}
+}
+
+// Versions returns the available versions of the mod with the given name.
+func (g *GameMods) Versions(name string) []string {
+	for _, m := range g.All() {
+		if m.Name == name {
+			return m.Versions
+		}
+	}
+
+	return nil
+}
+
+// Mod describes a mod that can be layered on top of a game install.
+type Mod struct {
+	Name string `json:"name"`
+
+	// RemoteDir is the remote directory of each version, {version} is replaced by the version.
+	RemoteDir string `json:"remote_dir"`
+
+	// Identifiers are the files used to determine if a version of the mod is installed.
+	Identifiers []string `json:"identifiers"`
+
+	// Conflicts are the names of the mods that can't be installed together with this one.
+	Conflicts []string `json:"conflicts"`
+
+	// Ignore are the files of the mod that shouldn't be patched nor reset.
+	Ignore []IgnoreRule `json:"ignore"`
+
+	// Merge are the files users usually edit, upstream changes are merged into them
+	// instead of overwriting them.
+	Merge []string `json:"merge"`
+
+	// Settings are the config files the launcher writes the user's settings to, they're
+	// only downloaded if missing and are kept when switching versions.
+	Settings []string `json:"settings"`
+
+	Versions []string `json:"versions"`
+
+	// Constraints are the dependencies and conflicts of each version, keyed by version.
+	Constraints map[string]ModConstraint `json:"constraints"`
+}
+
+// RemoteDirFor returns the remote directory of the given version.
+func (m Mod) RemoteDirFor(version string) string {
+	return strings.Replace(m.RemoteDir, "{version}", version, -1)
+}
+
+// ConflictsWith returns true if the mod can't be installed together with the given mod.
+func (m Mod) ConflictsWith(other Mod) bool {
+	for _, c := range m.Conflicts {
+		if c == other.Name {
+			return true
+		}
+	}
+
+	for _, c := range other.Conflicts {
+		if c == m.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IgnoredFiles returns the files of the mod that should be left alone for the given game.
+func (m Mod) IgnoredFiles(game *storage.Game) []string {
+	var ignored []string
+
+	for _, rule := range m.Ignore {
+		if rule.Applies(game) {
+			ignored = append(ignored, rule.File)
+		}
+	}
+
+	return ignored
+}
+
+// IgnoreRule describes a mod file that shouldn't be touched.
+type IgnoreRule struct {
+	File string `json:"file"`
+
+	// Setting is the game setting that enables the rule, if empty the file is always ignored.
+	Setting string `json:"setting"`
+}
+
+// Applies returns true if the rule is enabled for the given game.
+func (r IgnoreRule) Applies(game *storage.Game) bool {
+	switch r.Setting {
+	case "":
+		return true
+	case settingOverrideBHCfg:
+		return game.OverrideBHCfg
+	default:
+		return false
+	}
+}
+
+// ModEnabled returns true if the version means a mod should be installed.
+func ModEnabled(version string) bool {
+	return version != "" && version != ModVersionNone
 }
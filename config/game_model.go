@@ -1,6 +1,8 @@
 package config
 
 import (
+	"sync"
+
 	"github.com/therecipe/qt/core"
 )
 
@@ -13,6 +15,9 @@ const (
 	Flags
 	HDVersion
 	MaphackVersion
+	ProtectedFiles
+	HDResolution
+	HDFullscreen
 )
 
 // GameModel represents a Diablo game.
@@ -25,6 +30,14 @@ type GameModel struct {
 	_ []*Game                  `property:"games"`
 
 	_ func(*Game) `slot:"addGame"`
+
+	// Emitted when changes are waiting to be applied, the model lives in the Qt thread
+	// so the connection is queued when it's emitted from any other thread.
+	_ func() `signal:"changesQueued"`
+
+	// Changes made to the config that haven't been applied yet, in the order they were made.
+	pending    []Change
+	pendingMux sync.Mutex
 }
 
 func (m *GameModel) init() {
@@ -36,6 +49,9 @@ func (m *GameModel) init() {
 		Flags:          core.NewQByteArray2("flags", -1),
 		HDVersion:      core.NewQByteArray2("hd_version", -1),
 		MaphackVersion: core.NewQByteArray2("maphack_version", -1),
+		ProtectedFiles: core.NewQByteArray2("protected_files", -1),
+		HDResolution:   core.NewQByteArray2("hd_resolution", -1),
+		HDFullscreen:   core.NewQByteArray2("hd_fullscreen", -1),
 	})
 
 	m.ConnectData(m.data)
@@ -43,6 +59,7 @@ func (m *GameModel) init() {
 	m.ConnectColumnCount(m.columnCount)
 	m.ConnectRoleNames(m.roleNames)
 	m.ConnectAddGame(m.addGame)
+	m.ConnectChangesQueued(m.applyQueued)
 }
 
 func (m *GameModel) rowCount(*core.QModelIndex) int {
@@ -83,6 +100,18 @@ func (m *GameModel) data(index *core.QModelIndex, role int) *core.QVariant {
 		return core.NewQVariant1(item.HDVersion)
 	case MaphackVersion:
 		return core.NewQVariant1(item.MaphackVersion)
+	case ProtectedFiles:
+		return core.NewQVariant1(item.ProtectedFiles)
+	case HDResolution:
+		if item.HDSettings == nil {
+			return core.NewQVariant1("")
+		}
+		return core.NewQVariant1(item.HDSettings.Resolution)
+	case HDFullscreen:
+		if item.HDSettings == nil {
+			return core.NewQVariant1(false)
+		}
+		return core.NewQVariant1(item.HDSettings.Fullscreen)
 	default:
 		return core.NewQVariant()
 	}
@@ -99,7 +128,69 @@ func (m *GameModel) addGame(g *Game) {
 func (m *GameModel) updateGame(index int) {
 	var fIndex = m.Index(0, 0, core.NewQModelIndex())
 	var lIndex = m.Index(index, 0, core.NewQModelIndex())
-	m.DataChanged(fIndex, lIndex, []int{Location, Instances, OverrideBHCfg, Flags, HDVersion, MaphackVersion})
+	m.DataChanged(fIndex, lIndex, []int{Location, Instances, OverrideBHCfg, Flags, HDVersion, MaphackVersion, ProtectedFiles, HDResolution, HDFullscreen})
+}
+
+// queue will apply the change to the model in the Qt thread. Changes are made on worker
+// goroutines too, such as while cloning a game or installing a package, and the model
+// can only be changed from the thread it lives in.
+func (m *GameModel) queue(change Change) {
+	m.pendingMux.Lock()
+	m.pending = append(m.pending, change)
+	m.pendingMux.Unlock()
+
+	m.ChangesQueued()
+}
+
+// applyQueued will apply every change waiting, in order.
+func (m *GameModel) applyQueued() {
+	m.pendingMux.Lock()
+	changes := m.pending
+	m.pending = nil
+	m.pendingMux.Unlock()
+
+	for _, change := range changes {
+		m.apply(change)
+	}
+}
+
+// apply will update the model with a change made to the config.
+func (m *GameModel) apply(change Change) {
+	switch change.Kind {
+	case ChangeGameAdded:
+		if game := findGame(change.Config, change.GameID); game != nil {
+			m.AddGame(newGame(*game))
+		}
+	case ChangeGameUpdated:
+		game := findGame(change.Config, change.GameID)
+		for i, g := range m.Games() {
+			if game != nil && g.ID == game.ID {
+				g.set(*game)
+				m.updateGame(i)
+			}
+		}
+	case ChangeGameRemoved:
+		for i, g := range m.Games() {
+			if g.ID == change.GameID {
+				m.removeGame(i)
+				break
+			}
+		}
+	case ChangeGamesReset:
+		games := make([]*Game, 0, len(change.Config.Games))
+		for _, g := range change.Config.Games {
+			games = append(games, newGame(g))
+		}
+
+		m.resetGames(games)
+	}
+}
+
+// resetGames will replace every game in the model.
+func (m *GameModel) resetGames(games []*Game) {
+	m.BeginResetModel()
+	m.SetGames(games)
+	m.EndResetModel()
 }
 
 func (m *GameModel) removeGame(index int) {
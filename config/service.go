@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"sync"
 
@@ -9,35 +10,69 @@ import (
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
 )
 
-// Service is responsible for all things related to configuration.
+// Service is responsible for all things related to configuration. The store is the
+// only source of truth, every change is written to it right away and then published,
+// the game model follows the changes.
 type Service interface {
-	// Read will read the configuration and return it.
+	// Read will read the configuration and return it, games that haven't been given
+	// a location yet aren't ready to be patched or launched, so they're left out.
 	Read() (*storage.Config, error)
 
-	// AddGame adds a new game to the game model.
-	AddGame()
+	// Subscribe will call the listener with every change made to the config.
+	Subscribe(listener func(Change))
 
-	// UpsertGame updates or creates a new game to the persistent store.
-	UpsertGame(request UpdateGameRequest) error
+	// AddGame adds a new game to the persistent store.
+	AddGame() error
 
-	// DeleteGame will delete a game from the game model and the persistent store.
+	// AddGameAt adds a new game in the given location to the persistent store, such as a discovered install.
+	AddGameAt(location string) error
+
+	// UpsertGame updates the game in the persistent store, invalid mod
+	// combinations are rejected and any warnings about the mods are returned.
+	UpsertGame(request UpdateGameRequest) ([]ModIssue, error)
+
+	// DeleteGame will delete a game from the persistent store.
 	DeleteGame(id string) error
 
-	// PersistGameModel will persist the current game model to the persistent store.
-	PersistGameModel() error
+	// UpdatePackages will set the local mod packages installed in a game in the persistent store.
+	UpdatePackages(id string, packages []storage.Package) error
+
+	// InsertGame will add the game to the persistent store with a new ID, and return the ID.
+	InsertGame(game storage.Game) (string, error)
 
 	// UpdateLaunchDelay will update the launch delay for  games in the persistent store.
 	UpdateLaunchDelay(delay int) error
 
+	// UpdateDownloadRateLimit will update the download rate limit in KB/s in the persistent store.
+	UpdateDownloadRateLimit(limit int) error
+
 	// GetAvailableMods will fetch the game mode available to each D2 install.
 	GetAvailableMods() (*GameMods, error)
+
+	// ExportConfig will write the games and launch settings to a shared config at the given path.
+	ExportConfig(path string) error
+
+	// ReadImport will read the shared config at the given path, and map its games to this machine.
+	ReadImport(path string) (*ImportPlan, error)
+
+	// ImportConfig will add the games of the plan, merging them with the games or replacing them.
+	ImportConfig(plan *ImportPlan, replace bool) error
 }
 
+// ErrGameNotFound is used when a game doesn't exist in the persistent store.
+var ErrGameNotFound = errors.New("el juego no existe en la configuracion")
+
 type service struct {
 	hiddengamersdiabloClient hiddengamersdiablo.Client
 	store                    storage.Store
 	gameModel                *GameModel
 	mutex                    sync.Mutex
+	availableMods            *GameMods
+	modsMutex                sync.Mutex
+
+	// Listeners of the changes made to the config.
+	listeners      []func(Change)
+	listenersMutex sync.Mutex
 }
 
 // Read will read the configuration and return it.
@@ -47,32 +82,46 @@ func (s *service) Read() (*storage.Config, error) {
 		return nil, err
 	}
 
-	return conf, err
-}
+	games := make([]storage.Game, 0, len(conf.Games))
+	for _, g := range conf.Games {
+		if g.Location != "" {
+			games = append(games, g)
+		}
+	}
 
-// AddGame adds a new game to the game model.
-func (s *service) AddGame() {
-	// Lock before we update the model preventing race conditions.
-	s.mutex.Lock()
+	conf.Games = games
 
-	// Unlock when we're done.
-	defer s.mutex.Unlock()
+	return conf, err
+}
 
-	g := NewGame(nil)
+// AddGame adds a new game to the persistent store.
+func (s *service) AddGame() error {
+	return s.AddGameAt("")
+}
 
+// AddGameAt adds a new game in the given location to the persistent store.
+func (s *service) AddGameAt(location string) error {
 	// Generate an ID for the new game.
-	g.ID = uuid.New().String()
+	id := uuid.New().String()
 
-	// Default values.
-	g.Instances = 1
-	g.Flags = []string{"-w", "-skiptobnet"}
-	g.HDVersion = ModVersionNone
-	g.MaphackVersion = ModVersionNone
+	return s.update(ChangeGameAdded, &id, func(conf *storage.Config) error {
+		conf.Games = append(conf.Games, storage.Game{
+			ID:       id,
+			Location: location,
+
+			// Default values.
+			Instances:      1,
+			Flags:          append([]string{}, DefaultFlags...),
+			HDVersion:      ModVersionNone,
+			MaphackVersion: ModVersionNone,
+			Mods:           make(map[string]string),
+		})
 
-	s.gameModel.AddGame(g)
+		return nil
+	})
 }
 
-// UpdateGameRequest is the data used to update a game in the game model.
+// UpdateGameRequest is the data used to update a game in the config.
 type UpdateGameRequest struct {
 	ID             string   `json:"id"`
 	Location       string   `json:"location"`
@@ -81,126 +130,147 @@ type UpdateGameRequest struct {
 	Flags          []string `json:"flags"`
 	HDVersion      string   `json:"hd_version"`
 	MaphackVersion string   `json:"maphack_version"`
-}
 
-// UpsertGame will upsert the game to the config.
-func (s *service) UpsertGame(request UpdateGameRequest) error {
-	// Lock before we update the model preventing race conditions.
-	s.mutex.Lock()
-
-	// Unlock when we're done.
-	defer s.mutex.Unlock()
-
-	// Updates game model with the new information.
-	var updatedIndex int
-	games := s.gameModel.Games()
-	for i := 0; i < len(games); i++ {
-		if games[i].ID == request.ID {
-			updatedIndex = i
-			games[i].Location = request.Location
-			games[i].Instances = request.Instances
-			games[i].OverrideBHCfg = request.OverrideBHCfg
-			games[i].Flags = request.Flags
-			games[i].HDVersion = request.HDVersion
-			games[i].MaphackVersion = request.MaphackVersion
-		}
-	}
+	// Mods are the versions of any other mods, left untouched if not set.
+	Mods map[string]string `json:"mods"`
 
-	// Notify the UI of the change.
-	s.gameModel.updateGame(updatedIndex)
+	// ProtectedFiles are the files the user never wants patched, left untouched if not set.
+	ProtectedFiles []string `json:"protected_files"`
 
-	return nil
+	// HDSettings are the settings of the HD mod, left untouched if not set.
+	HDSettings *storage.HDSettings `json:"hd_settings"`
 }
 
-// DeleteGame will delete the game from the config.
-func (s *service) DeleteGame(id string) error {
-	// Lock before we update the model preventing race conditions.
-	s.mutex.Lock()
+// UpsertGame will update the game in the config.
+func (s *service) UpsertGame(request UpdateGameRequest) ([]ModIssue, error) {
+	var issues []ModIssue
 
-	// Unlock when we're done.
-	defer s.mutex.Unlock()
+	err := s.update(ChangeGameUpdated, &request.ID, func(conf *storage.Config) error {
+		game := findGame(conf, request.ID)
+		if game == nil {
+			return ErrGameNotFound
+		}
 
-	// Read the config in order to update it.
-	conf, err := s.store.Read()
-	if err != nil {
-		return err
-	}
+		updated := *game
+		updated.Location = request.Location
+		updated.Instances = request.Instances
+		updated.OverrideBHCfg = request.OverrideBHCfg
+		updated.Flags = request.Flags
+		updated.HDVersion = request.HDVersion
+		updated.MaphackVersion = request.MaphackVersion
 
-	// Delete game from the config.
-	for i := 0; i < len(conf.Games); i++ {
-		if conf.Games[i].ID == id {
-			// Remove the index from the game slice.
-			conf.Games = append(conf.Games[:i], conf.Games[i+1:]...)
+		if request.Mods != nil {
+			updated.Mods = request.Mods
 		}
-	}
 
-	// Write the new games slice to the config.
-	err = s.store.Write(conf)
-	if err != nil {
-		return err
-	}
+		if request.ProtectedFiles != nil {
+			updated.ProtectedFiles = request.ProtectedFiles
+		}
 
-	// Delete from the game model too.
-	games := s.gameModel.Games()
-	for i := 0; i < len(games); i++ {
-		if games[i].ID == id {
-			s.gameModel.removeGame(i)
+		if request.HDSettings != nil {
+			updated.HDSettings = request.HDSettings
+		}
+
+		// Make sure the chosen mods work together before accepting the change.
+		var err error
+		issues, err = s.checkGameMods(&updated)
+		if err != nil {
+			return err
 		}
-	}
 
-	return nil
+		*game = updated
+
+		return nil
+	})
+
+	return issues, err
 }
 
-// PersistGameModel will persist the current game model to the persistent store.
-func (s *service) PersistGameModel() error {
-	conf, err := s.store.Read()
+// checkGameMods returns the issues with the mods of the game, and an error if
+// the combination isn't allowed.
+func (s *service) checkGameMods(game *storage.Game) ([]ModIssue, error) {
+	mods, err := s.cachedAvailableMods()
 	if err != nil {
-		return err
+		// We can't validate without the mods, they will be validated again before patching.
+		return nil, nil
 	}
 
-	// Fetch the current game model.
-	games := s.gameModel.Games()
+	issues := mods.CheckGame(game, "")
 
-	// Reset the games in the config.
-	conf.Games = make([]storage.Game, 0)
+	return issues, IssuesError(issues)
+}
 
-	// Go through all games and populate a config slice.
-	for i := 0; i < len(games); i++ {
-		conf.Games = append(conf.Games, storage.Game{
-			ID:             games[i].ID,
-			Location:       games[i].Location,
-			Instances:      games[i].Instances,
-			OverrideBHCfg:  games[i].OverrideBHCfg,
-			Flags:          games[i].Flags,
-			HDVersion:      games[i].HDVersion,
-			MaphackVersion: games[i].MaphackVersion,
-		})
-	}
+// cachedAvailableMods returns the available mods, only fetching them the first time.
+func (s *service) cachedAvailableMods() (*GameMods, error) {
+	s.modsMutex.Lock()
+	mods := s.availableMods
+	s.modsMutex.Unlock()
 
-	err = s.store.Write(conf)
-	if err != nil {
-		return err
+	if mods != nil {
+		return mods, nil
 	}
 
-	return nil
+	return s.GetAvailableMods()
 }
 
-// UpdateLaunchDelay will update the Diablo launch delay in the store.
-func (s *service) UpdateLaunchDelay(delay int) error {
-	conf, err := s.store.Read()
-	if err != nil {
-		return err
-	}
+// DeleteGame will delete the game from the config.
+func (s *service) DeleteGame(id string) error {
+	return s.update(ChangeGameRemoved, &id, func(conf *storage.Config) error {
+		for i := 0; i < len(conf.Games); i++ {
+			if conf.Games[i].ID == id {
+				// Remove the index from the game slice.
+				conf.Games = append(conf.Games[:i], conf.Games[i+1:]...)
+				return nil
+			}
+		}
+
+		return ErrGameNotFound
+	})
+}
 
-	// Update launch delay.
-	conf.LaunchDelay = delay
+// InsertGame will add the game to the config with a new ID, such as a cloned install.
+func (s *service) InsertGame(game storage.Game) (string, error) {
+	game.ID = uuid.New().String()
 
-	err = s.store.Write(conf)
+	err := s.update(ChangeGameAdded, &game.ID, func(conf *storage.Config) error {
+		conf.Games = append(conf.Games, game)
+		return nil
+	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return game.ID, nil
+}
+
+// UpdatePackages will update the packages installed in the game with the given id.
+func (s *service) UpdatePackages(id string, packages []storage.Package) error {
+	return s.update(ChangeGameUpdated, &id, func(conf *storage.Config) error {
+		game := findGame(conf, id)
+		if game == nil {
+			return ErrGameNotFound
+		}
+
+		game.Packages = packages
+
+		return nil
+	})
+}
+
+// UpdateLaunchDelay will update the Diablo launch delay in the store.
+func (s *service) UpdateLaunchDelay(delay int) error {
+	return s.update(ChangeSettings, nil, func(conf *storage.Config) error {
+		conf.LaunchDelay = delay
+		return nil
+	})
+}
+
+// UpdateDownloadRateLimit will update the download rate limit in the store.
+func (s *service) UpdateDownloadRateLimit(limit int) error {
+	return s.update(ChangeSettings, nil, func(conf *storage.Config) error {
+		conf.DownloadRateLimit = limit
+		return nil
+	})
 }
 
 // GetAvailableMods will get available mods from the Slashdiablo API.
@@ -220,6 +290,11 @@ func (s *service) GetAvailableMods() (*GameMods, error) {
 		return nil, err
 	}
 
+	// Cache the mods for validation.
+	s.modsMutex.Lock()
+	s.availableMods = &gameMods
+	s.modsMutex.Unlock()
+
 	return &gameMods, nil
 }
 
@@ -229,9 +304,18 @@ func NewService(
 	store storage.Store,
 	gameModel *GameModel,
 ) Service {
-	return &service{
+	s := &service{
 		hiddengamersdiabloClient: hiddengamersdiabloClient,
 		store:                    store,
 		gameModel:                gameModel,
 	}
+
+	// The game model follows the store, starting with the games already in it.
+	s.Subscribe(gameModel.queue)
+
+	if conf, err := store.Read(); err == nil {
+		s.publish(Change{Kind: ChangeGamesReset, Config: conf})
+	}
+
+	return s
 }
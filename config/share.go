@@ -0,0 +1,406 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// SharedConfigVersion is the version of the format of shared configs.
+const SharedConfigVersion = 1
+
+// Path variables in the locations of shared configs, they're replaced by
+// the directories of the machine that imports the config.
+const (
+	VarHome            = "{home}"
+	VarProgramFiles    = "{programfiles}"
+	VarProgramFilesX86 = "{programfilesx86}"
+)
+
+// SharedConfig is a launcher setup that can be shared between machines. It doesn't
+// have the IDs or the packages of the games, they only make sense on the machine
+// that exported it, and the locations are templated with path variables.
+type SharedConfig struct {
+	Version           int          `json:"version"`
+	LaunchDelay       int          `json:"launch_delay"`
+	DownloadRateLimit int          `json:"download_rate_limit"`
+	Games             []SharedGame `json:"games"`
+}
+
+// SharedGame is a game of a shared config.
+type SharedGame struct {
+	Location       string              `json:"location"`
+	Instances      int                 `json:"instances"`
+	OverrideBHCfg  bool                `json:"override_bh_cfg"`
+	Flags          []string            `json:"flags"`
+	HDVersion      string              `json:"hd_version"`
+	MaphackVersion string              `json:"maphack_version"`
+	Mods           map[string]string   `json:"mods,omitempty"`
+	ProtectedFiles []string            `json:"protected_files,omitempty"`
+	HDSettings     *storage.HDSettings `json:"hd_settings,omitempty"`
+}
+
+// ImportPlan is a shared config read to be imported, with its games mapped to installs on this machine.
+type ImportPlan struct {
+	LaunchDelay       int          `json:"launch_delay"`
+	DownloadRateLimit int          `json:"download_rate_limit"`
+	Games             []ImportGame `json:"games"`
+}
+
+// ImportGame is a game of a shared config and the install it's imported to.
+type ImportGame struct {
+	// Shared is the location in the shared config.
+	Shared string `json:"shared"`
+
+	// Location is the install the game is imported to, it can be changed before importing.
+	Location string `json:"location"`
+
+	// Found is true if there's a Diablo II install in the location.
+	Found bool `json:"found"`
+
+	// Issues are the problems with the mods of the game on this machine.
+	Issues []ModIssue `json:"issues"`
+
+	game storage.Game
+}
+
+// SetLocation will import the game at index to the given location instead.
+func (p *ImportPlan) SetLocation(index int, location string) error {
+	if index < 0 || index >= len(p.Games) {
+		return fmt.Errorf("juego fuera de rango: %d", index)
+	}
+
+	p.Games[index].Location = location
+	p.Games[index].Found = isInstall(location)
+
+	return nil
+}
+
+// Err returns the first issue that prevents the plan from being imported, if any.
+func (p *ImportPlan) Err() error {
+	for _, g := range p.Games {
+		if err := IssuesError(g.Issues); err != nil {
+			return fmt.Errorf("%s: %s", g.Shared, err)
+		}
+	}
+
+	return nil
+}
+
+// ExportConfig will write the games and launch settings to a shared config at the given path.
+func (s *service) ExportConfig(path string) error {
+	conf, err := s.store.Read()
+	if err != nil {
+		return err
+	}
+
+	shared := SharedConfig{
+		Version:           SharedConfigVersion,
+		LaunchDelay:       conf.LaunchDelay,
+		DownloadRateLimit: conf.DownloadRateLimit,
+		Games:             make([]SharedGame, 0, len(conf.Games)),
+	}
+
+	for _, g := range conf.Games {
+		// No flags at all are exported as such, a missing list gets the default flags.
+		flags := g.Flags
+		if flags == nil {
+			flags = make([]string, 0)
+		}
+
+		shared.Games = append(shared.Games, SharedGame{
+			Location:       templateLocation(g.Location),
+			Instances:      g.Instances,
+			OverrideBHCfg:  g.OverrideBHCfg,
+			Flags:          flags,
+			HDVersion:      g.HDVersion,
+			MaphackVersion: g.MaphackVersion,
+			Mods:           g.Mods,
+			ProtectedFiles: g.ProtectedFiles,
+			HDSettings:     g.HDSettings,
+		})
+	}
+
+	body, err := json.MarshalIndent(shared, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, body, storage.Permissions)
+}
+
+// ReadImport will read the shared config at the given path, and map its games to this machine.
+// Mod versions that aren't available are dropped, with a warning.
+func (s *service) ReadImport(path string) (*ImportPlan, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared SharedConfig
+	if err := json.Unmarshal(body, &shared); err != nil {
+		return nil, fmt.Errorf("%s no es una configuracion compartida: %s", path, err)
+	}
+
+	// Any JSON object decodes, shared configs always have a version.
+	if shared.Version < 1 {
+		return nil, fmt.Errorf("%s no es una configuracion compartida: version %d", path, shared.Version)
+	}
+
+	if shared.Version > SharedConfigVersion {
+		return nil, fmt.Errorf("la configuracion compartida es de una version mas nueva del lanzador (%d)", shared.Version)
+	}
+
+	mods, err := s.cachedAvailableMods()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ImportPlan{
+		LaunchDelay:       shared.LaunchDelay,
+		DownloadRateLimit: shared.DownloadRateLimit,
+		Games:             make([]ImportGame, 0, len(shared.Games)),
+	}
+
+	for _, g := range shared.Games {
+		game := storage.Game{
+			Instances:      g.Instances,
+			OverrideBHCfg:  g.OverrideBHCfg,
+			Flags:          g.Flags,
+			HDVersion:      g.HDVersion,
+			MaphackVersion: g.MaphackVersion,
+			Mods:           g.Mods,
+			ProtectedFiles: g.ProtectedFiles,
+			HDSettings:     g.HDSettings,
+		}
+
+		if game.Flags == nil {
+			game.Flags = append([]string{}, DefaultFlags...)
+		}
+
+		if game.Mods == nil {
+			game.Mods = make(map[string]string)
+		}
+
+		location := expandLocation(g.Location)
+
+		plan.Games = append(plan.Games, ImportGame{
+			Shared:   g.Location,
+			Location: location,
+			Found:    isInstall(location),
+			Issues:   checkImportedMods(&game, mods),
+			game:     game,
+		})
+	}
+
+	return plan, nil
+}
+
+// ImportConfig will add the games of the plan to the persistent store, the game model follows. Replacing
+// removes every game first and takes the launch settings of the plan, merging updates the games in
+// the same locations and keeps the launch settings.
+func (s *service) ImportConfig(plan *ImportPlan, replace bool) error {
+	if err := plan.Err(); err != nil {
+		return err
+	}
+
+	return s.update(ChangeGamesReset, nil, func(conf *storage.Config) error {
+		importGames(conf, plan, replace)
+		return nil
+	})
+}
+
+// importGames will add the games of the plan to the config.
+func importGames(conf *storage.Config, plan *ImportPlan, replace bool) {
+	if replace {
+		conf.Games = make([]storage.Game, 0, len(plan.Games))
+		conf.LaunchDelay = plan.LaunchDelay
+		conf.DownloadRateLimit = plan.DownloadRateLimit
+	}
+
+	for _, imported := range plan.Games {
+		game := imported.game
+		game.Location = importLocation(imported)
+
+		existing := -1
+		for i := range conf.Games {
+			if game.Location != "" && sameLocation(conf.Games[i].Location, game.Location) {
+				existing = i
+			}
+		}
+
+		// The install keeps its ID and packages, only the settings are imported.
+		if existing >= 0 {
+			game.ID = conf.Games[existing].ID
+			game.Packages = conf.Games[existing].Packages
+			conf.Games[existing] = game
+			continue
+		}
+
+		game.ID = uuid.New().String()
+		conf.Games = append(conf.Games, game)
+	}
+}
+
+// importLocation returns the location the game is imported to. Games that aren't mapped to an install
+// on this machine, such as locations with path variables that don't exist here, are imported without
+// a location, so they show up as unconfigured instead of pointing somewhere that doesn't exist.
+func importLocation(imported ImportGame) string {
+	if !imported.Found || hasPathVariable(imported.Location) {
+		return ""
+	}
+
+	return imported.Location
+}
+
+// hasPathVariable returns true if the location still has a path variable, known or not.
+func hasPathVariable(location string) bool {
+	start := strings.Index(location, "{")
+	return start >= 0 && strings.Contains(location[start:], "}")
+}
+
+// checkImportedMods will drop the mod versions of the game that aren't available,
+// and return the issues with the mods that are left.
+func checkImportedMods(game *storage.Game, mods *GameMods) []ModIssue {
+	issues := make([]ModIssue, 0)
+
+	for _, mod := range mods.All() {
+		version := game.ModVersion(mod.Name)
+		if !ModEnabled(version) || contains(mod.Versions, version) {
+			continue
+		}
+
+		issues = append(issues, ModIssue{
+			Mod:      mod.Name,
+			Severity: IssueWarning,
+			Reason:   fmt.Sprintf("La version %s del mod %s no esta disponible, se importa sin el mod", version, mod.Name),
+		})
+
+		switch mod.Name {
+		case storage.ModHD:
+			game.HDVersion = ModVersionNone
+		case storage.ModMaphack:
+			game.MaphackVersion = ModVersionNone
+		default:
+			game.Mods[mod.Name] = ModVersionNone
+		}
+	}
+
+	// Mods the server doesn't know about at all.
+	for name, version := range game.Mods {
+		if ModEnabled(version) && mods.Versions(name) == nil {
+			issues = append(issues, ModIssue{
+				Mod:      name,
+				Severity: IssueWarning,
+				Reason:   fmt.Sprintf("El mod %s no esta disponible, se importa sin el mod", name),
+			})
+
+			delete(game.Mods, name)
+		}
+	}
+
+	return append(issues, mods.CheckGame(game, "")...)
+}
+
+// pathVariables returns the directories of this machine the path variables stand for,
+// in the order they're tried, more specific directories first.
+func pathVariables() [][2]string {
+	var vars [][2]string
+
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("ProgramFiles(x86)"); dir != "" {
+			vars = append(vars, [2]string{VarProgramFilesX86, dirLocation(dir)})
+		}
+
+		if dir := os.Getenv("ProgramFiles"); dir != "" {
+			vars = append(vars, [2]string{VarProgramFiles, dirLocation(dir)})
+		}
+	}
+
+	if dir, err := os.UserHomeDir(); err == nil {
+		vars = append(vars, [2]string{VarHome, dirLocation(dir)})
+	}
+
+	return vars
+}
+
+// templateLocation replaces the directories of this machine in the location with path variables.
+func templateLocation(location string) string {
+	for _, v := range pathVariables() {
+		if rest, ok := trimLocation(location, v[1]); ok {
+			return v[0] + rest
+		}
+	}
+
+	return location
+}
+
+// expandLocation replaces the path variables in the location with the directories of this machine,
+// variables that don't exist on this machine are kept, so the game has to be mapped by hand.
+func expandLocation(location string) string {
+	for _, v := range pathVariables() {
+		if location == v[0] || strings.HasPrefix(location, v[0]+"/") {
+			return v[1] + strings.TrimPrefix(location, v[0])
+		}
+	}
+
+	return location
+}
+
+// trimLocation returns the rest of the location after the directory, if it's in it.
+func trimLocation(location string, dir string) (string, bool) {
+	if len(location) < len(dir) || !sameLocation(location[:len(dir)], dir) {
+		return "", false
+	}
+
+	rest := location[len(dir):]
+	if rest != "" && !strings.HasPrefix(rest, "/") {
+		return "", false
+	}
+
+	return rest, true
+}
+
+// sameLocation returns true if the locations are the same, Windows paths aren't case sensitive.
+func sameLocation(a, b string) bool {
+	a, b = strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/")
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+
+	return a == b
+}
+
+// dirLocation returns the location of the directory, the way it's stored in the config.
+// Windows locations start with a slash, such as "/C:/Diablo II".
+func dirLocation(dir string) string {
+	location := filepath.ToSlash(dir)
+	if !strings.HasPrefix(location, "/") {
+		location = "/" + location
+	}
+
+	return location
+}
+
+// isInstall returns true if there's a Diablo II install in the location.
+func isInstall(location string) bool {
+	dir := location
+	if runtime.GOOS == "windows" {
+		dir = strings.TrimPrefix(dir, "/")
+	}
+
+	for _, name := range []string{"Diablo II.exe", "Game.exe"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// newTestInstall returns the location of a new directory with a Diablo II install in it.
+func newTestInstall(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "d2install")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Game.exe"), nil, storage.Permissions); err != nil {
+		t.Fatal(err)
+	}
+
+	return dirLocation(dir)
+}
+
+// importGame returns a game of a plan, the way ReadImport maps it to this machine.
+func importGame(shared string, location string, instances int) ImportGame {
+	return ImportGame{
+		Shared:   shared,
+		Location: location,
+		Found:    isInstall(location),
+		game:     storage.Game{Instances: instances, Flags: []string{}, Mods: map[string]string{}},
+	}
+}
+
+func TestReadImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "shared config", body: `{"version": 1, "games": [{"location": "{home}/Diablo II", "instances": 1}]}`},
+		{name: "not json", body: `Diablo II`, wantErr: true},
+		{name: "not an object", body: `[]`, wantErr: true},
+		{name: "other json", body: `{"games": []}`, wantErr: true},
+		{name: "negative version", body: `{"version": -1, "games": []}`, wantErr: true},
+		{name: "newer version", body: `{"version": 2, "games": []}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, _ := newTestService(t)
+
+			dir, err := ioutil.TempDir("", "d2shared")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "shared.json")
+			if err := ioutil.WriteFile(path, []byte(tt.body), storage.Permissions); err != nil {
+				t.Fatal(err)
+			}
+
+			plan, err := s.ReadImport(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", plan)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(plan.Games) != 1 {
+				t.Fatalf("expected a game to import, got %+v", plan.Games)
+			}
+		})
+	}
+}
+
+func TestImportGamesLocations(t *testing.T) {
+	install := newTestInstall(t)
+	missing := filepath.ToSlash(filepath.Join(filepath.Dir(install), "missing-d2-install"))
+
+	plan := &ImportPlan{Games: []ImportGame{
+		importGame(install, install, 1),
+		importGame("{appdata}/Diablo II", "{appdata}/Diablo II", 2),
+		importGame(missing, missing, 3),
+	}}
+
+	conf := &storage.Config{Games: make([]storage.Game, 0)}
+	importGames(conf, plan, false)
+
+	if len(conf.Games) != 3 {
+		t.Fatalf("expected 3 games, got %+v", conf.Games)
+	}
+
+	want := []string{install, "", ""}
+	for i, location := range want {
+		if conf.Games[i].Location != location {
+			t.Fatalf("expected game %d to have location %q, got %q", i, location, conf.Games[i].Location)
+		}
+
+		if conf.Games[i].ID == "" {
+			t.Fatalf("expected game %d to get an ID", i)
+		}
+	}
+}
+
+func TestImportGamesMerge(t *testing.T) {
+	install := newTestInstall(t)
+
+	packages := []storage.Package{{Name: "items"}}
+	conf := &storage.Config{
+		LaunchDelay: 500,
+		Games: []storage.Game{
+			{ID: "existing", Location: install, Instances: 1, Packages: packages},
+			{ID: "unconfigured", Location: "", Instances: 1},
+		},
+	}
+
+	plan := &ImportPlan{
+		LaunchDelay: 2000,
+		Games: []ImportGame{
+			importGame(install, install, 4),
+			importGame("{appdata}/Diablo II", "{appdata}/Diablo II", 2),
+		},
+	}
+
+	importGames(conf, plan, false)
+
+	// The install keeps its ID and packages, games without a location are never merged.
+	if len(conf.Games) != 3 {
+		t.Fatalf("expected 3 games, got %+v", conf.Games)
+	}
+
+	if g := conf.Games[0]; g.ID != "existing" || g.Instances != 4 || len(g.Packages) != 1 {
+		t.Fatalf("expected the existing game to be updated, got %+v", g)
+	}
+
+	if g := conf.Games[1]; g.ID != "unconfigured" || g.Instances != 1 {
+		t.Fatalf("expected the unconfigured game to be left alone, got %+v", g)
+	}
+
+	if g := conf.Games[2]; g.Location != "" || g.Instances != 2 {
+		t.Fatalf("expected an unconfigured game to be added, got %+v", g)
+	}
+
+	if conf.LaunchDelay != 500 {
+		t.Fatalf("expected merging to keep the launch delay, got %d", conf.LaunchDelay)
+	}
+}
+
+func TestImportGamesReplace(t *testing.T) {
+	install := newTestInstall(t)
+
+	conf := &storage.Config{
+		LaunchDelay: 500,
+		Games:       []storage.Game{{ID: "existing", Location: "/somewhere/else"}},
+	}
+
+	plan := &ImportPlan{
+		LaunchDelay:       2000,
+		DownloadRateLimit: 512,
+		Games:             []ImportGame{importGame(install, install, 1)},
+	}
+
+	importGames(conf, plan, true)
+
+	if len(conf.Games) != 1 || conf.Games[0].Location != install {
+		t.Fatalf("expected only the imported game, got %+v", conf.Games)
+	}
+
+	if conf.LaunchDelay != 2000 || conf.DownloadRateLimit != 512 {
+		t.Fatalf("expected the launch settings of the plan, got %+v", conf)
+	}
+}
+
+func TestImportPlanSetLocation(t *testing.T) {
+	install := newTestInstall(t)
+
+	plan := &ImportPlan{Games: []ImportGame{importGame("{appdata}/Diablo II", "{appdata}/Diablo II", 1)}}
+
+	if err := plan.SetLocation(0, install); err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Games[0].Found {
+		t.Fatal("expected the install to be found")
+	}
+
+	conf := &storage.Config{Games: make([]storage.Game, 0)}
+	importGames(conf, plan, false)
+
+	if conf.Games[0].Location != install {
+		t.Fatalf("expected the game to be imported to the chosen install, got %q", conf.Games[0].Location)
+	}
+
+	if err := plan.SetLocation(1, install); err == nil {
+		t.Fatal("expected an index out of range to fail")
+	}
+}
+
+func TestHasPathVariable(t *testing.T) {
+	tests := map[string]bool{
+		"{home}/Diablo II":           true,
+		"{appdata}/Diablo II":        true,
+		"/C:/Games/{home}":           true,
+		"/C:/Program Files/Diablo":   false,
+		"/home/user/Diablo II {1.13": false,
+	}
+
+	for location, want := range tests {
+		if got := hasPathVariable(location); got != want {
+			t.Fatalf("expected hasPathVariable(%q) to be %t", location, want)
+		}
+	}
+}
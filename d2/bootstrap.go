@@ -0,0 +1,228 @@
+package d2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// bootstrapDirName is the name of the install created in a target that isn't empty.
+const bootstrapDirName = "Diablo II"
+
+// baseMPQs are the MPQs of the original Diablo II and Lord of Destruction installers, everything
+// else in an install is in the patches. They're only found by name, their contents aren't checked.
+var baseMPQs = []string{
+	"d2char.mpq",
+	"d2data.mpq",
+	"d2exp.mpq",
+	"d2music.mpq",
+	"d2sfx.mpq",
+	"d2speech.mpq",
+	"d2video.mpq",
+	"d2xmusic.mpq",
+	"d2xtalk.mpq",
+	"d2xvideo.mpq",
+}
+
+// BootstrapGame will create a new install in the target directory from the MPQs of the original
+// installers found in the source directory, patch it to the game version of the realm and the current patch, and add it
+// as a new game. Progress is reported the same way as patching.
+func (s *service) BootstrapGame(source string, target string, done chan bool) (<-chan float32, <-chan PatchState) {
+	// Progress is buffered so the downloader can publish without waiting on the UI.
+	progress := make(chan float32, 1)
+	state := make(chan PatchState)
+
+	go func() {
+		conf, err := s.configService.Read()
+		if err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		// Apply the download rate limit set by the user.
+		s.limiter.SetRate(int64(conf.DownloadRateLimit) * 1024)
+
+		// Follow the realm settings published right now.
+		s.refreshRealm()
+
+		// Keep what's been hashed for the next time.
+		defer s.saveHashIndexes()
+
+		mpqs, err := findBaseMPQs(source)
+		if err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		target, err = emptyTarget(target, bootstrapDirName)
+		if err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		if err := s.bootstrapInstall(mpqs, target, state, progress); err != nil {
+			// Don't leave a broken install behind, the target was empty to begin with.
+			if cleanErr := os.RemoveAll(localizePath(target)); cleanErr != nil {
+				state <- PatchState{Error: fmt.Errorf("Error de limpieza: %s : %s", err, cleanErr)}
+				return
+			}
+
+			state <- PatchState{Error: err}
+			return
+		}
+
+		game := storage.Game{
+			Location:       target,
+			Instances:      1,
+			Flags:          append([]string{}, config.DefaultFlags...),
+			HDVersion:      config.ModVersionNone,
+			MaphackVersion: config.ModVersionNone,
+			Mods:           make(map[string]string),
+		}
+
+		if _, err := s.configService.InsertGame(game); err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		state <- PatchState{Message: fmt.Sprintf("Instalacion creada en %s", target)}
+
+		done <- true
+	}()
+
+	return progress, state
+}
+
+// bootstrapInstall will put the MPQs in the target and patch it, the same way a game is patched.
+func (s *service) bootstrapInstall(mpqs map[string]string, target string, state chan PatchState, progress chan float32) error {
+	dst := localizePath(target)
+
+	_, versionManifest, err := s.getVersionManifest()
+	if err != nil {
+		return err
+	}
+
+	slashManifest, err := s.getManifest("current/manifest.json")
+	if err != nil {
+		return err
+	}
+
+	// The MPQs are linked if they're on the same volume, the patch is downloaded in full.
+	linked, err := sameVolume(filepath.Dir(mpqs[baseMPQs[0]]), dst)
+	if err != nil {
+		return err
+	}
+
+	var required, total uint64
+	infos := make(map[string]os.FileInfo, len(mpqs))
+	for _, name := range baseMPQs {
+		info, err := os.Stat(mpqs[name])
+		if err != nil {
+			return err
+		}
+
+		infos[name] = info
+		total += uint64(info.Size())
+	}
+
+	if !linked {
+		required += total
+	}
+
+	for _, m := range []*Manifest{versionManifest, slashManifest} {
+		for _, f := range m.Files {
+			if !f.Deprecated {
+				required += uint64(f.ContentLength)
+			}
+		}
+	}
+
+	if err := checkFreeSpace(dst, required); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, storage.Permissions); err != nil {
+		return err
+	}
+
+	state <- PatchState{Message: fmt.Sprintf("Copiando los archivos del instalador a %s", target)}
+
+	counter := NewWriteCounter(int64(total), progress)
+
+	// Reset progress.
+	counter.publish(0)
+
+	for _, name := range baseMPQs {
+		dstPath := filepath.Join(dst, name)
+
+		// Fall back to copying if the filesystem can't link, such as from a disc.
+		if os.Link(mpqs[name], dstPath) == nil {
+			counter.add(infos[name].Size())
+			continue
+		}
+
+		if err := copyFile(mpqs[name], dstPath, infos[name], counter); err != nil {
+			return err
+		}
+	}
+
+	// The install has every MPQ, the patches bring the rest of the game.
+	if err := s.applyGameVersion(target, nil, state, progress); err != nil {
+		return err
+	}
+
+	if err := s.applySlashPatch(target, nil, state, progress); err != nil {
+		return err
+	}
+
+	return configureForOS(target)
+}
+
+// findBaseMPQs returns the paths of the base MPQs in the source directory or any of its
+// subdirectories, such as the contents of every installer disc copied into one directory.
+func findBaseMPQs(source string) (map[string]string, error) {
+	wanted := make(map[string]bool, len(baseMPQs))
+	for _, name := range baseMPQs {
+		wanted[name] = true
+	}
+
+	found := make(map[string]string, len(baseMPQs))
+
+	err := filepath.Walk(localizePath(source), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.ToLower(info.Name())
+		if info.IsDir() || !wanted[name] {
+			return nil
+		}
+
+		// The first one found is used.
+		if _, ok := found[name]; !ok {
+			found[name] = p
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range baseMPQs {
+		if _, ok := found[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("faltan archivos del instalador en %s: %s", source, strings.Join(missing, ", "))
+	}
+
+	return found, nil
+}
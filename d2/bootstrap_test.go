@@ -0,0 +1,190 @@
+package d2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// newInstallerDir returns a directory with zero-byte placeholders of the base MPQs, spread
+// over two discs with upper case names, the way they're found on the installer discs.
+func newInstallerDir(t *testing.T, skip string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "d2installer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for i, name := range baseMPQs {
+		if name == skip {
+			continue
+		}
+
+		disc := "disc1"
+		if i%2 == 1 {
+			disc = "disc2"
+		}
+
+		writeTestFile(t, filepath.Join(dir, disc, strings.ToUpper(name)), "")
+	}
+
+	return dir
+}
+
+// newManifestSource returns a fake source serving the files in the manifests of the game version and the current patch.
+func newManifestSource(t *testing.T, version map[string]string, current map[string]string) *fakeSource {
+	t.Helper()
+
+	files := make(map[string][]byte)
+
+	for remoteDir, contents := range map[string]map[string]string{defaultGameVersion: version, "current": current} {
+		manifest := Manifest{Files: []PatchFile{}}
+		for name, content := range contents {
+			manifest.Files = append(manifest.Files, PatchFile{Name: name, CRC: crcOf(content), ContentLength: int64(len(content))})
+			files[remoteDir+"/"+name] = []byte(content)
+		}
+
+		bytes, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[remoteDir+"/manifest.json"] = bytes
+	}
+
+	return &fakeSource{files: files}
+}
+
+// waitForPatch follows the patch states until it's done, returning the error if it failed.
+func waitForPatch(t *testing.T, done chan bool, state <-chan PatchState) error {
+	t.Helper()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case s := <-state:
+			if s.Error != nil {
+				return s.Error
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for the patch")
+		}
+	}
+}
+
+func TestBootstrapGame(t *testing.T) {
+	source := newInstallerDir(t, "")
+	target := newTestGame(t, nil)
+
+	s := newTestService(newManifestSource(t,
+		map[string]string{"Game.exe": "game 1.13c", "Patch_D2.mpq": "patch 1.13c"},
+		map[string]string{"Patch_D2.mpq": "patch hiddengamers", "data/items.txt": "items"},
+	))
+
+	conf := &fakeConfig{}
+	s.configService = conf
+
+	done := make(chan bool)
+	_, state := s.BootstrapGame(GameLocation(source), target, done)
+
+	if err := waitForPatch(t, done, state); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The placeholders are in the install, under their lower case names.
+	for _, name := range baseMPQs {
+		info, err := os.Stat(GameFilePath(target, name))
+		if err != nil {
+			t.Fatalf("expected %s in the install: %s", name, err)
+		}
+
+		if info.Size() != 0 {
+			t.Fatalf("expected %s to be the placeholder, got %d bytes", name, info.Size())
+		}
+	}
+
+	// The current patch goes on top of the game version.
+	want := map[string]string{
+		"Game.exe":       "game 1.13c",
+		"Patch_D2.mpq":   "patch hiddengamers",
+		"data/items.txt": "items",
+	}
+
+	for name, content := range want {
+		if got := readTestFile(t, target, name); got != content {
+			t.Fatalf("expected %s to be %q, got %q", name, content, got)
+		}
+	}
+
+	games := conf.conf.Games
+	if len(games) != 1 || games[0].Location != target {
+		t.Fatalf("expected the install to be added as a game, got %+v", games)
+	}
+
+	if games[0].HDVersion != storage.ModVersionNone || games[0].MaphackVersion != storage.ModVersionNone {
+		t.Fatalf("expected the game to have no mods, got %+v", games[0])
+	}
+}
+
+func TestBootstrapGameMissingMPQ(t *testing.T) {
+	source := newInstallerDir(t, "d2xtalk.mpq")
+	target := newTestGame(t, nil)
+
+	s := newTestService(newManifestSource(t, nil, nil))
+
+	conf := &fakeConfig{}
+	s.configService = conf
+
+	done := make(chan bool)
+	_, state := s.BootstrapGame(GameLocation(source), target, done)
+
+	err := waitForPatch(t, done, state)
+	if err == nil || !strings.Contains(err.Error(), "d2xtalk.mpq") {
+		t.Fatalf("expected the missing MPQ to be reported, got %v", err)
+	}
+
+	if len(conf.conf.Games) != 0 {
+		t.Fatalf("expected no game to be added, got %+v", conf.conf.Games)
+	}
+}
+
+func TestBootstrapGameFailedPatch(t *testing.T) {
+	source := newInstallerDir(t, "")
+	target := newTestGame(t, nil)
+
+	manifests := newManifestSource(t, map[string]string{"Game.exe": "game 1.13c"}, nil)
+
+	// The file in the manifest can't be downloaded.
+	delete(manifests.files, defaultGameVersion+"/Game.exe")
+
+	s := newTestService(manifests)
+
+	conf := &fakeConfig{}
+	s.configService = conf
+
+	done := make(chan bool)
+	_, state := s.BootstrapGame(GameLocation(source), target, done)
+
+	if err := waitForPatch(t, done, state); err == nil {
+		t.Fatal("expected the bootstrap to fail")
+	}
+
+	// The broken install isn't left behind.
+	if _, err := os.Stat(LocalPath(target)); !os.IsNotExist(err) {
+		t.Fatalf("expected the install to be removed, got %v", err)
+	}
+
+	if len(conf.conf.Games) != 0 {
+		t.Fatalf("expected no game to be added, got %+v", conf.conf.Games)
+	}
+}
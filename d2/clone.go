@@ -0,0 +1,272 @@
+package d2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// ErrCloneTargetInside is used when cloning an install into a directory of itself.
+var ErrCloneTargetInside = errors.New("no se puede clonar una instalacion dentro de si misma")
+
+// cloneFile is a file of the install being cloned.
+type cloneFile struct {
+	name string
+	info os.FileInfo
+}
+
+// CloneGame will copy the install of the game into the target directory and add it as a new game with
+// the same settings. If the target isn't empty, the install is copied into a directory of it named
+// after the install. MPQs are hardlinked when the filesystem allows it, the game never writes to
+// them and patches replace files instead of changing them, so clones don't affect each other.
+func (s *service) CloneGame(gameID string, target string, done chan bool) (<-chan float32, <-chan PatchState) {
+	// Progress is buffered so the copy can publish without waiting on the UI.
+	progress := make(chan float32, 1)
+	state := make(chan PatchState)
+
+	go func() {
+		game, err := s.getGame(gameID)
+		if err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		target, err = cloneTarget(game.Location, target)
+		if err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		state <- PatchState{Message: fmt.Sprintf("Clonando %s en %s", game.Location, target)}
+
+		if err := s.cloneFiles(game.Location, target, progress); err != nil {
+			// Don't leave half a clone behind, the target was empty to begin with.
+			if cleanErr := os.RemoveAll(localizePath(target)); cleanErr != nil {
+				state <- PatchState{Error: fmt.Errorf("Error de limpieza: %s : %s", err, cleanErr)}
+				return
+			}
+
+			state <- PatchState{Error: err}
+			return
+		}
+
+		// The clone has the same settings, only the location differs.
+		clone := *game
+		clone.Location = target
+
+		if _, err := s.configService.InsertGame(clone); err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		state <- PatchState{Message: fmt.Sprintf("Instalacion clonada en %s", target)}
+
+		done <- true
+	}()
+
+	return progress, state
+}
+
+// cloneTarget returns the location the install is cloned into, it has to be empty.
+func cloneTarget(source string, target string) (string, error) {
+	// Clone into a directory of the target, named after the install.
+	target, err := emptyTarget(target, filepath.Base(localizePath(source)))
+	if err != nil {
+		return "", err
+	}
+
+	if isInside(localizePath(source), localizePath(target)) {
+		return "", ErrCloneTargetInside
+	}
+
+	return target, nil
+}
+
+// isInside returns true if the path is the directory or inside it. Paths on other volumes, such
+// as other drives on Windows, never are, and paths on Windows aren't case sensitive.
+func isInside(dir string, path string) bool {
+	dir = filepath.Clean(dir)
+	path = filepath.Clean(path)
+
+	if runtime.GOOS == "windows" {
+		dir = strings.ToLower(dir)
+		path = strings.ToLower(path)
+	}
+
+	if filepath.VolumeName(dir) != filepath.VolumeName(path) {
+		return false
+	}
+
+	if path == dir {
+		return true
+	}
+
+	// The root of a volume already ends with a separator.
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+
+	return strings.HasPrefix(path, dir)
+}
+
+// emptyTarget returns the location a new install is created in. If the target isn't empty, the
+// install is created in a directory of it with the given name, which has to be empty.
+func emptyTarget(target string, name string) (string, error) {
+	files, err := ioutil.ReadDir(localizePath(target))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if len(files) > 0 {
+		target = fmt.Sprintf("%s/%s", strings.TrimRight(target, "/"), name)
+
+		files, err = ioutil.ReadDir(localizePath(target))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if len(files) > 0 {
+			return "", fmt.Errorf("la carpeta %s no esta vacia", target)
+		}
+	}
+
+	return target, nil
+}
+
+// cloneFiles will copy every file of the install into the target, except for
+// quarantined files and failed downloads.
+func (s *service) cloneFiles(source string, target string, progress chan float32) error {
+	src := localizePath(source)
+	dst := localizePath(target)
+
+	var (
+		files []cloneFile
+		total int64
+	)
+
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		if filepath.ToSlash(name) == quarantineDir {
+			return filepath.SkipDir
+		}
+
+		if name == "." || strings.HasSuffix(name, ".tmp") {
+			return nil
+		}
+
+		files = append(files, cloneFile{name: name, info: info})
+		if !info.IsDir() {
+			total += info.Size()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkCloneSpace(src, dst, files); err != nil {
+		return err
+	}
+
+	counter := NewWriteCounter(total, progress)
+
+	// Reset progress.
+	counter.publish(0)
+
+	if err := os.MkdirAll(dst, storage.Permissions); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		srcPath := filepath.Join(src, f.name)
+		dstPath := filepath.Join(dst, f.name)
+
+		if f.info.IsDir() {
+			if err := os.MkdirAll(dstPath, f.info.Mode().Perm()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Fall back to copying if the filesystem can't link, such as across drives.
+		if isMPQ(f.name) && os.Link(srcPath, dstPath) == nil {
+			counter.add(f.info.Size())
+			continue
+		}
+
+		if err := copyFile(srcPath, dstPath, f.info, counter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkCloneSpace will make sure the target has room for the clone. MPQs only take
+// up space if the target is on another volume, since they're linked otherwise.
+func (s *service) checkCloneSpace(src string, dst string, files []cloneFile) error {
+	linked, err := sameVolume(src, dst)
+	if err != nil {
+		return err
+	}
+
+	var required uint64
+	for _, f := range files {
+		if f.info.IsDir() || (isMPQ(f.name) && linked) {
+			continue
+		}
+
+		required += uint64(f.info.Size())
+	}
+
+	return checkFreeSpace(dst, required)
+}
+
+// copyFile will copy the file, keeping its permissions and modification time so
+// the hash index of the install is still valid for the copy.
+func copyFile(src string, dst string, info os.FileInfo, counter *WriteCounter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, io.TeeReader(in, counter))
+
+	// Close the file before changing its time.
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func isMPQ(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".mpq")
+}
@@ -0,0 +1,171 @@
+package d2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+func TestIsInside(t *testing.T) {
+	tests := []struct {
+		dir  string
+		path string
+		want bool
+	}{
+		{dir: "/games/d2", path: "/games/d2", want: true},
+		{dir: "/games/d2", path: "/games/d2/", want: true},
+		{dir: "/games/d2", path: "/games/d2/clone", want: true},
+		{dir: "/games/d2", path: "/games/d2/a/b", want: true},
+		{dir: "/games/d2", path: "/games/d2/../d2/clone", want: true},
+		{dir: "/games/d2", path: "/games/d2-clone", want: false},
+		{dir: "/games/d2", path: "/games", want: false},
+		{dir: "/games/d2", path: "/other/d2", want: false},
+		{dir: "/games/d2", path: "/games/d2/../clone", want: false},
+		{dir: "/", path: "/games", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir+" "+tt.path, func(t *testing.T) {
+			if got := isInside(filepath.FromSlash(tt.dir), filepath.FromSlash(tt.path)); got != tt.want {
+				t.Fatalf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCloneTarget(t *testing.T) {
+	source := newTestGame(t, map[string]string{"Game.exe": "game"})
+	parent := newTestGame(t, map[string]string{"other.txt": "other"})
+	name := filepath.Base(LocalPath(source))
+
+	tests := []struct {
+		name    string
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty directory", target: parent + "/empty", want: parent + "/empty"},
+		{name: "non-empty directory", target: parent, want: parent + "/" + name},
+		{name: "inside the install", target: source + "/clone", wantErr: true},
+		{name: "the install itself", target: source, wantErr: true},
+	}
+
+	if err := os.Mkdir(GameFilePath(parent, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cloneTarget(source, tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("non-empty subdirectory", func(t *testing.T) {
+		writeTestFile(t, GameFilePath(parent, name+"/Game.exe"), "another game")
+
+		if got, err := cloneTarget(source, parent); err == nil {
+			t.Fatalf("expected an error, got %s", got)
+		}
+	})
+}
+
+func TestCloneGame(t *testing.T) {
+	source := newTestGame(t, map[string]string{
+		"Game.exe":                      "game",
+		"d2data.mpq":                    "data",
+		"data/global/excel/items.txt":   "items",
+		"Patch_D2.mpq.tmp":              "failed download",
+		quarantineDir + "/ESWarden.dll": "rogue",
+	})
+	target := newTestGame(t, nil)
+
+	s := newTestService(&fakeSource{})
+	conf := &fakeConfig{conf: storage.Config{Games: []storage.Game{{ID: "game", Location: source, Instances: 2}}}}
+	s.configService = conf
+
+	done := make(chan bool)
+	_, state := s.CloneGame("game", target, done)
+
+	if err := waitForPatch(t, done, state); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for name, content := range map[string]string{
+		"Game.exe":                    "game",
+		"d2data.mpq":                  "data",
+		"data/global/excel/items.txt": "items",
+	} {
+		if got := readTestFile(t, target, name); got != content {
+			t.Fatalf("expected %s to be %q, got %q", name, content, got)
+		}
+	}
+
+	assertMissing(t, target, "Patch_D2.mpq.tmp")
+	assertMissing(t, target, quarantineDir)
+
+	// MPQs are linked, everything else is copied.
+	for name, linked := range map[string]bool{"d2data.mpq": true, "Game.exe": false} {
+		src, err := os.Stat(GameFilePath(source, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dst, err := os.Stat(GameFilePath(target, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if os.SameFile(src, dst) != linked {
+			t.Fatalf("expected %s linked to be %t", name, linked)
+		}
+	}
+
+	c, _ := conf.Read()
+	if len(c.Games) != 2 || c.Games[1].Location != target || c.Games[1].Instances != 2 {
+		t.Fatalf("expected the clone to be added with the same settings, got %+v", c.Games)
+	}
+}
+
+func TestCloneGameCleansUpFailure(t *testing.T) {
+	source := newTestGame(t, map[string]string{"Game.exe": "game", "d2data.mpq": "data"})
+	parent := newTestGame(t, nil)
+	target := parent + "/clone"
+
+	// A link to nowhere can't be copied, it's the last file so the others are copied first.
+	if err := os.Symlink(GameFilePath(source, "missing"), GameFilePath(source, "zz.txt")); err != nil {
+		t.Skipf("can't create symlinks: %s", err)
+	}
+
+	s := newTestService(&fakeSource{})
+	conf := &fakeConfig{conf: storage.Config{Games: []storage.Game{{ID: "game", Location: source}}}}
+	s.configService = conf
+
+	done := make(chan bool)
+	_, state := s.CloneGame("game", target, done)
+
+	if err := waitForPatch(t, done, state); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assertMissing(t, target, "")
+
+	if c, _ := conf.Read(); len(c.Games) != 1 {
+		t.Fatalf("expected the clone not to be added, got %+v", c.Games)
+	}
+}
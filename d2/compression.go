@@ -0,0 +1,46 @@
+package d2
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported encodings of compressed patch files, variants in any other
+// encoding are ignored and the plain file is downloaded.
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// CompressedFile represents a compressed variant of a patch file.
+type CompressedFile struct {
+	// Name is the name of the compressed file in the remote directory.
+	Name          string `json:"name"`
+	Encoding      string `json:"encoding"`
+	ContentLength int64  `json:"content_length"`
+}
+
+// supported returns true if the launcher knows how to decompress the file.
+func (c *CompressedFile) supported() bool {
+	return c.Encoding == EncodingGzip || c.Encoding == EncodingZstd
+}
+
+// newDecompressor will wrap the reader with a decompressor for the given encoding.
+func newDecompressor(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(r), fmt.Errorf("compresion desconocida: %s", encoding)
+	}
+}
@@ -0,0 +1,167 @@
+package d2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, content string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func zstdCompressed(t *testing.T, content string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDownloadFileCompressed(t *testing.T) {
+	content := "Diablo II 1.13c"
+
+	tests := []struct {
+		name       string
+		compressed *CompressedFile
+		want       string
+	}{
+		{
+			name:       "plain",
+			compressed: nil,
+			want:       "current/Patch_D2.mpq",
+		},
+		{
+			name:       "gzip",
+			compressed: &CompressedFile{Name: "Patch_D2.mpq.gz", Encoding: EncodingGzip},
+			want:       "current/Patch_D2.mpq.gz",
+		},
+		{
+			name:       "zstd",
+			compressed: &CompressedFile{Name: "Patch_D2.mpq.zst", Encoding: EncodingZstd},
+			want:       "current/Patch_D2.mpq.zst",
+		},
+		{
+			name:       "unsupported encoding",
+			compressed: &CompressedFile{Name: "Patch_D2.mpq.br", Encoding: "br"},
+			want:       "current/Patch_D2.mpq",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := newTestGame(t, nil)
+			source := &fakeSource{files: map[string][]byte{
+				"current/Patch_D2.mpq":     []byte(content),
+				"current/Patch_D2.mpq.gz":  gzipped(t, content),
+				"current/Patch_D2.mpq.zst": zstdCompressed(t, content),
+				"current/Patch_D2.mpq.br":  []byte("not brotli"),
+			}}
+
+			s := newTestService(source)
+			file := PatchFile{Name: "Patch_D2.mpq", CRC: crcOf(content), ContentLength: int64(len(content)), Compressed: tt.compressed}
+			counter := NewWriteCounter(file.downloadLength(), make(chan float32, 1))
+
+			if err := s.downloadFile(file, "current", GameFilePath(location, "Patch_D2.mpq"), counter); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got := readTestFile(t, location, "Patch_D2.mpq"); got != content {
+				t.Fatalf("expected %q, got %q", content, got)
+			}
+
+			if len(source.fetched) != 1 || source.fetched[0] != tt.want {
+				t.Fatalf("expected %s to be downloaded, got %v", tt.want, source.fetched)
+			}
+		})
+	}
+}
+
+func TestDownloadFileCompressedCRCMismatch(t *testing.T) {
+	location := newTestGame(t, nil)
+	source := &fakeSource{files: map[string][]byte{
+		"current/Patch_D2.mpq.gz": gzipped(t, "corrupt"),
+	}}
+
+	s := newTestService(source)
+	file := PatchFile{
+		Name:       "Patch_D2.mpq",
+		CRC:        crcOf("Diablo II 1.13c"),
+		Compressed: &CompressedFile{Name: "Patch_D2.mpq.gz", Encoding: EncodingGzip},
+	}
+	counter := NewWriteCounter(file.downloadLength(), make(chan float32, 1))
+
+	err := s.downloadFile(file, "current", GameFilePath(location, "Patch_D2.mpq"), counter)
+	if err == nil || !strings.Contains(err.Error(), "no coincide con el CRC esperado") {
+		t.Fatalf("expected a CRC mismatch, got %v", err)
+	}
+}
+
+func TestDownloadFileCompressedProgress(t *testing.T) {
+	// Repetitive content compresses well, so the sizes differ a lot.
+	content := strings.Repeat("Diablo II 1.13c ", 4096)
+	compressed := gzipped(t, content)
+
+	location := newTestGame(t, nil)
+	source := &fakeSource{files: map[string][]byte{
+		"current/Patch_D2.mpq.gz": compressed,
+	}}
+
+	s := newTestService(source)
+	file := PatchFile{
+		Name:          "Patch_D2.mpq",
+		CRC:           crcOf(content),
+		ContentLength: int64(len(content)),
+		Compressed: &CompressedFile{
+			Name:          "Patch_D2.mpq.gz",
+			Encoding:      EncodingGzip,
+			ContentLength: int64(len(compressed)),
+		},
+	}
+
+	if file.downloadLength() != int64(len(compressed)) {
+		t.Fatalf("expected the download length to be %d, got %d", len(compressed), file.downloadLength())
+	}
+
+	counter := NewWriteCounter(file.downloadLength(), make(chan float32, 1))
+
+	if err := s.downloadFile(file, "current", GameFilePath(location, "Patch_D2.mpq"), counter); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Progress is counted on the bytes transferred, not the bytes written to disk.
+	if counter.Written != int64(len(compressed)) {
+		t.Fatalf("expected %d bytes to be counted, got %d", len(compressed), counter.Written)
+	}
+
+	if got := readTestFile(t, location, "Patch_D2.mpq"); got != content {
+		t.Fatalf("expected the decompressed file to be written, got %d bytes", len(got))
+	}
+}
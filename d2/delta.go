@@ -0,0 +1,97 @@
+package d2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// deltaMagic is the header every delta file starts with.
+var deltaMagic = []byte("HGDELTA1")
+
+// Delta operations.
+const (
+	// deltaOpCopy copies a range of bytes from the base file, followed by
+	// the offset and the length as uvarints.
+	deltaOpCopy = 'C'
+
+	// deltaOpInsert inserts new bytes, followed by the length as
+	// an uvarint and then the bytes themselves.
+	deltaOpInsert = 'I'
+)
+
+var (
+	// ErrDeltaInvalid is used when a delta file isn't in the expected format.
+	ErrDeltaInvalid = errors.New("delta invalido")
+
+	// ErrDeltaMismatch is used when the patched file doesn't have the expected CRC.
+	ErrDeltaMismatch = errors.New("el archivo parcheado con delta no coincide con el CRC esperado")
+)
+
+// patchDelta will reconstruct a file from the base and the delta, writing it to out.
+// A delta is a sequence of copy and insert operations, like xdelta/vcdiff, which means
+// only the changed bytes of a big file have to be downloaded.
+func patchDelta(base io.ReaderAt, delta io.Reader, out io.Writer) error {
+	r := bufio.NewReader(delta)
+
+	// Make sure it's a delta we understand.
+	header := make([]byte, len(deltaMagic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return ErrDeltaInvalid
+	}
+
+	if !bytes.Equal(header, deltaMagic) {
+		return ErrDeltaInvalid
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			// Reached the end of the delta, we're done.
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch op {
+		case deltaOpCopy:
+			offset, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrDeltaInvalid
+			}
+
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrDeltaInvalid
+			}
+
+			section := io.NewSectionReader(base, int64(offset), int64(length))
+			n, err := io.Copy(out, section)
+			if err != nil {
+				return err
+			}
+
+			// The base file was shorter than the delta expected.
+			if n != int64(length) {
+				return ErrDeltaInvalid
+			}
+		case deltaOpInsert:
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrDeltaInvalid
+			}
+
+			if _, err := io.CopyN(out, r, int64(length)); err != nil {
+				if err == io.EOF {
+					return ErrDeltaInvalid
+				}
+				return err
+			}
+		default:
+			return ErrDeltaInvalid
+		}
+	}
+}
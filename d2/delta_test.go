@@ -0,0 +1,238 @@
+package d2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// deltaBuilder writes delta files for tests.
+type deltaBuilder struct {
+	buf bytes.Buffer
+}
+
+func newDeltaBuilder() *deltaBuilder {
+	b := &deltaBuilder{}
+	b.buf.Write(deltaMagic)
+
+	return b
+}
+
+func (b *deltaBuilder) copy(offset uint64, length uint64) *deltaBuilder {
+	b.buf.WriteByte(deltaOpCopy)
+	b.uvarint(offset)
+	b.uvarint(length)
+
+	return b
+}
+
+func (b *deltaBuilder) insert(data string) *deltaBuilder {
+	b.buf.WriteByte(deltaOpInsert)
+	b.uvarint(uint64(len(data)))
+	b.buf.WriteString(data)
+
+	return b
+}
+
+func (b *deltaBuilder) uvarint(v uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	b.buf.Write(tmp[:binary.PutUvarint(tmp, v)])
+}
+
+func (b *deltaBuilder) bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func TestPatchDeltaRoundTrip(t *testing.T) {
+	base := "Diablo II Lord of Destruction"
+
+	tests := []struct {
+		name  string
+		delta *deltaBuilder
+		want  string
+	}{
+		{
+			name:  "empty",
+			delta: newDeltaBuilder(),
+			want:  "",
+		},
+		{
+			name:  "copy whole base",
+			delta: newDeltaBuilder().copy(0, uint64(len(base))),
+			want:  base,
+		},
+		{
+			name:  "insert only",
+			delta: newDeltaBuilder().insert("Slash"),
+			want:  "Slash",
+		},
+		{
+			name: "copy and insert",
+			delta: newDeltaBuilder().
+				copy(0, 10).
+				insert("1.13c ").
+				copy(10, uint64(len(base)-10)).
+				insert("!"),
+			want: "Diablo II 1.13c Lord of Destruction!",
+		},
+		{
+			name:  "copy out of order",
+			delta: newDeltaBuilder().copy(15, 14).insert(" - ").copy(0, 9),
+			want:  "of Destruction - Diablo II",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := patchDelta(strings.NewReader(base), bytes.NewReader(tt.delta.bytes()), &out); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if out.String() != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestPatchDeltaInvalid(t *testing.T) {
+	base := "Diablo II"
+	valid := newDeltaBuilder().copy(0, 6).insert(" III").bytes()
+
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{
+			name:  "empty",
+			delta: nil,
+		},
+		{
+			name:  "truncated header",
+			delta: deltaMagic[:4],
+		},
+		{
+			name:  "wrong header",
+			delta: []byte("HGDELTA2"),
+		},
+		{
+			name:  "truncated copy",
+			delta: newDeltaBuilder().copy(0, 6).bytes()[:len(deltaMagic)+2],
+		},
+		{
+			name:  "truncated insert",
+			delta: valid[:len(valid)-2],
+		},
+		{
+			name:  "insert without length",
+			delta: append(newDeltaBuilder().bytes(), deltaOpInsert),
+		},
+		{
+			name:  "copy beyond base",
+			delta: newDeltaBuilder().copy(4, 100).bytes(),
+		},
+		{
+			name:  "unknown operation",
+			delta: append(newDeltaBuilder().bytes(), 'X'),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := patchDelta(strings.NewReader(base), bytes.NewReader(tt.delta), &out)
+			if !errors.Is(err, ErrDeltaInvalid) {
+				t.Fatalf("expected ErrDeltaInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDoPatchAppliesDelta(t *testing.T) {
+	base := "Diablo II 1.13c"
+	patched := "Diablo II 1.14d"
+
+	location := newTestGame(t, map[string]string{"Game.exe": base})
+	source := &fakeSource{files: map[string][]byte{
+		"current/Game.exe.delta": newDeltaBuilder().copy(0, 10).insert("1.14d").bytes(),
+	}}
+
+	s := newTestService(source)
+
+	action := PatchAction{
+		Action: ActionDownload,
+		File:   PatchFile{Name: "Game.exe", CRC: crcOf(patched), ContentLength: int64(len(patched))},
+		Delta:  &PatchDelta{Name: "Game.exe.delta", BaseCRC: crcOf(base)},
+	}
+
+	if err := s.doPatch([]PatchAction{action}, 10, "current", location, make(chan float32, 1)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := readTestFile(t, location, "Game.exe"); got != patched {
+		t.Fatalf("expected %q, got %q", patched, got)
+	}
+
+	// Only the delta was downloaded.
+	if len(source.fetched) != 1 || source.fetched[0] != "current/Game.exe.delta" {
+		t.Fatalf("expected only the delta to be downloaded, got %v", source.fetched)
+	}
+}
+
+func TestDoPatchFallsBackToFullDownload(t *testing.T) {
+	base := "Diablo II 1.13c"
+	patched := "Diablo II 1.14d"
+
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{
+			name:  "crc mismatch",
+			delta: newDeltaBuilder().copy(0, 10).insert("1.14x").bytes(),
+		},
+		{
+			name:  "truncated delta",
+			delta: newDeltaBuilder().copy(0, 10).insert("1.14d").bytes()[:len(deltaMagic)+5],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := newTestGame(t, map[string]string{"Game.exe": base})
+			source := &fakeSource{files: map[string][]byte{
+				"current/Game.exe.delta": tt.delta,
+				"current/Game.exe":       []byte(patched),
+			}}
+
+			s := newTestService(source)
+
+			action := PatchAction{
+				Action: ActionDownload,
+				File:   PatchFile{Name: "Game.exe", CRC: crcOf(patched), ContentLength: int64(len(patched))},
+				Delta:  &PatchDelta{Name: "Game.exe.delta", BaseCRC: crcOf(base)},
+			}
+
+			if err := s.doPatch([]PatchAction{action}, 10, "current", location, make(chan float32, 1)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got := readTestFile(t, location, "Game.exe"); got != patched {
+				t.Fatalf("expected %q, got %q", patched, got)
+			}
+
+			want := []string{"current/Game.exe.delta", "current/Game.exe"}
+			if strings.Join(source.fetched, ",") != strings.Join(want, ",") {
+				t.Fatalf("expected downloads %v, got %v", want, source.fetched)
+			}
+
+			// The failed delta was logged.
+			if errs := s.logger.(*fakeLogger).errors; len(errs) != 1 {
+				t.Fatalf("expected the failed delta to be logged, got %v", errs)
+			}
+		})
+	}
+}
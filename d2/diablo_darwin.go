@@ -4,18 +4,11 @@ package d2
 
 import (
 	"fmt"
+	"syscall"
 )
 
-const (
-	// ModMaphackIdentifier is the identifier we use to look for installs of maphack.
-	ModMaphackIdentifier = "BH.dll"
-
-	// ModHDIdentifier is the identifier we use to look for installs of hd mod.
-	ModHDIdentifier = "D2HD.dll"
-)
-
-// validate113cVersion will check the given installations Diablo II version.
-func validate113cVersion(dir string) (bool, error) {
+// validateGameVersion will check if the given installation is the given Diablo II version.
+func validateGameVersion(dir string, version string) (bool, error) {
 	return true, nil
 }
 
@@ -73,3 +66,18 @@ func isModInstalled(path string, identifier string, manifest *Manifest) (bool, e
 
 	return false, nil
 }
+
+// GameLocation returns the game location of the directory on disk, the way it's stored in the config.
+func GameLocation(dir string) string {
+	return dir
+}
+
+// volumeSpace returns the filesystem of the path and the bytes free on it.
+func volumeSpace(path string) (string, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", 0, err
+	}
+
+	return fmt.Sprint(stat.Fsid), stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -10,32 +10,15 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"unicode/utf8"
 
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 )
 
-// SHA1 of the different versions of Diablo Game.exe.
-var hashList = map[string]string{
-	"a875b98fa3a8b9300bcc04c84be1fa057eb277b5": "1.12",
-	"af2b33c90b50ede8d9a8bca9b8d9720c87f78641": "1.13c",
-	"27ddadbc457affed122564ae7a4bd2223181e15a": "1.13c", // Custom 1.13c build with HD icon.
-	"11cd918cb6906295769d9be1b3e349e02af6b229": "1.13d",
-	"3e64f12c6ef72847f49d301c2472280d4460589d": "1.14a",
-	"11e940266c6838414c2114c2172227f982d4054e": "1.14b",
-	"928cb9daedc562e04a18cd62acd71c346247e260": "1.14b", // 1.14b personalizado para hiddengamers d2
-	"255691dd53e3bcd646e5c6e1e2e7b16da745b706": "1.14c",
-	"af0ea93d2a652ceb11ac01ee2e4ae1ef613444c2": "1.14d",
-}
-
 const (
-	// ModMaphackIdentifier is the identifier we use to look for installs of maphack.
-	ModMaphackIdentifier = "BH.dll"
-
-	// ModHDIdentifier is the identifier we use to look for installs of hd mod.
-	ModHDIdentifier = "D2HD.dll"
-
 	// RegistryLayers is where all data about execution resides, like DEP.
 	RegistryLayers = `Software\Microsoft\Windows NT\CurrentVersion\AppCompatFlags\Layers`
 
@@ -43,8 +26,8 @@ const (
 	RegistryPermissions = registry.QUERY_VALUE | registry.SET_VALUE
 )
 
-// validate113cVersion will check the given installations Diablo II version.
-func validate113cVersion(path string) (bool, error) {
+// validateGameVersion will check if the given installation is the given Diablo II version.
+func validateGameVersion(path string, version string) (bool, error) {
 	// Open local Game.exe.
 	content, err := ioutil.ReadFile(localizePath(path) + "\\Game.exe")
 	if err != nil {
@@ -58,14 +41,14 @@ func validate113cVersion(path string) (bool, error) {
 	hashed := fmt.Sprintf("%x", sha1.Sum(content))
 
 	// Check the game version.
-	version, ok := hashList[hashed]
+	installed, ok := hashList[hashed]
 
 	// Unknown game version.
 	if !ok {
 		return false, nil
 	}
 
-	return version == "1.13c", nil
+	return installed == version, nil
 }
 
 // launch will execute the Diablo II.exe in the given directory.
@@ -199,3 +182,23 @@ func localizePath(path string) string {
 
 	return reversed[i:]
 }
+
+// GameLocation returns the game location of the directory on disk, the way it's stored in the config.
+func GameLocation(dir string) string {
+	return "/" + filepath.ToSlash(dir)
+}
+
+// volumeSpace returns the volume of the path and the bytes free on it.
+func volumeSpace(path string) (string, uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &free, nil, nil); err != nil {
+		return "", 0, err
+	}
+
+	return strings.ToLower(filepath.VolumeName(path)), free, nil
+}
@@ -0,0 +1,354 @@
+package d2
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// diskSpaceMargin is kept free on top of what the patch needs, the game and the OS need some room too.
+const diskSpaceMargin = 50 * 1024 * 1024
+
+// diskSpace returns the volume of the path and the bytes free on it, tests replace it.
+var diskSpace = volumeSpace
+
+// volumeUsage is the space needed by the installs on the same volume, they're patched one after the other.
+type volumeUsage struct {
+	locations []string
+	size      patchSize
+	free      uint64
+}
+
+// patchSize follows the space needed while files are patched batch by batch. The files of a
+// batch are written next to the ones they replace, which are only gone once the batch is done.
+type patchSize struct {
+	// grown is what the batches so far have added, peak is the most needed at any time.
+	grown int64
+	peak  int64
+}
+
+// addBatch will add a batch that writes the given bytes and then replaces the given bytes.
+func (p *patchSize) addBatch(written int64, replaced int64) {
+	if p.grown+written > p.peak {
+		p.peak = p.grown + written
+	}
+
+	p.grown += written - replaced
+}
+
+// add will add the whole patch of another install after this one.
+func (p *patchSize) add(other patchSize) {
+	p.addBatch(other.peak, other.peak-other.grown)
+}
+
+// required returns the bytes that have to be free before patching.
+func (p *patchSize) required() uint64 {
+	return uint64(p.peak)
+}
+
+// checkDiskSpace will make sure every install has enough free space to be patched before
+// downloading anything. Installs on the same volume share the free space.
+func (s *service) checkDiskSpace(games []storage.Game, mods *config.GameMods, modManifests map[string]*Manifest) error {
+	_, versionManifest, err := s.getVersionManifest()
+	if err != nil {
+		return err
+	}
+
+	slashManifest, err := s.getManifest("current/manifest.json")
+	if err != nil {
+		return err
+	}
+
+	var (
+		volumes []string
+		usage   = make(map[string]*volumeUsage)
+	)
+
+	for i := range games {
+		game := &games[i]
+
+		size, err := s.getPatchSize(game, mods, []*Manifest{versionManifest, slashManifest}, modManifests)
+		if err != nil {
+			return err
+		}
+
+		volume, free, err := diskSpace(localizePath(game.Location))
+		if err != nil {
+			return err
+		}
+
+		u, ok := usage[volume]
+		if !ok {
+			u = &volumeUsage{free: free}
+			usage[volume] = u
+			volumes = append(volumes, volume)
+		}
+
+		u.locations = append(u.locations, game.Location)
+		u.size.add(size)
+	}
+
+	var errs []string
+	for _, volume := range volumes {
+		u := usage[volume]
+		required := u.size.required()
+		if required == 0 || required+diskSpaceMargin <= u.free {
+			continue
+		}
+
+		errs = append(errs, notEnoughSpace(strings.Join(u.locations, ", "), required+diskSpaceMargin, u.free))
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// getPatchSize returns the space needed by the install while patching it, in the same order it's patched.
+func (s *service) getPatchSize(game *storage.Game, mods *config.GameMods, manifests []*Manifest, modManifests map[string]*Manifest) (patchSize, error) {
+	var size patchSize
+
+	for _, m := range manifests {
+		actions, _, err := s.getFilesToPatch(m.Files, game.Location, patchProtectedPatterns(game))
+		if err != nil {
+			return size, err
+		}
+
+		if err := s.addActionsSize(&size, game.Location, actions); err != nil {
+			return size, err
+		}
+	}
+
+	for _, mod := range mods.All() {
+		version := game.ModVersion(mod.Name)
+		if !config.ModEnabled(version) {
+			continue
+		}
+
+		manifest, err := s.getModManifest(mod, version, modManifests)
+		if err != nil {
+			return size, err
+		}
+
+		files := modFiles(mod, manifest.Files)
+
+		actions, _, err := s.getFilesToPatch(files, game.Location, modProtectedFiles(game, mod))
+		if err != nil {
+			return size, err
+		}
+
+		if err := s.addActionsSize(&size, game.Location, actions); err != nil {
+			return size, err
+		}
+
+		// The merge files that haven't been merged before get a pristine copy of the local file.
+		var backups int64
+		for _, f := range files {
+			if f.Deprecated || !isProtected(f.Name, mod.Merge) {
+				continue
+			}
+
+			pristine, err := fileSize(pristinePath(game.Location, f.Name))
+			if err != nil {
+				return size, err
+			}
+
+			if pristine > 0 {
+				continue
+			}
+
+			local, err := fileSize(GameFilePath(game.Location, f.Name))
+			if err != nil {
+				return size, err
+			}
+
+			backups += local
+		}
+
+		size.addBatch(backups, 0)
+
+		merges, err := s.getMergeActions(game, mod, files)
+		if err != nil {
+			return size, err
+		}
+
+		if err := s.addActionsSize(&size, game.Location, merges); err != nil {
+			return size, err
+		}
+	}
+
+	return size, nil
+}
+
+// getRepairSize returns the space needed by the install while repairing it, the downloads
+// grouped by remote directory and then the packages installed from their archives again.
+func (s *service) getRepairSize(location string, actions [][]PatchAction, packages []*storage.Package) (patchSize, error) {
+	var size patchSize
+
+	for _, batch := range actions {
+		if err := s.addActionsSize(&size, location, batch); err != nil {
+			return size, err
+		}
+	}
+
+	for _, pkg := range packages {
+		written, replaced, err := packageSize(location, pkg.Source)
+		if err != nil {
+			return size, err
+		}
+
+		size.addBatch(written, replaced)
+	}
+
+	return size, nil
+}
+
+// addActionsSize will add the actions, patched as a single batch, to the size.
+func (s *service) addActionsSize(size *patchSize, location string, actions []PatchAction) error {
+	var written, replaced int64
+
+	for _, a := range actions {
+		if a.Action != ActionDownload && a.Action != ActionMerge && a.Action != ActionDelete {
+			continue
+		}
+
+		filePath, err := gameFile(location, a.File.Name)
+		if err != nil {
+			return err
+		}
+
+		existing, err := fileSize(filePath)
+		if err != nil {
+			return err
+		}
+
+		replaced += existing
+
+		switch a.Action {
+		case ActionDownload:
+			// Compressed files are transferred compressed, but the .tmp file is the whole file.
+			written += a.File.ContentLength
+		case ActionMerge:
+			// The upstream copy replaces the pristine copy, the merged file replaces the
+			// local one, and upstream is also kept next to it when the merge conflicts.
+			pristine, err := fileSize(pristinePath(location, a.File.Name))
+			if err != nil {
+				return err
+			}
+
+			written += 3 * a.File.ContentLength
+			replaced += pristine
+		}
+	}
+
+	size.addBatch(written, replaced)
+
+	return nil
+}
+
+// packageSize returns the bytes extracted from the package archive and the bytes of the files they replace,
+// an archive that can't be read is left for the install to fail on.
+func packageSize(location string, archive string) (int64, int64, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return 0, 0, nil
+	}
+
+	defer r.Close()
+
+	manifest, files, err := readPackage(&r.Reader)
+	if err != nil {
+		return 0, 0, nil
+	}
+
+	var written, replaced int64
+	for _, f := range manifest.Files {
+		written += int64(files[f.Name].UncompressedSize64)
+
+		filePath, err := gameFile(location, f.Name)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		existing, err := fileSize(filePath)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		replaced += existing
+	}
+
+	return written, replaced, nil
+}
+
+// fileSize returns the size of the file on disk, 0 if it doesn't exist.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// checkFreeSpace will make sure there's room for the given bytes in the directory,
+// the directory might not exist yet.
+func checkFreeSpace(dir string, required uint64) error {
+	_, free, err := diskSpace(existingDir(dir))
+	if err != nil {
+		return err
+	}
+
+	if required+diskSpaceMargin > free {
+		return errors.New(notEnoughSpace(dir, required+diskSpaceMargin, free))
+	}
+
+	return nil
+}
+
+// sameVolume returns true if both directories are on the same volume, the second one might not exist yet.
+func sameVolume(a string, b string) (bool, error) {
+	volumeA, _, err := diskSpace(existingDir(a))
+	if err != nil {
+		return false, err
+	}
+
+	volumeB, _, err := diskSpace(existingDir(b))
+	if err != nil {
+		return false, err
+	}
+
+	return volumeA == volumeB, nil
+}
+
+// existingDir returns the closest directory to dir that exists, itself included.
+func existingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+
+		dir = filepath.Dir(dir)
+	}
+}
+
+func notEnoughSpace(where string, required uint64, free uint64) string {
+	return fmt.Sprintf("no hay espacio suficiente en %s: se necesitan %s y hay %s libres", where, formatBytes(required), formatBytes(free))
+}
+
+// formatBytes returns the size in megabytes, the way it's shown to the user.
+func formatBytes(size uint64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+}
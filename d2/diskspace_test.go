@@ -0,0 +1,249 @@
+package d2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// stubDiskSpace will replace the disk space of the volumes until the test is done,
+// paths are on the volume of the longest location they start with.
+func stubDiskSpace(t *testing.T, volumes map[string]string, free map[string]uint64) {
+	t.Helper()
+
+	original := diskSpace
+	t.Cleanup(func() { diskSpace = original })
+
+	diskSpace = func(path string) (string, uint64, error) {
+		var location string
+		for l := range volumes {
+			if strings.HasPrefix(path, LocalPath(l)) && len(l) > len(location) {
+				location = l
+			}
+		}
+
+		if location == "" {
+			return "", 0, fmt.Errorf("unknown volume for %s", path)
+		}
+
+		volume := volumes[location]
+		return volume, free[volume], nil
+	}
+}
+
+func TestPatchSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches [][2]int64
+		peak    int64
+		grown   int64
+	}{
+		{name: "nothing", batches: nil, peak: 0, grown: 0},
+		{name: "new files", batches: [][2]int64{{100, 0}, {50, 0}}, peak: 150, grown: 150},
+		{name: "replaced files", batches: [][2]int64{{100, 100}, {50, 50}}, peak: 100, grown: 0},
+		{name: "smaller files", batches: [][2]int64{{10, 100}, {50, 0}}, peak: 10, grown: -40},
+		{name: "bigger files", batches: [][2]int64{{100, 10}, {50, 50}}, peak: 140, grown: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var size patchSize
+			for _, b := range tt.batches {
+				size.addBatch(b[0], b[1])
+			}
+
+			if size.peak != tt.peak || size.grown != tt.grown {
+				t.Fatalf("expected peak %d and grown %d, got %+v", tt.peak, tt.grown, size)
+			}
+		})
+	}
+}
+
+func TestPatchSizeAdd(t *testing.T) {
+	var first, second patchSize
+	first.addBatch(100, 10)
+	second.addBatch(50, 0)
+	second.addBatch(20, 60)
+
+	// The second install is patched after the first one is done.
+	first.add(second)
+
+	if first.peak != 160 || first.grown != 100 {
+		t.Fatalf("expected peak 160 and grown 100, got %+v", first)
+	}
+}
+
+func TestGetPatchSize(t *testing.T) {
+	location := newTestGame(t, map[string]string{"Patch_D2.mpq": "old patch"})
+	game := &storage.Game{ID: "game", Location: location}
+
+	s := newTestService(&fakeSource{})
+
+	manifests := []*Manifest{
+		{Files: []PatchFile{{
+			Name:          "Patch_D2.mpq",
+			CRC:           crcOf("new patch"),
+			ContentLength: 1000,
+			Compressed:    &CompressedFile{Name: "Patch_D2.mpq.gz", Encoding: EncodingGzip, ContentLength: 10},
+		}}},
+		{Files: []PatchFile{{Name: "data/items.txt", CRC: crcOf("items"), ContentLength: 200}}},
+	}
+
+	size, err := s.getPatchSize(game, &config.GameMods{}, manifests, make(map[string]*Manifest))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The whole decompressed file is written next to the old one, which is then replaced.
+	if want := int64(1000 + 200 - len("old patch")); size.peak != want {
+		t.Fatalf("expected %d bytes to be needed, got %d", want, size.peak)
+	}
+}
+
+func TestGetRepairSize(t *testing.T) {
+	location := newTestGame(t, map[string]string{"Patch_D2.mpq": "old patch"})
+	archive := newTestPackage(t, "hd", map[string]string{
+		"Patch_D2.mpq": "hd patch",
+		"data/hd.txt":  "hd settings",
+	})
+
+	s := newTestService(&fakeSource{})
+
+	actions := [][]PatchAction{
+		{{Action: ActionDownload, File: PatchFile{Name: "Game.exe", ContentLength: 100}}},
+	}
+
+	packages := []*storage.Package{
+		{Name: "hd", Source: archive},
+		{Name: "missing", Source: filepath.Join(LocalPath(location), "missing.zip")},
+	}
+
+	size, err := s.getRepairSize(location, actions, packages)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The package is extracted next to the files it replaces.
+	if want := int64(100 + len("hd patch") + len("hd settings")); size.peak != want {
+		t.Fatalf("expected %d bytes to be needed, got %d", want, size.peak)
+	}
+
+	if want := int64(100 + len("hd patch") + len("hd settings") - len("old patch")); size.grown != want {
+		t.Fatalf("expected the install to grow %d bytes, got %d", want, size.grown)
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	first := newTestGame(t, nil)
+	second := newTestGame(t, nil)
+	other := newTestGame(t, nil)
+
+	games := []storage.Game{
+		{ID: "first", Location: first},
+		{ID: "second", Location: second},
+		{ID: "other", Location: other},
+	}
+
+	volumes := map[string]string{first: "c", second: "c", other: "d"}
+
+	// Every install needs 1000 bytes.
+	content := strings.Repeat("x", 1000)
+
+	tests := []struct {
+		name   string
+		free   map[string]uint64
+		failed []string
+	}{
+		{
+			name: "enough space",
+			free: map[string]uint64{"c": diskSpaceMargin + 2000, "d": diskSpaceMargin + 1000},
+		},
+		{
+			name:   "installs share the volume",
+			free:   map[string]uint64{"c": diskSpaceMargin + 1500, "d": diskSpaceMargin + 1000},
+			failed: []string{first, second},
+		},
+		{
+			name:   "every volume is checked",
+			free:   map[string]uint64{"c": diskSpaceMargin + 2000, "d": diskSpaceMargin},
+			failed: []string{other},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubDiskSpace(t, volumes, tt.free)
+
+			s := newTestService(newManifestSource(t, map[string]string{"Patch_D2.mpq": content}, nil))
+
+			err := s.checkDiskSpace(games, &config.GameMods{}, make(map[string]*Manifest))
+			if len(tt.failed) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			for _, g := range games {
+				failed := false
+				for _, location := range tt.failed {
+					failed = failed || location == g.Location
+				}
+
+				if strings.Contains(err.Error(), g.Location) != failed {
+					t.Fatalf("expected %s in the error to be %t, got %s", g.Location, failed, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDiskSpaceNothingToPatch(t *testing.T) {
+	location := newTestGame(t, map[string]string{"Patch_D2.mpq": "patch"})
+	stubDiskSpace(t, map[string]string{location: "c"}, map[string]uint64{"c": 0})
+
+	s := newTestService(newManifestSource(t, map[string]string{"Patch_D2.mpq": "patch"}, nil))
+
+	// An install that's up to date doesn't need any room.
+	err := s.checkDiskSpace([]storage.Game{{ID: "game", Location: location}}, &config.GameMods{}, make(map[string]*Manifest))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestExistingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "d2existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{dir: dir, want: dir},
+		{dir: filepath.Join(dir, "Diablo II"), want: dir},
+		{dir: filepath.Join(dir, "Games", "Diablo II"), want: dir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			if got := existingDir(tt.dir); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
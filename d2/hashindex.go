@@ -0,0 +1,235 @@
+package d2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// hashIndexFile is where the hash index of an install is kept, in the game directory.
+const hashIndexFile = ".hiddengamers/hashes.json"
+
+// hashWorkers is the number of files hashed at the same time.
+const hashWorkers = 4
+
+// hashEntry is the checksum of a file, along with the size and modification
+// time of the file when it was hashed.
+type hashEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	CRC     string    `json:"crc"`
+}
+
+// hashIndex is a persistent index of the checksums of the files in an install, files
+// that haven't changed since they were last hashed aren't hashed again.
+type hashIndex struct {
+	location string
+	entries  map[string]hashEntry
+	mux      sync.Mutex
+	dirty    bool
+
+	// Number of lookups served from the index, and the ones that needed hashing.
+	hits   int
+	misses int
+}
+
+// loadHashIndex will load the hash index of the install, a missing or
+// unreadable index is simply started over.
+func loadHashIndex(location string) *hashIndex {
+	index := &hashIndex{
+		location: location,
+		entries:  make(map[string]hashEntry),
+	}
+
+	contents, err := ioutil.ReadFile(GameFilePath(location, hashIndexFile))
+	if err != nil {
+		return index
+	}
+
+	if err := json.Unmarshal(contents, &index.entries); err != nil {
+		index.entries = make(map[string]hashEntry)
+	}
+
+	return index
+}
+
+// hash returns the checksum of the file in the install, only hashing it if
+// its size or modification time has changed since it was last hashed.
+func (i *hashIndex) hash(name string) (string, error) {
+	return i.lookup(name, false)
+}
+
+// lookup returns the checksum of the file, force hashes it even if it seems unchanged.
+func (i *hashIndex) lookup(name string, force bool) (string, error) {
+	filePath := GameFilePath(i.location, name)
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrCRCFileNotFound
+		}
+
+		return "", err
+	}
+
+	i.mux.Lock()
+	entry, ok := i.entries[name]
+	if ok && !force && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		i.hits++
+		i.mux.Unlock()
+		return entry.CRC, nil
+	}
+	i.misses++
+	i.mux.Unlock()
+
+	hashed, err := hashCRC32(filePath, polynomial)
+	if err != nil {
+		return "", err
+	}
+
+	i.mux.Lock()
+	i.entries[name] = hashEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		CRC:     hashed,
+	}
+	i.dirty = true
+	i.mux.Unlock()
+
+	return hashed, nil
+}
+
+// save will write the index to the install, if anything has changed.
+func (i *hashIndex) save() error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	if !i.dirty {
+		return nil
+	}
+
+	// Forget the files that have been removed since they were hashed.
+	for name := range i.entries {
+		if _, err := os.Stat(GameFilePath(i.location, name)); os.IsNotExist(err) {
+			delete(i.entries, name)
+		}
+	}
+
+	contents, err := json.Marshal(i.entries)
+	if err != nil {
+		return err
+	}
+
+	path := GameFilePath(i.location, hashIndexFile)
+	if err := os.MkdirAll(filepath.Dir(path), storage.Permissions); err != nil {
+		return err
+	}
+
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+	if err := ioutil.WriteFile(tmpPath, contents, storage.Permissions); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	i.dirty = false
+
+	return nil
+}
+
+// hashGameFile returns the checksum of the file in the install, using the hash index of the install.
+func (s *service) hashGameFile(location string, name string) (string, error) {
+	return s.hashIndexFor(location).hash(name)
+}
+
+// hashIndexFor returns the hash index of the install, loading it the first time.
+func (s *service) hashIndexFor(location string) *hashIndex {
+	s.hashMux.Lock()
+	defer s.hashMux.Unlock()
+
+	index, ok := s.hashIndexes[location]
+	if !ok {
+		index = loadHashIndex(location)
+		s.hashIndexes[location] = index
+	}
+
+	return index
+}
+
+// gameFiles is a set of files in an install.
+type gameFiles struct {
+	location string
+	names    []string
+}
+
+// prehash will hash the files of every install in parallel, so the checks that follow
+// are served from the hash indexes. Errors are left for those checks to report.
+// Forcing it hashes every file, even the ones that seem unchanged.
+func (s *service) prehash(installs []gameFiles, force bool) {
+	type job struct {
+		index *hashIndex
+		name  string
+	}
+
+	jobs := make(chan job)
+
+	var wg sync.WaitGroup
+	for w := 0; w < hashWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.index.lookup(j.name, force)
+			}
+		}()
+	}
+
+	for _, install := range installs {
+		index := s.hashIndexFor(install.location)
+		for _, name := range install.names {
+			jobs <- job{index: index, name: name}
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+// saveHashIndexes will persist the hash index of every install that has been hashed.
+func (s *service) saveHashIndexes() {
+	s.hashMux.Lock()
+	defer s.hashMux.Unlock()
+
+	for _, index := range s.hashIndexes {
+		if err := index.save(); err != nil {
+			s.logger.Error(fmt.Errorf("no se pudo guardar el indice de hashes de %s: %s", index.location, err))
+			continue
+		}
+
+		index.mux.Lock()
+		s.logger.Debug(fmt.Sprintf("hash index %s: %d hits, %d misses", index.location, index.hits, index.misses))
+		index.hits, index.misses = 0, 0
+		index.mux.Unlock()
+	}
+}
+
+// patchFileNames returns the names of the files in the lists.
+func patchFileNames(files ...[]PatchFile) []string {
+	var names []string
+	for _, list := range files {
+		for _, f := range list {
+			names = append(names, f.Name)
+		}
+	}
+
+	return names
+}
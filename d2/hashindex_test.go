@@ -0,0 +1,101 @@
+package d2
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// hashStats returns the hits and misses of the hash index of the install.
+func hashStats(s *service, location string) (int, int) {
+	index := s.hashIndexFor(location)
+
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	return index.hits, index.misses
+}
+
+func TestPrehash(t *testing.T) {
+	files := map[string]string{
+		"Game.exe":       "game",
+		"Patch_D2.mpq":   "patch",
+		"data/items.txt": "items",
+	}
+
+	location := newTestGame(t, files)
+	install := []gameFiles{{location: location, names: []string{"Game.exe", "Patch_D2.mpq", "data/items.txt", "missing.txt"}}}
+
+	s := newTestService(&fakeSource{})
+
+	// Nothing has been hashed yet.
+	s.prehash(install, false)
+	if hits, misses := hashStats(s, location); hits != 0 || misses != 3 {
+		t.Fatalf("expected 0 hits and 3 misses, got %d hits and %d misses", hits, misses)
+	}
+
+	// Unchanged files are served from the index.
+	s.prehash(install, false)
+	if hits, misses := hashStats(s, location); hits != 3 || misses != 3 {
+		t.Fatalf("expected 3 hits and 3 misses, got %d hits and %d misses", hits, misses)
+	}
+
+	for name, content := range files {
+		hashed, err := s.hashGameFile(location, name)
+		if err != nil {
+			t.Fatalf("unexpected error hashing %s: %s", name, err)
+		}
+
+		if hashed != crcOf(content) {
+			t.Fatalf("expected %s to hash to %s, got %s", name, crcOf(content), hashed)
+		}
+	}
+
+	// Change a file without changing its size, only the modification time gives it away.
+	writeTestFile(t, GameFilePath(location, "Game.exe"), "GAME")
+	touched := time.Now().Add(time.Hour)
+	if err := os.Chtimes(GameFilePath(location, "Game.exe"), touched, touched); err != nil {
+		t.Fatal(err)
+	}
+
+	s.prehash(install, false)
+	if hits, misses := hashStats(s, location); hits != 8 || misses != 4 {
+		t.Fatalf("expected 8 hits and 4 misses, got %d hits and %d misses", hits, misses)
+	}
+
+	hashed, err := s.hashGameFile(location, "Game.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hashed != crcOf("GAME") {
+		t.Fatalf("expected the changed file to be hashed again, got %s", hashed)
+	}
+
+	// Forcing it hashes every file.
+	s.prehash(install, true)
+	if hits, misses := hashStats(s, location); hits != 9 || misses != 7 {
+		t.Fatalf("expected 9 hits and 7 misses, got %d hits and %d misses", hits, misses)
+	}
+
+	if _, err := s.hashGameFile(location, "missing.txt"); err != ErrCRCFileNotFound {
+		t.Fatalf("expected ErrCRCFileNotFound, got %v", err)
+	}
+}
+
+func TestHashIndexPersists(t *testing.T) {
+	location := newTestGame(t, map[string]string{"Game.exe": "game"})
+	install := []gameFiles{{location: location, names: []string{"Game.exe"}}}
+
+	s := newTestService(&fakeSource{})
+	s.prehash(install, false)
+	s.saveHashIndexes()
+
+	// A new launcher run loads the index from the install.
+	s = newTestService(&fakeSource{})
+	s.prehash(install, false)
+
+	if hits, misses := hashStats(s, location); hits != 1 || misses != 0 {
+		t.Fatalf("expected 1 hit and 0 misses, got %d hits and %d misses", hits, misses)
+	}
+}
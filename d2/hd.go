@@ -0,0 +1,127 @@
+package d2
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/ini"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// The HD mod reads its settings from the settings section of D2HD.ini.
+const (
+	hdSettingsFile    = "D2HD.ini"
+	hdSettingsSection = "Settings"
+	hdKeyResolution   = "Resolution"
+	hdKeyFullscreen   = "Fullscreen"
+)
+
+// hdSettingsKeys are the keys managed by the launcher, in the order they're added to the file.
+var hdSettingsKeys = []string{hdKeyResolution, hdKeyFullscreen}
+
+// hdSettingsValues returns the keys and values the settings are written as.
+func hdSettingsValues(settings *storage.HDSettings) map[string]string {
+	values := map[string]string{
+		hdKeyFullscreen: "0",
+	}
+
+	if settings.Fullscreen {
+		values[hdKeyFullscreen] = "1"
+	}
+
+	// An empty resolution keeps the one the mod ships with.
+	if settings.Resolution != "" {
+		values[hdKeyResolution] = settings.Resolution
+	}
+
+	return values
+}
+
+// readHDSettings will read the HD settings file of the game, an empty file is returned if it doesn't exist.
+func readHDSettings(location string) (*ini.File, error) {
+	contents, err := ioutil.ReadFile(GameFilePath(location, hdSettingsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return ini.Parse(bytes.NewReader(contents))
+}
+
+// hdSettingsOutdated returns true if the HD settings chosen by the user haven't been written to the game.
+func hdSettingsOutdated(game *storage.Game) (bool, error) {
+	if game.HDSettings == nil || !config.ModEnabled(game.HDVersion) {
+		return false, nil
+	}
+
+	f, err := readHDSettings(game.Location)
+	if err != nil {
+		return false, err
+	}
+
+	values := hdSettingsValues(game.HDSettings)
+	for _, key := range hdSettingsKeys {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+
+		if current, found := f.Get(hdSettingsSection, key); !found || current != value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// validateHDSettings will add the HD settings file to the model if it needs to be written.
+func (s *service) validateHDSettings(game *storage.Game) (bool, error) {
+	outdated, err := hdSettingsOutdated(game)
+	if err != nil || !outdated {
+		return true, err
+	}
+
+	s.addFilesToModel([]PatchAction{{
+		Action: ActionSettings,
+		File:   PatchFile{Name: hdSettingsFile},
+		D2Path: game.Location,
+	}})
+
+	return false, nil
+}
+
+// applyHDSettings will write the HD settings chosen by the user to the game, keeping
+// any other settings in the file as they are.
+func (s *service) applyHDSettings(game *storage.Game, state chan PatchState) error {
+	outdated, err := hdSettingsOutdated(game)
+	if err != nil || !outdated {
+		return err
+	}
+
+	// Update UI.
+	state <- PatchState{Message: fmt.Sprintf("Aplicando los ajustes HD en %s", game.Location)}
+
+	f, err := readHDSettings(game.Location)
+	if err != nil {
+		return err
+	}
+
+	values := hdSettingsValues(game.HDSettings)
+	for _, key := range hdSettingsKeys {
+		if value, ok := values[key]; ok {
+			f.Set(hdSettingsSection, key, value)
+		}
+	}
+
+	path := GameFilePath(game.Location, hdSettingsFile)
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+
+	if err := ioutil.WriteFile(tmpPath, f.Bytes(), storage.Permissions); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
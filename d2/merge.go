@@ -0,0 +1,199 @@
+package d2
+
+import (
+	"strings"
+)
+
+// Conflict markers written around changes that couldn't be merged.
+const (
+	conflictLocal    = "<<<<<<< local"
+	conflictSplit    = "======="
+	conflictUpstream = ">>>>>>> upstream"
+)
+
+// mergeResult is the result of a three-way merge.
+type mergeResult struct {
+	Content   string
+	Conflicts int
+}
+
+// merge3 will merge the upstream changes made since base into local, line by line.
+// Changes made to the same lines on both sides are conflicts, they are either written
+// with conflict markers or, if preferLocal is set, resolved by keeping the local lines.
+func merge3(base, local, upstream string, preferLocal bool) mergeResult {
+	b := splitLines(base)
+	l := splitLines(local)
+	u := splitLines(upstream)
+
+	// Lines of the base matched in the local and upstream versions.
+	localMatch := matchLines(b, l)
+	upstreamMatch := matchLines(b, u)
+
+	eol := "\n"
+	if strings.Contains(local, "\r\n") {
+		eol = "\r\n"
+	}
+
+	var (
+		out       []string
+		conflicts int
+		i, x, y   int
+	)
+
+	for {
+		// Find the next base line that is unchanged on both sides.
+		k := i
+		for k < len(b) && (localMatch[k] < 0 || upstreamMatch[k] < 0) {
+			k++
+		}
+
+		// The chunk in between has been changed on at least one side.
+		bEnd, lEnd, uEnd := len(b), len(l), len(u)
+		if k < len(b) {
+			bEnd, lEnd, uEnd = k, localMatch[k], upstreamMatch[k]
+		}
+
+		merged, conflict := mergeChunk(b[i:bEnd], l[x:lEnd], u[y:uEnd], preferLocal, eol)
+		out = append(out, merged...)
+		if conflict {
+			conflicts++
+		}
+
+		// Reached the end of every version.
+		if k >= len(b) {
+			break
+		}
+
+		// Stable line, it's the same in every version.
+		out = append(out, b[k])
+		i, x, y = k+1, lEnd+1, uEnd+1
+	}
+
+	return mergeResult{
+		Content:   strings.Join(out, ""),
+		Conflicts: conflicts,
+	}
+}
+
+// mergeChunk resolves a chunk of lines changed on at least one side.
+func mergeChunk(base, local, upstream []string, preferLocal bool, eol string) ([]string, bool) {
+	switch {
+	case equalLines(local, base):
+		// Only changed upstream.
+		return upstream, false
+	case equalLines(upstream, base), equalLines(local, upstream):
+		// Only changed locally, or changed the same way on both sides.
+		return local, false
+	case preferLocal:
+		return local, true
+	}
+
+	out := []string{conflictLocal + eol}
+	out = append(out, terminated(local, eol)...)
+	out = append(out, conflictSplit+eol)
+	out = append(out, terminated(upstream, eol)...)
+	out = append(out, conflictUpstream+eol)
+
+	return out, true
+}
+
+// terminated makes sure the last line ends with a line break, so markers end up on their own line.
+func terminated(lines []string, eol string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+
+	out := append([]string{}, lines...)
+	out[len(out)-1] += eol
+
+	return out
+}
+
+// splitLines splits the content in lines, keeping the line breaks.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+
+	// A trailing line break leaves an empty line behind.
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchLines returns, for every line in a, the index of the same line in b
+// according to the longest common subsequence, or -1 if it was changed.
+func matchLines(a, b []string) []int {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+
+	// Most edits are small, so match the common prefix and suffix directly.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		match[prefix] = prefix
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		match[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+
+	// Longest common subsequence of what's left in the middle.
+	ma := a[prefix : len(a)-suffix]
+	mb := b[prefix : len(b)-suffix]
+	n, m := len(ma), len(mb)
+
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case ma[i] == mb[j]:
+			match[prefix+i] = prefix + j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return match
+}
@@ -0,0 +1,427 @@
+package d2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// pristineDir is the directory in the game where the upstream copies of merged files
+// are kept, they're the base the next upstream changes are merged from.
+const pristineDir = ".hiddengamers/pristine"
+
+// modManifestPath returns the path to the manifest of the given mod version.
+func modManifestPath(mod config.Mod, version string) string {
+	return fmt.Sprintf("%s/manifest.json", mod.RemoteDirFor(version))
+}
+
+// getModManifest returns the manifest of the mod version, the manifests already
+// downloaded are kept in the given map by remote directory.
+func (s *service) getModManifest(mod config.Mod, version string, manifests map[string]*Manifest) (*Manifest, error) {
+	remoteDir := mod.RemoteDirFor(version)
+	if m, ok := manifests[remoteDir]; ok {
+		return m, nil
+	}
+
+	m, err := s.getManifest(modManifestPath(mod, version))
+	if err != nil {
+		return nil, err
+	}
+
+	manifests[remoteDir] = m
+	return m, nil
+}
+
+// validateMod will make sure the version of the mod chosen for the game is
+// up to date, and that no other version of the mod is installed.
+func (s *service) validateMod(game *storage.Game, mod config.Mod, manifests map[string]*Manifest) (bool, error) {
+	isValid := true
+	desired := game.ModVersion(mod.Name)
+
+	// Files that are never overwritten, the user's own copies and the merged ones.
+	protected := modProtectedFiles(game, mod)
+
+	for _, v := range mod.Versions {
+		manifest, err := s.getModManifest(mod, v, manifests)
+		if err != nil {
+			return false, err
+		}
+
+		// This particular version should be installed.
+		if desired == v {
+			files := modFiles(mod, manifest.Files)
+
+			// Check how many files aren't up to date with the mod.
+			missingFiles, _, err := s.getFilesToPatch(files, game.Location, protected)
+			if err != nil {
+				return false, err
+			}
+
+			// Mod isn't up to date.
+			if len(missingFiles) > 0 {
+				s.addFilesToModel(missingFiles)
+				isValid = false
+			}
+
+			// Files edited by the user that have changed upstream.
+			mergeFiles, err := s.getMergeActions(game, mod, files)
+			if err != nil {
+				return false, err
+			}
+
+			if len(mergeFiles) > 0 {
+				s.addFilesToModel(mergeFiles)
+				isValid = false
+			}
+
+			if err := s.addProtectedFilesToModel(files, game.Location, modSkippedFiles(game, mod)); err != nil {
+				return false, err
+			}
+		} else {
+			installed, err := isModVersionInstalled(game.Location, mod, manifest)
+			if err != nil {
+				return false, err
+			}
+
+			// Version wasn't supposed to be installed, but it is, we need to update.
+			if installed {
+				// Before we return, we need to add these to the patch actions, since they will be removed.
+				err := s.addPatchFilesToBeDeleted(game.Location, manifest.Files, modKeptFiles(game, mod))
+				if err != nil {
+					return false, err
+				}
+
+				isValid = false
+			}
+		}
+	}
+
+	return isValid, nil
+}
+
+// resetMod will remove every installed version of the mod that isn't the one chosen for the game.
+func (s *service) resetMod(game storage.Game, mod config.Mod) error {
+	desired := game.ModVersion(mod.Name)
+
+	for _, v := range mod.Versions {
+		// Desired version, don't reset it.
+		if desired == v {
+			continue
+		}
+
+		manifest, err := s.getManifest(modManifestPath(mod, v))
+		if err != nil {
+			return err
+		}
+
+		installed, err := isModVersionInstalled(game.Location, mod, manifest)
+		if err != nil {
+			return err
+		}
+
+		if installed {
+			err := s.resetPatch(game.Location, manifest.Files, modKeptFiles(&game, mod))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *service) applyMod(game *storage.Game, mod config.Mod, version string, state chan PatchState, progress chan float32, manifestFiles []PatchFile) error {
+	path := game.Location
+	remoteDir := mod.RemoteDirFor(version)
+	manifestFiles = modFiles(mod, manifestFiles)
+
+	// Update UI.
+	state <- PatchState{Message: fmt.Sprintf("Comprobando version del mod %s...", mod.Name)}
+
+	// Figure out which files to patch.
+	patchFiles, patchLength, err := s.getFilesToPatch(manifestFiles, path, modProtectedFiles(game, mod))
+	if err != nil {
+		return err
+	}
+
+	if len(patchFiles) > 0 {
+		// Update UI.
+		state <- PatchState{Message: fmt.Sprintf("Actualizando %s a la version %s del mod %s", path, version, mod.Name)}
+
+		if err = s.doPatch(patchFiles, patchLength, remoteDir, path, progress); err != nil {
+			patchErr := err
+			// Make sure we clean up the failed patch.
+			if err := s.cleanUpFailedPatch(path); err != nil {
+				return fmt.Errorf("Error de limpieza: %s : %s", patchErr, err)
+			}
+
+			return err
+		}
+	}
+
+	// Installs patched before merging existed have no upstream copy to merge from yet.
+	if err := seedPristineFiles(game, mod, manifestFiles); err != nil {
+		return err
+	}
+
+	mergeFiles, err := s.getMergeActions(game, mod, manifestFiles)
+	if err != nil {
+		return err
+	}
+
+	for _, action := range mergeFiles {
+		// Update UI.
+		state <- PatchState{Message: fmt.Sprintf("Combinando los cambios de %s del mod %s", action.File.Name, mod.Name)}
+
+		result, err := s.mergeFile(game, action, remoteDir, progress)
+		if err != nil {
+			return err
+		}
+
+		if result.Conflicts > 0 {
+			message := fmt.Sprintf("%s: %d cambios en conflicto con los tuyos, se mantuvieron tus cambios y la version nueva esta en %s", action.File.Name, result.Conflicts, upstreamFileName(action.File.Name))
+			if game.OverrideBHCfg {
+				message = fmt.Sprintf("%s: se mantuvieron tus cambios en %d conflictos", action.File.Name, result.Conflicts)
+			}
+
+			s.logger.Info(fmt.Sprintf("merge of %s in %s had %d conflicts", action.File.Name, path, result.Conflicts))
+			state <- PatchState{Message: message}
+		}
+	}
+
+	return nil
+}
+
+// getMergeActions returns the merge files of the mod that have changed upstream since they were last merged.
+func (s *service) getMergeActions(game *storage.Game, mod config.Mod, files []PatchFile) ([]PatchAction, error) {
+	actions := make([]PatchAction, 0)
+	skipped := modSkippedFiles(game, mod)
+
+	for _, f := range files {
+		// Files the user protected aren't merged either.
+		if f.Deprecated || !isProtected(f.Name, mod.Merge) || isProtected(f.Name, skipped) {
+			continue
+		}
+
+		localCRC, err := s.hashGameFile(game.Location, f.Name)
+		if err != nil && err != ErrCRCFileNotFound {
+			return nil, err
+		}
+
+		pristineCRC, err := s.hashGameFile(game.Location, fmt.Sprintf("%s/%s", pristineDir, f.Name))
+		if err != nil && err != ErrCRCFileNotFound {
+			return nil, err
+		}
+
+		// Without an upstream copy, the file is only up to date if it's untouched.
+		upToDate := pristineCRC == f.CRC || (pristineCRC == "" && localCRC == f.CRC)
+		if localCRC != "" && upToDate {
+			continue
+		}
+
+		actions = append(actions, PatchAction{
+			File:     f,
+			Action:   ActionMerge,
+			LocalCRC: localCRC,
+			D2Path:   game.Location,
+		})
+	}
+
+	return actions, nil
+}
+
+// mergeFile will download the upstream version of the file and merge the changes made since
+// the last merge into the local file. The game reads the file, so conflicts never end up in it,
+// the user's lines are kept and, unless they always want theirs, upstream is written next to it.
+func (s *service) mergeFile(game *storage.Game, action PatchAction, remoteDir string, progress chan float32) (*mergeResult, error) {
+	localPath := GameFilePath(game.Location, action.File.Name)
+	pristine := pristinePath(game.Location, action.File.Name)
+
+	if err := os.MkdirAll(filepath.Dir(pristine), storage.Permissions); err != nil {
+		return nil, err
+	}
+
+	// The file might be missing, along with its directory.
+	if err := os.MkdirAll(filepath.Dir(localPath), storage.Permissions); err != nil {
+		return nil, err
+	}
+
+	// The upstream version replaces the pristine copy once the merge is done.
+	upstreamPath := fmt.Sprintf("%s.tmp", pristine)
+	defer os.Remove(upstreamPath)
+
+	counter := NewWriteCounter(action.File.downloadLength(), progress)
+	if err := s.downloadFile(action.File, remoteDir, upstreamPath, counter); err != nil {
+		return nil, err
+	}
+
+	upstream, err := ioutil.ReadFile(upstreamPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mergeResult{Content: string(upstream)}
+
+	local, err := ioutil.ReadFile(localPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Nothing to merge into if the file is missing.
+	if err == nil {
+		base, err := ioutil.ReadFile(pristine)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			// Never merged before, so there's no telling the user's edits from upstream
+			// changes. With an empty base the whole file is a conflict and the user's copy
+			// is kept as it is. The upstream copy is kept as the pristine copy for the next merge.
+			base = nil
+		}
+
+		*result = merge3(string(base), string(local), string(upstream), true)
+	}
+
+	// Leave upstream next to the file for the user to pick their changes from.
+	sidePath := GameFilePath(game.Location, upstreamFileName(action.File.Name))
+	if result.Conflicts > 0 && !game.OverrideBHCfg {
+		if err := ioutil.WriteFile(sidePath, upstream, storage.Permissions); err != nil {
+			return nil, err
+		}
+	} else if err := os.Remove(sidePath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	tmpPath := fmt.Sprintf("%s.tmp", localPath)
+	if err := ioutil.WriteFile(tmpPath, []byte(result.Content), storage.Permissions); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, localPath); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(upstreamPath, pristine); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// upstreamFileName returns the name of the file upstream is written to when merging it into the given file conflicts.
+func upstreamFileName(name string) string {
+	return fmt.Sprintf("%s.upstream", name)
+}
+
+// seedPristineFiles will keep an upstream copy of the merge files that are untouched,
+// so later upstream changes can be merged into them.
+func seedPristineFiles(game *storage.Game, mod config.Mod, files []PatchFile) error {
+	for _, f := range files {
+		if f.Deprecated || !isProtected(f.Name, mod.Merge) {
+			continue
+		}
+
+		// Already has an upstream copy.
+		pristine := pristinePath(game.Location, f.Name)
+		exists, err := fileExistsOnDisk(fmt.Sprintf("%s/%s", pristineDir, f.Name), game.Location)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			continue
+		}
+
+		localPath := GameFilePath(game.Location, f.Name)
+
+		hashed, err := hashCRC32(localPath, polynomial)
+		if err == ErrCRCFileNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// The user has edited the file, it's not the upstream copy.
+		if hashed != f.CRC {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(pristine), storage.Permissions); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(pristine, contents, storage.Permissions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// modProtectedFiles returns the files of the mod that shouldn't be patched nor removed in
+// the game, the skipped ones and the ones that are merged instead.
+func modProtectedFiles(game *storage.Game, mod config.Mod) []string {
+	return append(modSkippedFiles(game, mod), mod.Merge...)
+}
+
+// modSkippedFiles returns the files of the mod that shouldn't be touched in the game, the ones
+// ignored by the mod rules, the ones protected by the user and the ones installed from packages.
+func modSkippedFiles(game *storage.Game, mod config.Mod) []string {
+	return append(mod.IgnoredFiles(game), patchProtectedPatterns(game)...)
+}
+
+// modKeptFiles returns the files of the mod that are kept when the mod is removed,
+// the protected ones and the settings written by the launcher.
+func modKeptFiles(game *storage.Game, mod config.Mod) []string {
+	return append(modProtectedFiles(game, mod), mod.Settings...)
+}
+
+// modFiles returns the files in the manifest of the mod, settings files are only
+// checked for existence, since the launcher writes the user's settings to them.
+func modFiles(mod config.Mod, files []PatchFile) []PatchFile {
+	result := make([]PatchFile, len(files))
+	for i, f := range files {
+		if isProtected(f.Name, mod.Settings) {
+			f.IgnoreCRC = true
+		}
+
+		result[i] = f
+	}
+
+	return result
+}
+
+// pristinePath returns the path to the upstream copy of a merged file.
+func pristinePath(d2path string, name string) string {
+	return localizePath(fmt.Sprintf("%s/%s/%s", d2path, pristineDir, name))
+}
+
+// isModVersionInstalled checks the identifiers of the mod against the manifest of a version.
+func isModVersionInstalled(path string, mod config.Mod, manifest *Manifest) (bool, error) {
+	for _, identifier := range mod.Identifiers {
+		installed, err := isModInstalled(path, identifier, manifest)
+		if err != nil {
+			return false, err
+		}
+
+		if installed {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
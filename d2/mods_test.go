@@ -0,0 +1,171 @@
+package d2
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+func newMergeTest(t *testing.T, local string, upstream string) (*service, *storage.Game, PatchAction) {
+	t.Helper()
+
+	location := newTestGame(t, map[string]string{"BH.cfg": local})
+	source := &fakeSource{files: map[string][]byte{"maphack/BH.cfg": []byte(upstream)}}
+
+	action := PatchAction{
+		Action: ActionMerge,
+		File:   PatchFile{Name: "BH.cfg", CRC: crcOf(upstream), ContentLength: int64(len(upstream))},
+		D2Path: location,
+	}
+
+	return newTestService(source), &storage.Game{ID: "game", Location: location}, action
+}
+
+func readPristine(t *testing.T, location string, name string) string {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(pristinePath(location, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestMergeFileWithoutPristineCopy(t *testing.T) {
+	local := "Toggle Maphack: True\nItem Display: Custom\n"
+	upstream := "Toggle Maphack: True\nItem Display: Default\nNew Setting: True\n"
+
+	t.Run("conflict", func(t *testing.T) {
+		s, game, action := newMergeTest(t, local, upstream)
+
+		result, err := s.mergeFile(game, action, "maphack", make(chan float32, 1))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if result.Conflicts != 1 {
+			t.Fatalf("expected a conflict, got %d", result.Conflicts)
+		}
+
+		// The game reads the file, it never gets conflict markers.
+		if got := readTestFile(t, game.Location, "BH.cfg"); got != local {
+			t.Fatalf("expected the user's copy to be kept, got %q", got)
+		}
+
+		if got := readTestFile(t, game.Location, "BH.cfg.upstream"); got != upstream {
+			t.Fatalf("expected upstream to be written next to the file, got %q", got)
+		}
+
+		if got := readPristine(t, game.Location, "BH.cfg"); got != upstream {
+			t.Fatalf("expected the pristine copy to be seeded from upstream, got %q", got)
+		}
+	})
+
+	t.Run("override", func(t *testing.T) {
+		s, game, action := newMergeTest(t, local, upstream)
+		game.OverrideBHCfg = true
+
+		result, err := s.mergeFile(game, action, "maphack", make(chan float32, 1))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if result.Conflicts != 1 {
+			t.Fatalf("expected a conflict, got %d", result.Conflicts)
+		}
+
+		if got := readTestFile(t, game.Location, "BH.cfg"); got != local {
+			t.Fatalf("expected the user's copy to be kept, got %q", got)
+		}
+
+		assertMissing(t, game.Location, "BH.cfg.upstream")
+
+		if got := readPristine(t, game.Location, "BH.cfg"); got != upstream {
+			t.Fatalf("expected the pristine copy to be seeded from upstream, got %q", got)
+		}
+	})
+}
+
+func TestMergeFileConflict(t *testing.T) {
+	pristine := "Item Display: Default\nToggle Maphack: True\nExperience Meter: False\n"
+	local := "Item Display: Custom\nToggle Maphack: True\nExperience Meter: False\n"
+	upstream := "Item Display: Compact\nToggle Maphack: True\nExperience Meter: True\n"
+
+	s, game, action := newMergeTest(t, local, upstream)
+	writeTestFile(t, pristinePath(game.Location, "BH.cfg"), pristine)
+
+	result, err := s.mergeFile(game, action, "maphack", make(chan float32, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Conflicts != 1 {
+		t.Fatalf("expected a conflict, got %d", result.Conflicts)
+	}
+
+	// The user's line wins the conflict, the other upstream changes are still merged.
+	want := "Item Display: Custom\nToggle Maphack: True\nExperience Meter: True\n"
+	if got := readTestFile(t, game.Location, "BH.cfg"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if got := readTestFile(t, game.Location, "BH.cfg.upstream"); got != upstream {
+		t.Fatalf("expected upstream to be written next to the file, got %q", got)
+	}
+
+	// A later merge without conflicts removes the stale upstream copy.
+	next := "Item Display: Compact\nToggle Maphack: True\nExperience Meter: False\n"
+	s.hiddengamersdiabloClient = &fakeSource{files: map[string][]byte{"maphack/BH.cfg": []byte(next)}}
+	action.File = PatchFile{Name: "BH.cfg", CRC: crcOf(next), ContentLength: int64(len(next))}
+
+	result, err = s.mergeFile(game, action, "maphack", make(chan float32, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Conflicts != 0 {
+		t.Fatalf("expected no conflicts, got %d", result.Conflicts)
+	}
+
+	want = "Item Display: Custom\nToggle Maphack: True\nExperience Meter: False\n"
+	if got := readTestFile(t, game.Location, "BH.cfg"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	assertMissing(t, game.Location, "BH.cfg.upstream")
+}
+
+func TestMergeFileWithPristineCopy(t *testing.T) {
+	pristine := "Item Display: Default\nToggle Maphack: True\nExperience Meter: False\n"
+	local := "Item Display: Custom\nToggle Maphack: True\nExperience Meter: False\n"
+	upstream := "Item Display: Default\nToggle Maphack: True\nExperience Meter: True\n"
+
+	s, game, action := newMergeTest(t, local, upstream)
+	writeTestFile(t, pristinePath(game.Location, "BH.cfg"), pristine)
+
+	result, err := s.mergeFile(game, action, "maphack", make(chan float32, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Conflicts != 0 {
+		t.Fatalf("expected no conflicts, got %d", result.Conflicts)
+	}
+
+	// The user's edit and the upstream change are both kept.
+	want := "Item Display: Custom\nToggle Maphack: True\nExperience Meter: True\n"
+	if got := readTestFile(t, game.Location, "BH.cfg"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if got := readPristine(t, game.Location, "BH.cfg"); got != upstream {
+		t.Fatalf("expected the pristine copy to be upstream, got %q", got)
+	}
+
+	if strings.Contains(readTestFile(t, game.Location, "BH.cfg"), conflictLocal) {
+		t.Fatal("expected no conflict markers")
+	}
+}
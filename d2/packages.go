@@ -0,0 +1,412 @@
+package d2
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// packageManifestName is the name of the manifest inside a package archive.
+const packageManifestName = "manifest.json"
+
+var (
+	// ErrPackageNoManifest is used when a package archive doesn't contain a manifest.
+	ErrPackageNoManifest = errors.New("el paquete no tiene manifest.json")
+
+	// ErrPackageNotInstalled is used when uninstalling a package that isn't installed.
+	ErrPackageNotInstalled = errors.New("el paquete no esta instalado")
+
+	// ErrPackageFilesChanged is used when files of a package were changed after installing it, so they weren't removed.
+	ErrPackageFilesChanged = errors.New("algunos archivos del paquete fueron modificados y no se eliminaron")
+)
+
+// InstallPackage will install the local mod package in the given archive into the game.
+func (s *service) InstallPackage(gameID string, archive string) error {
+	game, err := s.getGame(gameID)
+	if err != nil {
+		return err
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	manifest, files, err := readPackage(&r.Reader)
+	if err != nil {
+		return err
+	}
+
+	// The package is named after the archive.
+	name := strings.TrimSuffix(filepath.Base(archive), filepath.Ext(archive))
+
+	// Extract the package before touching any earlier install of it,
+	// so a failed install leaves the game as it was.
+	installed, err := s.extractPackage(game.Location, manifest, files, game.ProtectedPatterns())
+	if err != nil {
+		patchErr := err
+		// Make sure we clean up the failed install.
+		if err := s.cleanUpFailedPatch(game.Location); err != nil {
+			return fmt.Errorf("Error de limpieza: %s : %s", patchErr, err)
+		}
+
+		return err
+	}
+
+	pkg := storage.Package{
+		Name:        name,
+		Source:      archive,
+		InstalledAt: time.Now(),
+	}
+
+	extracted := make(map[string]bool, len(installed))
+	for _, f := range installed {
+		pkg.Files = append(pkg.Files, storage.PackageFile{Name: f.Name, CRC: f.CRC})
+		extracted[f.Name] = true
+	}
+
+	packages := make([]storage.Package, 0, len(game.Packages)+1)
+	for _, p := range game.Packages {
+		if p.Name != name {
+			packages = append(packages, p)
+			continue
+		}
+
+		// Remove the files of the earlier install that aren't in the package anymore, so we don't leave rogue files behind.
+		left, err := s.removePackageFiles(game, p, extracted)
+		if err != nil {
+			return err
+		}
+
+		// Files changed since the earlier install stay on disk, they're still part of the package.
+		pkg.Files = append(pkg.Files, left...)
+	}
+
+	return s.configService.UpdatePackages(game.ID, append(packages, pkg))
+}
+
+// UninstallPackage will remove the files of the package with the given name from the game.
+func (s *service) UninstallPackage(gameID string, name string) error {
+	game, err := s.getGame(gameID)
+	if err != nil {
+		return err
+	}
+
+	packages := make([]storage.Package, 0, len(game.Packages))
+	var changed []storage.PackageFile
+	found := false
+
+	for _, p := range game.Packages {
+		if p.Name != name {
+			packages = append(packages, p)
+			continue
+		}
+
+		found = true
+
+		left, err := s.removePackageFiles(game, p, nil)
+		if err != nil {
+			return err
+		}
+
+		// Keep the package installed with the files that couldn't be removed,
+		// so it can be uninstalled once the user has dealt with them.
+		if len(left) > 0 {
+			p.Files = left
+			packages = append(packages, p)
+			changed = left
+		}
+	}
+
+	if !found {
+		return ErrPackageNotInstalled
+	}
+
+	if err := s.configService.UpdatePackages(game.ID, packages); err != nil {
+		return err
+	}
+
+	if len(changed) > 0 {
+		for _, f := range changed {
+			s.logger.Error(fmt.Errorf("%s del paquete %s fue modificado, no se elimino", f.Name, name))
+		}
+
+		return ErrPackageFilesChanged
+	}
+
+	return nil
+}
+
+// ListPackages returns the local mod packages installed in the game.
+func (s *service) ListPackages(gameID string) ([]storage.Package, error) {
+	game, err := s.getGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	return game.Packages, nil
+}
+
+// removePackageFiles will delete the files of the package from disk, except the ones to keep,
+// and patch back the files of the game the package had replaced. Files that have been changed
+// since the package was installed aren't deleted, they're returned instead.
+func (s *service) removePackageFiles(game *storage.Game, pkg storage.Package, keep map[string]bool) ([]storage.PackageFile, error) {
+	protected := game.ProtectedPatterns()
+
+	var left []storage.PackageFile
+	var removed []string
+
+	for _, f := range pkg.Files {
+		// Make sure we don't remove the protected files.
+		if keep[f.Name] || isProtected(f.Name, protected) {
+			continue
+		}
+
+		hashed, err := s.hashGameFile(game.Location, f.Name)
+		if err != nil && err != ErrCRCFileNotFound {
+			return nil, err
+		}
+
+		// The user has changed the file, leave it alone.
+		if err == nil && f.CRC != "" && hashed != f.CRC {
+			left = append(left, f)
+			continue
+		}
+
+		if err := s.deleteFile(f.Name, game.Location); err != nil {
+			return nil, err
+		}
+
+		removed = append(removed, f.Name)
+	}
+
+	if err := s.restoreBaseFiles(game, removed); err != nil {
+		return nil, err
+	}
+
+	return left, nil
+}
+
+// restoreBaseFiles will patch back the given files if they're part of the game version or the
+// HiddenGamers Diablo patch, since a package can replace the files of the game itself.
+func (s *service) restoreBaseFiles(game *storage.Game, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	restore := make(map[string]bool, len(names))
+	for _, name := range names {
+		restore[name] = true
+	}
+
+	version, versionManifest, err := s.getVersionManifest()
+	if err != nil {
+		return err
+	}
+
+	slashManifest, err := s.getManifest("current/manifest.json")
+	if err != nil {
+		return err
+	}
+
+	// Same order as patching, the HiddenGamers Diablo patch goes on top of the game version.
+	patches := []struct {
+		remoteDir string
+		files     []PatchFile
+	}{
+		{remoteDir: version, files: versionManifest.Files},
+		{remoteDir: "current", files: slashManifest.Files},
+	}
+
+	// Nobody follows the progress, the write counter drops it.
+	progress := make(chan float32, 1)
+
+	for _, patch := range patches {
+		var files []PatchFile
+		for _, f := range patch.files {
+			if restore[f.Name] && !f.Deprecated {
+				files = append(files, f)
+			}
+		}
+
+		patchFiles, patchLength, err := s.getFilesToPatch(files, game.Location, game.ProtectedPatterns())
+		if err != nil {
+			return err
+		}
+
+		if len(patchFiles) == 0 {
+			continue
+		}
+
+		if err := s.doPatch(patchFiles, patchLength, patch.remoteDir, game.Location, progress); err != nil {
+			patchErr := err
+			// Make sure we clean up the failed patch.
+			if err := s.cleanUpFailedPatch(game.Location); err != nil {
+				return fmt.Errorf("Error de limpieza: %s : %s", patchErr, err)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractPackage will extract the files in the manifest, only replacing the files in the game
+// once all of them have been extracted. Protected files are left alone, the extracted files are returned.
+func (s *service) extractPackage(location string, manifest *Manifest, files map[string]*zip.File, protected []string) ([]PatchFile, error) {
+	var (
+		tmpFiles  []string
+		extracted []PatchFile
+	)
+
+	for _, f := range manifest.Files {
+		// The user wants to keep their own copy of the file.
+		if isProtected(f.Name, protected) {
+			continue
+		}
+
+		filePath, err := gameFile(location, f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		tmpPath := fmt.Sprintf("%s.tmp", filePath)
+
+		if err := os.MkdirAll(filepath.Dir(tmpPath), storage.Permissions); err != nil {
+			return nil, err
+		}
+
+		if err := extractFile(files[f.Name], tmpPath); err != nil {
+			return nil, err
+		}
+
+		tmpFiles = append(tmpFiles, tmpPath)
+		extracted = append(extracted, f)
+
+		// Make sure the extracted file is the file in the manifest.
+		if f.CRC != "" {
+			hashed, err := hashCRC32(tmpPath, polynomial)
+			if err != nil {
+				return nil, err
+			}
+
+			if hashed != f.CRC {
+				return nil, fmt.Errorf("%s del paquete no coincide con el CRC del manifest", f.Name)
+			}
+		}
+	}
+
+	// All the files were successfully extracted, remove the .tmp suffix.
+	for _, tmpFile := range tmpFiles {
+		if err := os.Rename(tmpFile, tmpFile[:len(tmpFile)-4]); err != nil {
+			return nil, err
+		}
+	}
+
+	return extracted, nil
+}
+
+// readPackage will read the manifest of the package and make sure every file in it exists in the archive.
+func readPackage(r *zip.Reader) (*Manifest, map[string]*zip.File, error) {
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	mf, ok := files[packageManifestName]
+	if !ok {
+		return nil, nil, ErrPackageNoManifest
+	}
+
+	rc, err := mf.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rc.Close()
+
+	bytes, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(bytes, &manifest); err != nil {
+		return nil, nil, err
+	}
+
+	for _, f := range manifest.Files {
+		// Never allow a package to write outside of the game directory.
+		if _, err := cleanFileName(f.Name); err != nil {
+			return nil, nil, fmt.Errorf("nombre de archivo invalido en el paquete: %s", err)
+		}
+
+		if _, ok := files[f.Name]; !ok {
+			return nil, nil, fmt.Errorf("%s no existe en el paquete", f.Name)
+		}
+	}
+
+	return &manifest, files, nil
+}
+
+func extractFile(f *zip.File, dst string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+
+	_, err = io.Copy(out, rc)
+
+	return err
+}
+
+// patchProtectedPatterns returns the files patching leaves alone in the game, the ones protected
+// by the user and the ones installed from packages, since a package can replace the files of the game.
+func patchProtectedPatterns(game *storage.Game) []string {
+	patterns := game.ProtectedPatterns()
+	for _, pkg := range game.Packages {
+		for _, f := range pkg.Files {
+			patterns = append(patterns, filePattern(f.Name))
+		}
+	}
+
+	return patterns
+}
+
+// getGame returns the game with the given id from the config.
+func (s *service) getGame(id string) (*storage.Game, error) {
+	conf, err := s.configService.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range conf.Games {
+		if conf.Games[i].ID == id {
+			return &conf.Games[i], nil
+		}
+	}
+
+	return nil, config.ErrGameNotFound
+}
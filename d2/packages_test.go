@@ -0,0 +1,379 @@
+package d2
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// newTestPackage writes a package archive with the given name and files, and returns its path.
+func newTestPackage(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "d2package")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name+".zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+
+	var manifest Manifest
+	for fileName, content := range files {
+		manifest.Files = append(manifest.Files, PatchFile{Name: fileName, CRC: crcOf(content)})
+
+		f, err := w.Create(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Write([]byte(content))
+	}
+
+	f, err := w.Create(packageManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.NewEncoder(f).Encode(manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// newPackageTest returns a service with a single game, with the base files of 1.13c served by the fake source.
+func newPackageTest(t *testing.T, base map[string]string) (*service, *fakeConfig, string) {
+	t.Helper()
+
+	location := newTestGame(t, base)
+
+	var manifest Manifest
+	files := make(map[string][]byte)
+	for name, content := range base {
+		manifest.Files = append(manifest.Files, PatchFile{Name: name, CRC: crcOf(content), ContentLength: int64(len(content))})
+		files[defaultGameVersion+"/"+name] = []byte(content)
+	}
+
+	versionManifest, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files[defaultGameVersion+"/manifest.json"] = versionManifest
+	files["current/manifest.json"] = []byte(`{"files": []}`)
+
+	conf := &fakeConfig{conf: storage.Config{Games: []storage.Game{{ID: "game", Location: location}}}}
+
+	s := newTestService(&fakeSource{files: files})
+	s.configService = conf
+
+	return s, conf, location
+}
+
+func installedPackages(t *testing.T, conf *fakeConfig) []storage.Package {
+	t.Helper()
+
+	c, err := conf.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.Games[0].Packages
+}
+
+func packageFileNames(pkg storage.Package) map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range pkg.Files {
+		names[f.Name] = true
+	}
+
+	return names
+}
+
+func assertMissing(t *testing.T, location string, name string) {
+	t.Helper()
+
+	if _, err := os.Stat(GameFilePath(location, name)); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", name, err)
+	}
+}
+
+func TestUninstallPackageRestoresBaseFiles(t *testing.T) {
+	s, conf, location := newPackageTest(t, map[string]string{"Patch_D2.mpq": "base patch"})
+
+	archive := newTestPackage(t, "hd", map[string]string{
+		"Patch_D2.mpq": "hd patch",
+		"data/hd.txt":  "hd settings",
+	})
+
+	if err := s.InstallPackage("game", archive); err != nil {
+		t.Fatalf("unexpected error installing: %s", err)
+	}
+
+	if got := readTestFile(t, location, "Patch_D2.mpq"); got != "hd patch" {
+		t.Fatalf("expected the package to replace the base file, got %q", got)
+	}
+
+	if packages := installedPackages(t, conf); len(packages) != 1 || len(packages[0].Files) != 2 {
+		t.Fatalf("expected the package to be installed, got %+v", packages)
+	}
+
+	if err := s.UninstallPackage("game", "hd"); err != nil {
+		t.Fatalf("unexpected error uninstalling: %s", err)
+	}
+
+	// The base file the package replaced is patched back, the rest is gone.
+	if got := readTestFile(t, location, "Patch_D2.mpq"); got != "base patch" {
+		t.Fatalf("expected the base file to be restored, got %q", got)
+	}
+
+	assertMissing(t, location, "data/hd.txt")
+	assertMissing(t, location, "data")
+
+	if packages := installedPackages(t, conf); len(packages) != 0 {
+		t.Fatalf("expected no packages, got %+v", packages)
+	}
+}
+
+func TestUninstallPackageKeepsChangedFiles(t *testing.T) {
+	s, conf, location := newPackageTest(t, nil)
+
+	archive := newTestPackage(t, "items", map[string]string{
+		"items.txt":  "items",
+		"skills.txt": "skills",
+	})
+
+	if err := s.InstallPackage("game", archive); err != nil {
+		t.Fatalf("unexpected error installing: %s", err)
+	}
+
+	// The user has made the file their own.
+	writeTestFile(t, GameFilePath(location, "items.txt"), "my items")
+
+	if err := s.UninstallPackage("game", "items"); err != ErrPackageFilesChanged {
+		t.Fatalf("expected ErrPackageFilesChanged, got %v", err)
+	}
+
+	if got := readTestFile(t, location, "items.txt"); got != "my items" {
+		t.Fatalf("expected the changed file to be kept, got %q", got)
+	}
+
+	assertMissing(t, location, "skills.txt")
+
+	// The package stays installed with the files left on disk.
+	packages := installedPackages(t, conf)
+	if len(packages) != 1 {
+		t.Fatalf("expected the package to stay installed, got %+v", packages)
+	}
+
+	if names := packageFileNames(packages[0]); len(names) != 1 || !names["items.txt"] {
+		t.Fatalf("expected only items.txt to be left in the package, got %+v", packages[0].Files)
+	}
+
+	// Once the file is dealt with, the package can be uninstalled.
+	if err := os.Remove(GameFilePath(location, "items.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UninstallPackage("game", "items"); err != nil {
+		t.Fatalf("unexpected error uninstalling: %s", err)
+	}
+
+	if packages := installedPackages(t, conf); len(packages) != 0 {
+		t.Fatalf("expected no packages, got %+v", packages)
+	}
+}
+
+func TestInstallPackageReplacesEarlierInstall(t *testing.T) {
+	s, conf, location := newPackageTest(t, nil)
+
+	first := newTestPackage(t, "items", map[string]string{
+		"items.txt":  "items v1",
+		"skills.txt": "skills v1",
+	})
+
+	if err := s.InstallPackage("game", first); err != nil {
+		t.Fatalf("unexpected error installing: %s", err)
+	}
+
+	second := newTestPackage(t, "items", map[string]string{
+		"items.txt": "items v2",
+	})
+
+	if err := s.InstallPackage("game", second); err != nil {
+		t.Fatalf("unexpected error reinstalling: %s", err)
+	}
+
+	if got := readTestFile(t, location, "items.txt"); got != "items v2" {
+		t.Fatalf("expected the new version of the file, got %q", got)
+	}
+
+	// Files dropped from the package don't become rogue files.
+	assertMissing(t, location, "skills.txt")
+
+	packages := installedPackages(t, conf)
+	if len(packages) != 1 || packages[0].Source != second {
+		t.Fatalf("expected the package to be replaced, got %+v", packages)
+	}
+
+	if names := packageFileNames(packages[0]); len(names) != 1 || !names["items.txt"] {
+		t.Fatalf("expected only items.txt in the package, got %+v", packages[0].Files)
+	}
+}
+
+func TestPatchKeepsPackageFiles(t *testing.T) {
+	s, _, location := newPackageTest(t, map[string]string{"Patch_D2.mpq": "base patch"})
+	s.availableMods = &config.GameMods{}
+
+	archive := newTestPackage(t, "hd", map[string]string{"Patch_D2.mpq": "hd patch"})
+
+	if err := s.InstallPackage("game", archive); err != nil {
+		t.Fatalf("unexpected error installing: %s", err)
+	}
+
+	done := make(chan bool)
+	_, state := s.Patch(done)
+
+	if err := waitForPatch(t, done, state); err != nil {
+		t.Fatalf("unexpected error patching: %s", err)
+	}
+
+	// Reverting the file would make the package look broken, and repairing it would be reverted again.
+	if got := readTestFile(t, location, "Patch_D2.mpq"); got != "hd patch" {
+		t.Fatalf("expected the package file to survive the patch, got %q", got)
+	}
+}
+
+func TestInstallPackageSkipsProtectedFiles(t *testing.T) {
+	s, conf, location := newPackageTest(t, map[string]string{"BH.cfg": "my config"})
+	conf.conf.Games[0].ProtectedFiles = []string{"*.cfg"}
+
+	archive := newTestPackage(t, "maphack", map[string]string{
+		"BH.cfg": "package config",
+		"BH.dll": "package dll",
+	})
+
+	if err := s.InstallPackage("game", archive); err != nil {
+		t.Fatalf("unexpected error installing: %s", err)
+	}
+
+	if got := readTestFile(t, location, "BH.cfg"); got != "my config" {
+		t.Fatalf("expected the protected file to be kept, got %q", got)
+	}
+
+	if got := readTestFile(t, location, "BH.dll"); got != "package dll" {
+		t.Fatalf("expected the package file to be extracted, got %q", got)
+	}
+
+	// The protected file isn't part of the package, so uninstalling it won't touch it either.
+	packages := installedPackages(t, conf)
+	if names := packageFileNames(packages[0]); len(names) != 1 || !names["BH.dll"] {
+		t.Fatalf("expected only BH.dll in the package, got %+v", packages[0].Files)
+	}
+}
+
+func TestInstallPackageFailureKeepsEarlierInstall(t *testing.T) {
+	s, conf, location := newPackageTest(t, nil)
+
+	first := newTestPackage(t, "items", map[string]string{
+		"items.txt":  "items v1",
+		"skills.txt": "skills v1",
+	})
+
+	if err := s.InstallPackage("game", first); err != nil {
+		t.Fatalf("unexpected error installing: %s", err)
+	}
+
+	// A package whose files don't match its manifest.
+	broken := newTestPackage(t, "items", map[string]string{"items.txt": "items v2"})
+	corruptPackage(t, broken, "items.txt", "corrupt")
+
+	if err := s.InstallPackage("game", broken); err == nil {
+		t.Fatal("expected installing a corrupt package to fail")
+	}
+
+	// Nothing of the earlier install was touched.
+	if got := readTestFile(t, location, "items.txt"); got != "items v1" {
+		t.Fatalf("expected the earlier file to be kept, got %q", got)
+	}
+
+	if got := readTestFile(t, location, "skills.txt"); got != "skills v1" {
+		t.Fatalf("expected the earlier file to be kept, got %q", got)
+	}
+
+	assertMissing(t, location, "items.txt.tmp")
+
+	packages := installedPackages(t, conf)
+	if len(packages) != 1 || packages[0].Source != first {
+		t.Fatalf("expected the earlier install to be kept, got %+v", packages)
+	}
+}
+
+// corruptPackage rewrites the archive with different content for the file, keeping the manifest.
+func corruptPackage(t *testing.T, archive string, name string, content string) {
+	t.Helper()
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[f.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r.Close()
+
+	files[name] = []byte(content)
+
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	for fileName, content := range files {
+		f, err := w.Create(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Write(content)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,143 @@
+package d2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestError is a file in a manifest that was rejected, such as a
+// file that would end up outside of the game directory.
+type ManifestError struct {
+	// Manifest is the path of the manifest, if known.
+	Manifest string
+	Name     string
+	Reason   string
+}
+
+func (e *ManifestError) Error() string {
+	if e.Manifest == "" {
+		return fmt.Sprintf("archivo %q rechazado: %s", e.Name, e.Reason)
+	}
+
+	return fmt.Sprintf("%s: archivo %q rechazado: %s", e.Manifest, e.Name, e.Reason)
+}
+
+// cleanFileName returns the file name normalised to a relative path with forward slashes,
+// names that aren't inside the game directory are rejected.
+func cleanFileName(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", &ManifestError{Name: name, Reason: "nombre vacio"}
+	}
+
+	// Colons are drive letters and alternate data streams on Windows.
+	if strings.ContainsAny(name, "\x00:") {
+		return "", &ManifestError{Name: name, Reason: "caracteres invalidos"}
+	}
+
+	// Windows accepts both kinds of slashes.
+	slashed := strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(slashed, "/") {
+		return "", &ManifestError{Name: name, Reason: "ruta absoluta"}
+	}
+
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", &ManifestError{Name: name, Reason: "sale del directorio del juego"}
+		}
+	}
+
+	clean := path.Clean(slashed)
+	if clean == "." {
+		return "", &ManifestError{Name: name, Reason: "nombre vacio"}
+	}
+
+	return clean, nil
+}
+
+// gameFile returns the path on disk to a file in the game directory, making sure it's inside of it.
+func gameFile(location string, name string) (string, error) {
+	clean, err := cleanFileName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return GameFilePath(location, clean), nil
+}
+
+// normalize will validate and normalise the names of the files in the manifest,
+// the manifest is rejected if any of them isn't inside the game directory.
+func (m *Manifest) normalize(source string) error {
+	for i := range m.Files {
+		clean, err := cleanFileName(m.Files[i].Name)
+		if err != nil {
+			err.(*ManifestError).Manifest = source
+			return err
+		}
+
+		m.Files[i].Name = clean
+	}
+
+	return nil
+}
+
+// findTmpFiles returns the names of the downloads left behind in the game directory and its subdirectories.
+func findTmpFiles(location string) ([]string, error) {
+	root := localizePath(location)
+
+	var names []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+
+	return names, err
+}
+
+// removeEmptyDirs will remove the directories of the file that have been left empty,
+// up to the game directory, which is never removed.
+func removeEmptyDirs(location string, name string) error {
+	clean, err := cleanFileName(name)
+	if err != nil {
+		return err
+	}
+
+	for dir := path.Dir(clean); dir != "."; dir = path.Dir(dir) {
+		dirPath := GameFilePath(location, dir)
+
+		entries, err := ioutil.ReadDir(dirPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if len(entries) > 0 {
+			return nil
+		}
+
+		if err := os.Remove(dirPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
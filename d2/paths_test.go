@@ -0,0 +1,112 @@
+package d2
+
+import (
+	"testing"
+)
+
+func TestCleanFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Game.exe", want: "Game.exe"},
+		{name: "data/global/excel/items.txt", want: "data/global/excel/items.txt"},
+		{name: "data\\global\\items.txt", want: "data/global/items.txt"},
+		{name: "./data//items.txt", want: "data/items.txt"},
+		{name: "data/./items.txt", want: "data/items.txt"},
+		{name: "..data", want: "..data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanFileName(tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCleanFileNameRejected(t *testing.T) {
+	names := []string{
+		"",
+		"   ",
+		".",
+		"..",
+		"../Game.exe",
+		"data/../../Game.exe",
+		"data\\..\\..\\Game.exe",
+		"/etc/passwd",
+		"\\Windows\\System32\\kernel32.dll",
+		"C:Game.exe",
+		"C:\\Windows\\System32\\kernel32.dll",
+		"Game.exe:stream",
+		"Game.exe\x00.txt",
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			got, err := cleanFileName(name)
+			if err == nil {
+				t.Fatalf("expected %q to be rejected, got %q", name, got)
+			}
+
+			if _, ok := err.(*ManifestError); !ok {
+				t.Fatalf("expected a ManifestError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestManifestNormalize(t *testing.T) {
+	manifest := Manifest{Files: []PatchFile{
+		{Name: "data\\items.txt"},
+		{Name: "./Game.exe"},
+	}}
+
+	if err := manifest.normalize("current/manifest.json"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if manifest.Files[0].Name != "data/items.txt" || manifest.Files[1].Name != "Game.exe" {
+		t.Fatalf("expected the names to be normalised, got %+v", manifest.Files)
+	}
+}
+
+func TestManifestNormalizeRejected(t *testing.T) {
+	manifest := Manifest{Files: []PatchFile{
+		{Name: "Game.exe"},
+		{Name: "../../Windows/System32/kernel32.dll"},
+		{Name: "data/items.txt"},
+	}}
+
+	err := manifest.normalize("current/manifest.json")
+	if err == nil {
+		t.Fatal("expected the manifest to be rejected")
+	}
+
+	manifestErr, ok := err.(*ManifestError)
+	if !ok {
+		t.Fatalf("expected a ManifestError, got %T", err)
+	}
+
+	if manifestErr.Manifest != "current/manifest.json" || manifestErr.Name != "../../Windows/System32/kernel32.dll" {
+		t.Fatalf("expected the manifest and the rejected file in the error, got %+v", manifestErr)
+	}
+}
+
+func TestGameFileRejected(t *testing.T) {
+	location := newTestGame(t, nil)
+
+	if _, err := gameFile(location, "../Game.exe"); err == nil {
+		t.Fatal("expected gameFile to reject a file outside of the game")
+	}
+
+	if _, err := fileExistsOnDisk("../Game.exe", location); err == nil {
+		t.Fatal("expected fileExistsOnDisk to reject a file outside of the game")
+	}
+}
@@ -0,0 +1,49 @@
+package d2
+
+import (
+	"path"
+	"strings"
+)
+
+// isProtected returns true if the file name matches any of the protected patterns.
+// Patterns are globs, a pattern without a directory matches the file in any directory,
+// unless it starts with a / that anchors it to the game directory.
+func isProtected(name string, patterns []string) bool {
+	// Windows file names aren't case sensitive, so neither are the patterns.
+	name = strings.ToLower(strings.Replace(name, "\\", "/", -1))
+
+	for _, p := range patterns {
+		p = strings.ToLower(strings.Replace(p, "\\", "/", -1))
+
+		anchored := strings.HasPrefix(p, "/")
+		p = strings.TrimPrefix(p, "/")
+
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+
+		if !anchored && !strings.Contains(p, "/") {
+			if matched, _ := path.Match(p, path.Base(name)); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// filePattern returns a pattern that only matches the given file of the game.
+func filePattern(name string) string {
+	// Glob characters in the name are matched as they are.
+	var b strings.Builder
+	for _, r := range strings.Replace(name, "\\", "/", -1) {
+		switch r {
+		case '*', '?', '[':
+			b.WriteString("[" + string(r) + "]")
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return "/" + b.String()
+}
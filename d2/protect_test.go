@@ -0,0 +1,73 @@
+package d2
+
+import (
+	"testing"
+)
+
+func TestIsProtected(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		patterns []string
+		want     bool
+	}{
+		{name: "no patterns", file: "BH.cfg", patterns: nil, want: false},
+		{name: "exact name", file: "BH.cfg", patterns: []string{"BH.cfg"}, want: true},
+		{name: "other name", file: "BH.dll", patterns: []string{"BH.cfg"}, want: false},
+		{name: "glob", file: "BH.cfg", patterns: []string{"*.cfg"}, want: true},
+		{name: "glob other extension", file: "BH.dll", patterns: []string{"*.cfg"}, want: false},
+		{name: "single character glob", file: "Patch_D2.mpq", patterns: []string{"Patch_D?.mpq"}, want: true},
+		{name: "character class", file: "d2data.mpq", patterns: []string{"d2[dx]*.mpq"}, want: true},
+		{name: "any of the patterns", file: "D2HD.dll", patterns: []string{"BH.cfg", "*.dll"}, want: true},
+		{name: "case insensitive name", file: "bh.CFG", patterns: []string{"BH.cfg"}, want: true},
+		{name: "case insensitive glob", file: "DATA/Items.TXT", patterns: []string{"data/*.txt"}, want: true},
+		{name: "name in a subdirectory", file: "data/global/items.txt", patterns: []string{"items.txt"}, want: true},
+		{name: "glob in a subdirectory", file: "data/global/items.txt", patterns: []string{"*.txt"}, want: true},
+		{name: "pattern with directory", file: "data/items.txt", patterns: []string{"data/items.txt"}, want: true},
+		{name: "pattern with other directory", file: "mod/items.txt", patterns: []string{"data/items.txt"}, want: false},
+		{name: "pattern with directory at the top level", file: "items.txt", patterns: []string{"data/items.txt"}, want: false},
+		{name: "pattern with directory doesn't match deeper", file: "data/global/items.txt", patterns: []string{"data/*.txt"}, want: false},
+		{name: "pattern with backslashes", file: "data/items.txt", patterns: []string{"data\\items.txt"}, want: true},
+		{name: "name with backslashes", file: "data\\items.txt", patterns: []string{"data/items.txt"}, want: true},
+		{name: "directory name isn't a file", file: "data/items.txt", patterns: []string{"data"}, want: false},
+		{name: "anchored at the top level", file: "BH.cfg", patterns: []string{"/BH.cfg"}, want: true},
+		{name: "anchored in a subdirectory", file: "data/BH.cfg", patterns: []string{"/BH.cfg"}, want: false},
+		{name: "anchored with directory", file: "data/BH.cfg", patterns: []string{"/data/BH.cfg"}, want: true},
+		{name: "invalid pattern", file: "BH.cfg", patterns: []string{"[BH.cfg"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isProtected(tt.file, tt.patterns); got != tt.want {
+				t.Fatalf("expected isProtected(%q, %q) to be %t", tt.file, tt.patterns, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilePattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		other string
+	}{
+		{name: "top level", file: "BH.cfg", other: "data/BH.cfg"},
+		{name: "subdirectory", file: "data/BH.cfg", other: "BH.cfg"},
+		{name: "glob characters", file: "Games [old]/*.cfg", other: "Games o/BH.cfg"},
+		{name: "single character glob", file: "BH?.cfg", other: "BH1.cfg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := filePattern(tt.file)
+
+			if !isProtected(tt.file, []string{pattern}) {
+				t.Fatalf("expected %q to match %q", pattern, tt.file)
+			}
+
+			if isProtected(tt.other, []string{pattern}) {
+				t.Fatalf("expected %q not to match %q", pattern, tt.other)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package d2
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by every download, so the limit
+// applies to the launcher as a whole and not to each file separately.
+type rateLimiter struct {
+	mux sync.Mutex
+
+	// rate is the number of bytes allowed per second, 0 means unlimited.
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// SetRate will change the number of bytes per second allowed, takes effect immediately.
+func (l *rateLimiter) SetRate(bytesPerSecond int64) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+
+	l.rate = bytesPerSecond
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// chunkSize is the maximum number of bytes a reader should read at once,
+// small enough for the limit to be smooth but never smaller than 1 KB.
+func (l *rateLimiter) chunkSize() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.rate == 0 {
+		return 32 * 1024
+	}
+
+	size := int(l.rate / 10)
+	if size < 1024 {
+		size = 1024
+	}
+
+	return size
+}
+
+// wait will block until n bytes are allowed to pass through.
+func (l *rateLimiter) wait(n int) {
+	l.mux.Lock()
+
+	// No limit set.
+	if l.rate == 0 {
+		l.mux.Unlock()
+		return
+	}
+
+	// Refill the bucket with the tokens earned since the last call,
+	// but never allow more than one second worth of burst.
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+	l.last = now
+
+	// Reserve the tokens, going negative means we have to wait for them.
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+
+	l.mux.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// rateLimitedReader reads from the underlying reader no faster than the limiter allows.
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+// Read implements the io.Reader interface.
+func (rl *rateLimitedReader) Read(p []byte) (int, error) {
+	// Read in small chunks so a single read can't exceed the limit by much.
+	if size := rl.limiter.chunkSize(); len(p) > size {
+		p = p[:size]
+	}
+
+	n, err := rl.r.Read(p)
+	if n > 0 {
+		rl.limiter.wait(n)
+	}
+
+	return n, err
+}
+
+func newRateLimitedReader(r io.Reader, limiter *rateLimiter) io.Reader {
+	return &rateLimitedReader{r: r, limiter: limiter}
+}
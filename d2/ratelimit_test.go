@@ -0,0 +1,123 @@
+package d2
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readLimited reads size bytes through the limiter and returns how long it took.
+func readLimited(t *testing.T, limiter *rateLimiter, size int) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+
+	n, err := io.Copy(ioutil.Discard, newRateLimitedReader(bytes.NewReader(make([]byte, size)), limiter))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != int64(size) {
+		t.Errorf("expected %d bytes, got %d", size, n)
+	}
+
+	return time.Since(start)
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	limiter := &rateLimiter{}
+	limiter.SetRate(0)
+
+	if elapsed := readLimited(t, limiter, 10*1024*1024); elapsed > time.Second {
+		t.Fatalf("expected an unlimited read to be fast, took %s", elapsed)
+	}
+
+	// Negative rates are unlimited too.
+	limiter.SetRate(-1)
+
+	if elapsed := readLimited(t, limiter, 10*1024*1024); elapsed > time.Second {
+		t.Fatalf("expected an unlimited read to be fast, took %s", elapsed)
+	}
+}
+
+func TestRateLimiterSharedBetweenReaders(t *testing.T) {
+	limiter := &rateLimiter{}
+	limiter.SetRate(100 * 1024)
+
+	start := time.Now()
+
+	// 4 readers of 10 KB each share 100 KB/s, together they need about 0.4 seconds.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readLimited(t, limiter, 10*1024)
+		}()
+	}
+
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	if elapsed < 350*time.Millisecond {
+		t.Fatalf("expected the readers to share the limit, took %s", elapsed)
+	}
+
+	if elapsed > 3*time.Second {
+		t.Fatalf("expected the readers to get the whole limit, took %s", elapsed)
+	}
+}
+
+func TestRateLimiterSetRateAtRuntime(t *testing.T) {
+	limiter := &rateLimiter{}
+	limiter.SetRate(1024)
+
+	done := make(chan time.Duration)
+	go func() {
+		// At 1 KB/s this would take 100 seconds.
+		done <- readLimited(t, limiter, 100*1024)
+	}()
+
+	// Lifting the limit speeds up the download already running.
+	time.Sleep(100 * time.Millisecond)
+	limiter.SetRate(0)
+
+	select {
+	case elapsed := <-done:
+		if elapsed > 3*time.Second {
+			t.Fatalf("expected the new rate to take effect, took %s", elapsed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the new rate didn't take effect")
+	}
+
+	// And limiting it again slows it down.
+	limiter.SetRate(20 * 1024)
+
+	if elapsed := readLimited(t, limiter, 10*1024); elapsed < 400*time.Millisecond {
+		t.Fatalf("expected the limit to apply again, took %s", elapsed)
+	}
+}
+
+func TestRateLimiterChunkSize(t *testing.T) {
+	tests := []struct {
+		rate int64
+		want int
+	}{
+		{rate: 0, want: 32 * 1024},
+		{rate: 1024, want: 1024},
+		{rate: 100 * 1024, want: 10 * 1024},
+	}
+
+	for _, tt := range tests {
+		limiter := &rateLimiter{}
+		limiter.SetRate(tt.rate)
+
+		if got := limiter.chunkSize(); got != tt.want {
+			t.Fatalf("expected chunk size %d at %d B/s, got %d", tt.want, tt.rate, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package d2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/clients/hiddengamersdiablo"
+)
+
+// defaultGameVersion is the Diablo II version installs are patched to if the realm doesn't require one.
+const defaultGameVersion = "1.13c"
+
+// Realm is the settings of the realm published by the server.
+type Realm struct {
+	// GameVersion is the Diablo II version the realm requires, every install is patched
+	// to it with the manifest of the version, before the current patch is applied.
+	GameVersion string `json:"game_version"`
+}
+
+// refreshRealm will forget the realm settings, so they're fetched again. The settings can change
+// while the launcher is open, every patch and validation run follows the ones published when it starts.
+func (s *service) refreshRealm() {
+	s.realmMux.Lock()
+	defer s.realmMux.Unlock()
+
+	s.realm = nil
+}
+
+// getRealm returns the realm settings, a server that doesn't publish them gets the defaults.
+func (s *service) getRealm() (*Realm, error) {
+	s.realmMux.Lock()
+	defer s.realmMux.Unlock()
+
+	// Return cached realm.
+	if s.realm != nil {
+		return s.realm, nil
+	}
+
+	realm := Realm{GameVersion: defaultGameVersion}
+
+	contents, err := s.hiddengamersdiabloClient.GetRealm()
+	switch {
+	case err == hiddengamersdiablo.ErrNotFound:
+		// Keep the defaults.
+	case err != nil:
+		return nil, err
+	default:
+		defer contents.Close()
+
+		bytes, err := ioutil.ReadAll(contents)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(bytes, &realm); err != nil {
+			return nil, err
+		}
+	}
+
+	if realm.GameVersion == "" {
+		realm.GameVersion = defaultGameVersion
+	}
+
+	// The version has to be one we can tell apart, or installs could never be validated.
+	if !isKnownVersion(realm.GameVersion) {
+		return nil, fmt.Errorf("el servidor exige una version de Diablo II desconocida: %s", realm.GameVersion)
+	}
+
+	// Set cache.
+	s.realm = &realm
+
+	return s.realm, nil
+}
+
+// getGameVersion returns the Diablo II version required by the realm.
+func (s *service) getGameVersion() (string, error) {
+	realm, err := s.getRealm()
+	if err != nil {
+		return "", err
+	}
+
+	return realm.GameVersion, nil
+}
+
+// getVersionManifest returns the Diablo II version required by the realm and its manifest,
+// the files of every version are in the remote directory named after it.
+func (s *service) getVersionManifest() (string, *Manifest, error) {
+	version, err := s.getGameVersion()
+	if err != nil {
+		return "", nil, err
+	}
+
+	manifest, err := s.getManifest(fmt.Sprintf("%s/manifest.json", version))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return version, manifest, nil
+}
@@ -0,0 +1,95 @@
+package d2
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGetRealm(t *testing.T) {
+	tests := []struct {
+		name  string
+		realm string
+		want  string
+		err   bool
+	}{
+		{name: "not published", want: defaultGameVersion},
+		{name: "no version", realm: `{}`, want: defaultGameVersion},
+		{name: "version", realm: `{"game_version": "1.14d"}`, want: "1.14d"},
+		{name: "unknown version", realm: `{"game_version": "1.15"}`, err: true},
+		{name: "invalid", realm: `{`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeSource{files: map[string][]byte{}}
+			if tt.realm != "" {
+				source.files["realm.json"] = []byte(tt.realm)
+			}
+
+			version, err := newTestService(source).getGameVersion()
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", version)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if version != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, version)
+			}
+		})
+	}
+}
+
+func TestRefreshRealm(t *testing.T) {
+	source := &fakeSource{files: map[string][]byte{"realm.json": []byte(`{"game_version": "1.13c"}`)}}
+	s := newTestService(source)
+
+	if version, _ := s.getGameVersion(); version != "1.13c" {
+		t.Fatalf("expected 1.13c, got %s", version)
+	}
+
+	// The realm changes while the launcher is open.
+	source.mux.Lock()
+	source.files["realm.json"] = []byte(`{"game_version": "1.14d"}`)
+	source.mux.Unlock()
+
+	// The run that already started keeps the version it started with.
+	if version, _ := s.getGameVersion(); version != "1.13c" {
+		t.Fatalf("expected 1.13c within the same run, got %s", version)
+	}
+
+	// The next run follows the realm.
+	s.refreshRealm()
+
+	if version, _ := s.getGameVersion(); version != "1.14d" {
+		t.Fatalf("expected 1.14d after refreshing, got %s", version)
+	}
+}
+
+func TestGetRealmConcurrent(t *testing.T) {
+	source := &fakeSource{files: map[string][]byte{"realm.json": []byte(`{"game_version": "1.14d"}`)}}
+	s := newTestService(source)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(refresh bool) {
+			defer wg.Done()
+
+			if refresh {
+				s.refreshRealm()
+			}
+
+			if version, err := s.getGameVersion(); err != nil || version != "1.14d" {
+				t.Errorf("expected 1.14d, got %s: %v", version, err)
+			}
+		}(i%2 == 0)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,228 @@
+package d2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/clients/hiddengamersdiablo"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// quarantineDir is where unknown files are moved to, in the game directory.
+const quarantineDir = ".hiddengamers/quarantine"
+
+// rogueExtensions are the kinds of files the game loads, unknown ones might get the player banned.
+var rogueExtensions = []string{".dll", ".exe"}
+
+// AllowedFiles are the executables and libraries the server allows in a game
+// install, on top of the ones in the manifests.
+type AllowedFiles struct {
+	// Files are file name patterns, such as "Game.exe" or "glide3x*.dll".
+	Files []string `json:"files"`
+}
+
+// RogueFile is an executable or library in a game install that the launcher doesn't know about,
+// such as leftovers from other maphacks.
+type RogueFile struct {
+	GameID   string `json:"game_id"`
+	Location string `json:"location"`
+	Name     string `json:"name"`
+	CRC      string `json:"crc"`
+}
+
+// RogueFiles returns the unknown files found in the games by the last validation.
+func (s *service) RogueFiles() []RogueFile {
+	s.rogueMux.Lock()
+	defer s.rogueMux.Unlock()
+
+	return append([]RogueFile{}, s.rogueFiles...)
+}
+
+// QuarantineRogueFiles will move the unknown files found by the last validation
+// out of the way, into the quarantine directory of each game.
+func (s *service) QuarantineRogueFiles() error {
+	for _, f := range s.RogueFiles() {
+		if err := quarantineFile(f.Location, f.Name); err != nil {
+			return err
+		}
+
+		s.logger.Info(fmt.Sprintf("%s movido a cuarentena en %s", f.Name, f.Location))
+	}
+
+	s.rogueMux.Lock()
+	s.rogueFiles = nil
+	s.rogueMux.Unlock()
+
+	return nil
+}
+
+// scanRogueFiles will look for unknown executables and libraries in every game and
+// add them to the patch file model, they're kept until the next validation.
+func (s *service) scanRogueFiles(games []storage.Game, manifests []*Manifest, mods *config.GameMods, modManifests map[string]*Manifest) error {
+	s.rogueMux.Lock()
+	s.rogueFiles = nil
+	s.rogueMux.Unlock()
+
+	allowed, err := s.getAllowedFiles()
+	if err != nil {
+		return err
+	}
+
+	known, err := s.getKnownFiles(manifests, mods, modManifests)
+	if err != nil {
+		return err
+	}
+
+	var rogue []RogueFile
+	for i := range games {
+		found, err := s.findRogueFiles(&games[i], known, allowed.Files)
+		if err != nil {
+			return err
+		}
+
+		rogue = append(rogue, found...)
+	}
+
+	actions := make([]PatchAction, 0, len(rogue))
+	for _, f := range rogue {
+		actions = append(actions, PatchAction{
+			Action:   ActionUnknown,
+			File:     PatchFile{Name: f.Name},
+			LocalCRC: f.CRC,
+			D2Path:   f.Location,
+		})
+	}
+
+	s.addFilesToModel(actions)
+
+	s.rogueMux.Lock()
+	s.rogueFiles = rogue
+	s.rogueMux.Unlock()
+
+	return nil
+}
+
+// findRogueFiles returns the executables and libraries in the top level of the game directory that
+// aren't known. Files installed from packages, or protected by the user, are known too.
+func (s *service) findRogueFiles(game *storage.Game, known map[string]bool, allowed []string) ([]RogueFile, error) {
+	files, err := ioutil.ReadDir(localizePath(game.Location))
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := append(patchProtectedPatterns(game), allowed...)
+
+	var rogue []RogueFile
+	for _, f := range files {
+		if f.IsDir() || !hasRogueExtension(f.Name()) {
+			continue
+		}
+
+		if known[strings.ToLower(f.Name())] || isProtected(f.Name(), patterns) {
+			continue
+		}
+
+		hashed, err := s.hashGameFile(game.Location, f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		rogue = append(rogue, RogueFile{
+			GameID:   game.ID,
+			Location: game.Location,
+			Name:     f.Name(),
+			CRC:      hashed,
+		})
+	}
+
+	return rogue, nil
+}
+
+// getKnownFiles returns the lower case names of the files in the given manifests and in the
+// manifests of every version of every mod, reusing the mod manifests already downloaded.
+func (s *service) getKnownFiles(manifests []*Manifest, mods *config.GameMods, modManifests map[string]*Manifest) (map[string]bool, error) {
+	known := make(map[string]bool)
+
+	add := func(m *Manifest) {
+		for _, f := range m.Files {
+			known[strings.ToLower(f.Name)] = true
+		}
+	}
+
+	for _, m := range manifests {
+		add(m)
+	}
+
+	for _, mod := range mods.All() {
+		for _, version := range mod.Versions {
+			m, err := s.getModManifest(mod, version, modManifests)
+			if err != nil {
+				return nil, err
+			}
+
+			add(m)
+		}
+	}
+
+	return known, nil
+}
+
+// getAllowedFiles will fetch the allow list from the server, a server that doesn't
+// publish one allows nothing but the files in the manifests.
+func (s *service) getAllowedFiles() (*AllowedFiles, error) {
+	contents, err := s.hiddengamersdiabloClient.GetAllowedFiles()
+	if err == hiddengamersdiablo.ErrNotFound {
+		return &AllowedFiles{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer contents.Close()
+
+	bytes, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed AllowedFiles
+	if err := json.Unmarshal(bytes, &allowed); err != nil {
+		return nil, err
+	}
+
+	return &allowed, nil
+}
+
+// quarantineFile will move the file into the quarantine directory of the game,
+// a file already quarantined with the same name is kept.
+func quarantineFile(location string, name string) error {
+	dir := GameFilePath(location, quarantineDir)
+	if err := os.MkdirAll(dir, storage.Permissions); err != nil {
+		return err
+	}
+
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		target = fmt.Sprintf("%s.%s", target, time.Now().Format("20060102150405"))
+	}
+
+	return os.Rename(GameFilePath(location, name), target)
+}
+
+func hasRogueExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range rogueExtensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
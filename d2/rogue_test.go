@@ -0,0 +1,135 @@
+package d2
+
+import (
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+func TestGetAllowedFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		want  []string
+	}{
+		{
+			name:  "published",
+			files: map[string][]byte{"allowed_files.json": []byte(`{"files": ["glide3x*.dll"]}`)},
+			want:  []string{"glide3x*.dll"},
+		},
+		{
+			name:  "not published",
+			files: nil,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&fakeSource{files: tt.files})
+
+			allowed, err := s.getAllowedFiles()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(allowed.Files) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, allowed.Files)
+			}
+
+			for i := range tt.want {
+				if allowed.Files[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, allowed.Files)
+				}
+			}
+		})
+	}
+}
+
+func TestGetKnownFilesReusesManifests(t *testing.T) {
+	source := &fakeSource{files: map[string][]byte{
+		"maphack_1.0/manifest.json": []byte(`{"files": [{"name": "BH.dll"}]}`),
+		"maphack_1.1/manifest.json": []byte(`{"files": [{"name": "BH.dll"}, {"name": "BH_Injector.exe"}]}`),
+	}}
+
+	s := newTestService(source)
+	mods := &config.GameMods{Mods: []config.Mod{
+		{Name: "maphack", RemoteDir: "maphack_{version}", Versions: []string{"1.0", "1.1"}},
+	}}
+
+	// The validation already downloaded the manifest of the chosen version.
+	modManifests := map[string]*Manifest{
+		"maphack_1.0": {Files: []PatchFile{{Name: "BH.dll"}, {Name: "Old.dll"}}},
+	}
+
+	base := []*Manifest{{Files: []PatchFile{{Name: "Game.exe"}}}}
+
+	for i := 0; i < 2; i++ {
+		known, err := s.getKnownFiles(base, mods, modManifests)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		for _, name := range []string{"game.exe", "bh.dll", "old.dll", "bh_injector.exe"} {
+			if !known[name] {
+				t.Fatalf("expected %s to be known, got %v", name, known)
+			}
+		}
+	}
+
+	// Only the missing manifest is downloaded, and only once.
+	if len(source.fetched) != 1 || source.fetched[0] != "maphack_1.1/manifest.json" {
+		t.Fatalf("expected a single manifest to be downloaded, got %v", source.fetched)
+	}
+}
+
+func TestFindRogueFiles(t *testing.T) {
+	location := newTestGame(t, map[string]string{
+		"Game.exe":     "game",
+		"glide3x.dll":  "glide",
+		"BH.dll":       "maphack",
+		"Patch_D2.mpq": "patch",
+	})
+
+	game := &storage.Game{ID: "game", Location: location}
+	known := map[string]bool{"game.exe": true}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		want    map[string]bool
+	}{
+		{
+			name:    "allow list",
+			allowed: []string{"glide3x*.dll"},
+			want:    map[string]bool{"BH.dll": true},
+		},
+		{
+			name:    "no allow list",
+			allowed: nil,
+			want:    map[string]bool{"BH.dll": true, "glide3x.dll": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&fakeSource{})
+
+			rogue, err := s.findRogueFiles(game, known, tt.allowed)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(rogue) != len(tt.want) {
+				t.Fatalf("expected %v, got %+v", tt.want, rogue)
+			}
+
+			for _, f := range rogue {
+				if !tt.want[f.Name] {
+					t.Fatalf("expected %v, got %+v", tt.want, rogue)
+				}
+			}
+		})
+	}
+}
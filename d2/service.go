@@ -1,13 +1,15 @@
 package d2
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -33,18 +35,67 @@ type Service interface {
 
 	// SetLaunchDelay is responsible for setting the delay between each game launch.
 	SetLaunchDelay(delay int) error
+
+	// SetDownloadRateLimit is responsible for limiting the download speed in KB/s while patching.
+	SetDownloadRateLimit(limit int) error
+
+	// InstallPackage will install a local mod package from a zip archive into a game.
+	InstallPackage(gameID string, archive string) error
+
+	// UninstallPackage will remove an installed local mod package from a game.
+	UninstallPackage(gameID string, name string) error
+
+	// ListPackages returns the local mod packages installed in a game.
+	ListPackages(gameID string) ([]storage.Package, error)
+
+	// Verify will hash every file tracked in the games and report the ones that aren't as expected.
+	Verify() ([]VerifyReport, error)
+
+	// Repair will fix the broken files found by Verify.
+	Repair(reports []VerifyReport, done chan bool) (<-chan float32, <-chan PatchState)
+
+	// RogueFiles returns the unknown executables and libraries found in the games by the last validation.
+	RogueFiles() []RogueFile
+
+	// QuarantineRogueFiles will move the unknown files found by the last validation out of the games.
+	QuarantineRogueFiles() error
+
+	// CloneGame will copy the install of the game into the target directory and add it as a new game.
+	CloneGame(gameID string, target string, done chan bool) (<-chan float32, <-chan PatchState)
+
+	// BootstrapGame will create a new install from the MPQs of the original installers and add it as a new game.
+	BootstrapGame(source string, target string, done chan bool) (<-chan float32, <-chan PatchState)
+}
+
+// patchSource is where the patches, manifests and mod lists are fetched from, the HiddenGamers server.
+type patchSource interface {
+	GetFile(filePath string) (io.ReadCloser, error)
+	GetAvailableMods() (io.ReadCloser, error)
+	GetAllowedFiles() (io.ReadCloser, error)
+	GetRealm() (io.ReadCloser, error)
 }
 
 // Service is responsible for all things related to Diablo II.
 type service struct {
-	hiddengamersdiabloClient hiddengamersdiablo.Client
+	hiddengamersdiabloClient patchSource
 	configService            config.Service
 	logger                   log.Logger
 	gameStates               chan execState
 	availableMods            *config.GameMods
+	realm                    *Realm
+	realmMux                 sync.Mutex
 	runningGames             []game
 	mux                      sync.Mutex
 	patchFileModel           *FileModel
+	limiter                  *rateLimiter
+
+	// Hash indexes by install location.
+	hashIndexes map[string]*hashIndex
+	hashMux     sync.Mutex
+
+	// Unknown files found by the last validation.
+	rogueFiles []RogueFile
+	rogueMux   sync.Mutex
 }
 
 type game struct {
@@ -138,8 +189,11 @@ func (s *service) ValidateGameVersions() (bool, error) {
 		return false, err
 	}
 
-	// Get current slash patch and compare.
-	version113cManifest, err := s.getManifest("1.13c/manifest.json")
+	// Follow the realm settings published right now.
+	s.refreshRealm()
+
+	// Get the game version required by the realm and compare.
+	gameVersion, versionManifest, err := s.getVersionManifest()
 	if err != nil {
 		return false, err
 	}
@@ -157,66 +211,113 @@ func (s *service) ValidateGameVersions() (bool, error) {
 
 	upToDate := true
 
+	// Map of mod manifests by remote directory, so we don't have to download them for every game.
+	modManifests := make(map[string]*Manifest)
+
+	// Keep what's been hashed for the next time.
+	defer s.saveHashIndexes()
+
+	// Hash the files of every install in parallel before checking them one by one.
+	installs := make([]gameFiles, 0, len(conf.Games))
+	for _, game := range conf.Games {
+		installs = append(installs, gameFiles{
+			location: game.Location,
+			names:    patchFileNames(versionManifest.Files, slashManifest.Files),
+		})
+	}
+
+	s.prehash(installs, false)
+
 	if len(conf.Games) > 0 {
 		for _, game := range conf.Games {
-			valid, err := validate113cVersion(game.Location)
+			// Files the user has chosen to keep their own copy of, and the ones installed from packages.
+			protected := patchProtectedPatterns(&game)
+
+			valid, err := validateGameVersion(game.Location, gameVersion)
 			if err != nil {
 				return false, err
 			}
 
-			// Game wasn't 1.13c, needs to be updated.
+			// Game wasn't the required version, needs to be upgraded or downgraded.
 			if !valid {
 				upToDate = false
 				// Get files that aren't up to date and add them to the file model.
-				version113cFiles, _, err := s.getFilesToPatch(version113cManifest.Files, game.Location, nil)
+				versionFiles, _, err := s.getFilesToPatch(versionManifest.Files, game.Location, protected)
 				if err != nil {
 					return false, err
 				}
 
-				s.addFilesToModel(version113cFiles)
+				s.addFilesToModel(versionFiles)
+
+				if err := s.addProtectedFilesToModel(versionManifest.Files, game.Location, protected); err != nil {
+					return false, err
+				}
 			}
 
 			// Check if the current game install is up to date with the slash patch.
-			slashFiles, _, err := s.getFilesToPatch(slashManifest.Files, game.Location, nil)
+			slashFiles, _, err := s.getFilesToPatch(slashManifest.Files, game.Location, protected)
 			if err != nil {
 				return false, err
 			}
 
+			if err := s.addProtectedFilesToModel(slashManifest.Files, game.Location, protected); err != nil {
+				return false, err
+			}
+
 			// Slash patch isn't up to date.
 			if len(slashFiles) > 0 {
 				s.addFilesToModel(slashFiles)
 				upToDate = false
 			}
 
-			validMaphack, err := s.validateMaphackVersion(&game, mods.Maphack)
-			if err != nil {
+			// Make sure the chosen mods work together and with the game version.
+			issues := mods.CheckGame(&game, gameVersion)
+			if err := config.IssuesError(issues); err != nil {
 				return false, err
 			}
 
-			// Maphack version wasn't valid, we need to update.
-			if !validMaphack {
-				upToDate = false
+			for _, issue := range issues {
+				s.logger.Info(issue.Reason)
 			}
 
-			validHD, err := s.validateHDVersion(&game, mods.HD)
+			// Make sure every mod is installed in the chosen version.
+			for _, mod := range mods.All() {
+				valid, err := s.validateMod(&game, mod, modManifests)
+				if err != nil {
+					return false, err
+				}
+
+				// Mod version wasn't valid, we need to update.
+				if !valid {
+					upToDate = false
+				}
+			}
+
+			// Make sure the HD settings chosen by the user are in place.
+			valid, err = s.validateHDSettings(&game)
 			if err != nil {
 				return false, err
 			}
 
-			// HD version wasn't valid, we need to update.
-			if !validHD {
+			if !valid {
 				upToDate = false
 			}
 		}
 	}
 
-	// Games are both 1.13c and up to date with Slash patch, maphack and HD.
+	// Look for files that might get the player banned, the scan is only a warning
+	// so the game can still be patched and launched if it fails.
+	if err := s.scanRogueFiles(conf.Games, []*Manifest{versionManifest, slashManifest}, mods, modManifests); err != nil {
+		s.logger.Error(fmt.Errorf("no se pudieron buscar archivos desconocidos: %s", err))
+	}
+
+	// Games are both the required version and up to date with Slash patch and mods.
 	return upToDate, nil
 }
 
-func (s *service) resetPatch(path string, files []PatchFile, filesToIgnore []string) error {
+func (s *service) resetPatch(path string, files []PatchFile, protected []string) error {
 	// Check how many files aren't up to date.
-	missmatchedFiles, _, err := s.getFilesToPatch(files, path, filesToIgnore)
+	missmatchedFiles, _, err := s.getFilesToPatch(files, path, protected)
 	if err != nil {
 		return err
 	}
@@ -225,10 +326,13 @@ func (s *service) resetPatch(path string, files []PatchFile, filesToIgnore []str
 	// some of them left that needs to be removed.
 	if len(missmatchedFiles) != len(files) {
 		for _, file := range files {
-			filePath := localizePath(fmt.Sprintf("%s/%s", path, file.Name))
+			filePath, err := gameFile(path, file.Name)
+			if err != nil {
+				return err
+			}
 
 			// Check if the file exists, on disk, if it does, remove it.
-			_, err := os.Stat(filePath)
+			_, err = os.Stat(filePath)
 			if err != nil {
 				// File didn't exist on disk, continue to next.
 				if os.IsNotExist(err) {
@@ -238,22 +342,18 @@ func (s *service) resetPatch(path string, files []PatchFile, filesToIgnore []str
 				return err
 			}
 
-			// Make sure we don't remove the ignored files.
-			var ignore bool
-
-			for _, ignored := range filesToIgnore {
-				if file.Name == ignored {
-					ignore = true
-					break
-				}
-			}
-
-			if !ignore {
+			// Make sure we don't remove the protected files.
+			if !isProtected(file.Name, protected) {
 				// File that shouldn't be on disk exists, remove it.
 				err = os.Remove(filePath)
 				if err != nil {
 					return err
 				}
+
+				// Don't leave the directories of the file behind.
+				if err := removeEmptyDirs(path, file.Name); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -261,183 +361,116 @@ func (s *service) resetPatch(path string, files []PatchFile, filesToIgnore []str
 	return nil
 }
 
-func (s *service) resetHDPatch(game storage.Game) error {
-	mods, err := s.getAvailableMods()
-	if err != nil {
-		return err
-	}
-
-	// Go over available HD mods and reset them if they are installed.
-	for _, m := range mods.HD {
-		// Desired version, don't reset it.
-		if game.HDVersion == m {
-			continue
-		}
-
-		HDManifest, err := s.getManifest(fmt.Sprintf("hd_%s/manifest.json", m))
-		if err != nil {
-			return err
-		}
+// Patch will check for updates and if found, patch the game, both D2 and the mods.
+func (s *service) Patch(done chan bool) (<-chan float32, <-chan PatchState) {
+	// Progress is buffered so the downloader can publish without waiting on the UI.
+	progress := make(chan float32, 1)
+	state := make(chan PatchState)
 
-		installed, err := isModInstalled(game.Location, ModHDIdentifier, HDManifest)
+	go func() {
+		conf, err := s.configService.Read()
 		if err != nil {
-			return err
-		}
-
-		if installed {
-			err := s.resetPatch(game.Location, HDManifest.Files, nil)
-			if err != nil {
-				return err
-			}
+			state <- PatchState{Error: err}
+			return
 		}
-	}
-
-	return nil
-}
 
-func (s *service) resetMaphackPatch(game storage.Game, filesToIgnore []string) error {
-	mods, err := s.getAvailableMods()
-	if err != nil {
-		return err
-	}
+		// Apply the download rate limit set by the user.
+		s.limiter.SetRate(int64(conf.DownloadRateLimit) * 1024)
 
-	// Go over available maphack versions and reset them if they are installed.
-	for _, m := range mods.Maphack {
-		// Desired version, don't reset it.
-		if game.MaphackVersion == m {
-			continue
-		}
+		// Follow the realm settings published right now.
+		s.refreshRealm()
 
-		maphackManifest, err := s.getManifest(fmt.Sprintf("maphack_%s/manifest.json", m))
+		mods, err := s.getAvailableMods()
 		if err != nil {
-			return err
+			state <- PatchState{Error: err}
+			return
 		}
 
-		installed, err := isModInstalled(game.Location, ModMaphackIdentifier, maphackManifest)
+		gameVersion, err := s.getGameVersion()
 		if err != nil {
-			return err
-		}
-
-		if installed {
-			err := s.resetPatch(game.Location, maphackManifest.Files, filesToIgnore)
-			if err != nil {
-				return err
-			}
+			state <- PatchState{Error: err}
+			return
 		}
-	}
 
-	return nil
-}
+		// Map of mod manifests by remote directory, so we don't have to download them twice.
+		var modManifests = make(map[string]*Manifest, 0)
 
-// Patch will check for updates and if found, patch the game, both D2 and HD version.
-func (s *service) Patch(done chan bool) (<-chan float32, <-chan PatchState) {
-	progress := make(chan float32)
-	state := make(chan PatchState)
+		// Keep what's been hashed for the next time.
+		defer s.saveHashIndexes()
 
-	go func() {
-		conf, err := s.configService.Read()
-		if err != nil {
+		// Fail before downloading anything if an install doesn't have room for the patch.
+		if err := s.checkDiskSpace(conf.Games, mods, modManifests); err != nil {
 			state <- PatchState{Error: err}
 			return
 		}
 
-		// Map of HD manifests, so we don't have to download them twice.
-		var hdManifests = make(map[string]*Manifest, 0)
-
-		// Map of maphack manifests, so we don't have to download them twice.
-		var maphackManifests = make(map[string]*Manifest, 0)
-
 		for _, game := range conf.Games {
-			// If the user has chosen to override the maphack config with their own,
-			// we need to make sure the config is being ignored from the patch, and also
-			// when reseting the maphack patch.
-			var ignoredMaphackFiles []string
-
-			if game.OverrideBHCfg {
-				ignoredMaphackFiles = append(ignoredMaphackFiles, "BH.cfg")
-			}
-
-			// Reset the maphack versions, to avoid rogue files and duplicates.
-			err := s.resetMaphackPatch(game, ignoredMaphackFiles)
-			if err != nil {
+			// Make sure the chosen mods can be installed together.
+			if err := config.IssuesError(mods.CheckGame(&game, gameVersion)); err != nil {
 				state <- PatchState{Error: err}
 				return
 			}
 
-			// Reset the HD versions, to avoid rogue files and duplicates.
-			err = s.resetHDPatch(game)
-			if err != nil {
-				state <- PatchState{Error: err}
-				return
+			// Reset the mod versions, to avoid rogue files and duplicates.
+			for _, mod := range mods.All() {
+				if err := s.resetMod(game, mod); err != nil {
+					state <- PatchState{Error: err}
+					return
+				}
 			}
 
-			// The install has been reset, let's validate the 1.13c version and apply missing files.
-			if err := s.apply113c(game.Location, state, progress); err != nil {
+			// The install has been reset, let's validate the game version and apply missing files.
+			if err := s.applyGameVersion(game.Location, patchProtectedPatterns(&game), state, progress); err != nil {
 				state <- PatchState{Error: err}
 				return
 			}
 
 			// Apply the Slashdiablo specific patch.
-			err = s.applySlashPatch(game.Location, state, progress)
+			err = s.applySlashPatch(game.Location, patchProtectedPatterns(&game), state, progress)
 			if err != nil {
 				state <- PatchState{Error: err}
 				return
 			}
 
-			// Maphack version was set on the game, download it.
-			if game.MaphackVersion != config.ModVersionNone {
-				mm, ok := maphackManifests[game.MaphackVersion]
-				if !ok {
-					maphackManifest, err := s.getManifest(fmt.Sprintf("maphack_%s/manifest.json", game.MaphackVersion))
-					if err != nil {
-						state <- PatchState{Error: err}
-						return
-					}
-
-					maphackManifests[game.MaphackVersion] = maphackManifest
-					mm = maphackManifest
+			// Apply every mod chosen for the game, in order.
+			for _, mod := range mods.All() {
+				version := game.ModVersion(mod.Name)
+				if !config.ModEnabled(version) {
+					continue
 				}
 
-				// Just to be safe and avoid a panic.
-				if maphackManifests[game.MaphackVersion] == nil {
-					state <- PatchState{Error: errors.New("no hay manifest del mh")}
-					return
-				}
+				remoteDir := mod.RemoteDirFor(version)
 
-				err = s.applyMaphack(game.Location, game.MaphackVersion, state, progress, mm.Files, ignoredMaphackFiles)
-				if err != nil {
-					state <- PatchState{Error: err}
-					return
-				}
-			}
-
-			// HD version was set on the game, download it.
-			if game.HDVersion != config.ModVersionNone {
-				hdm, ok := hdManifests[game.HDVersion]
+				manifest, ok := modManifests[remoteDir]
 				if !ok {
-					hdManifest, err := s.getManifest(fmt.Sprintf("hd_%s/manifest.json", game.HDVersion))
+					manifest, err = s.getManifest(modManifestPath(mod, version))
 					if err != nil {
 						state <- PatchState{Error: err}
 						return
 					}
 
-					hdManifests[game.HDVersion] = hdManifest
-					hdm = hdManifest
+					modManifests[remoteDir] = manifest
 				}
 
 				// Just to be safe and avoid a panic.
-				if hdManifests[game.HDVersion] == nil {
-					state <- PatchState{Error: errors.New("no hay manifest del hd")}
+				if manifest == nil {
+					state <- PatchState{Error: fmt.Errorf("no hay manifest del mod %s", mod.Name)}
 					return
 				}
 
-				err = s.applyHDMod(game.Location, game.HDVersion, state, progress, hdm.Files)
+				err = s.applyMod(&game, mod, version, state, progress, manifest.Files)
 				if err != nil {
 					state <- PatchState{Error: err}
 					return
 				}
 			}
 
+			// The HD mod files are in place, write the user's settings to them.
+			if err := s.applyHDSettings(&game, state); err != nil {
+				state <- PatchState{Error: err}
+				return
+			}
+
 			// Finally set os specific configurations, such as compatibility mode.
 			err = configureForOS(game.Location)
 			if err != nil {
@@ -469,6 +502,24 @@ func (s *service) SetLaunchDelay(delay int) error {
 	return nil
 }
 
+// SetDownloadRateLimit will set the given download rate limit in KB/s, 0 means unlimited.
+func (s *service) SetDownloadRateLimit(limit int) error {
+	if limit < 0 {
+		return errors.New("el limite de descarga no puede ser negativo")
+	}
+
+	// Set download rate limit in the config.
+	err := s.configService.UpdateDownloadRateLimit(limit)
+	if err != nil {
+		return err
+	}
+
+	// Apply it to any download currently running.
+	s.limiter.SetRate(int64(limit) * 1024)
+
+	return nil
+}
+
 func (s *service) mutateInstancesToLaunch(games []storage.Game) {
 	for i := 0; i < len(games); i++ {
 		var runningCount int
@@ -507,119 +558,25 @@ func (s *service) listenForGameStates() {
 	}
 }
 
-func (s *service) validateMaphackVersion(game *storage.Game, versions []string) (bool, error) {
-	isValid := true
-
-	for _, v := range versions {
-		manifest, err := s.getManifest(fmt.Sprintf("maphack_%s/manifest.json", v))
-		if err != nil {
-			return false, err
-		}
-
-		// If the user has chosen to override the maphack config with their own,
-		// we need to make sure the config is being ignored from the patch.
-		var ignoredMaphackFiles []string
-
-		if game.OverrideBHCfg {
-			ignoredMaphackFiles = append(ignoredMaphackFiles, "BH.cfg")
-		}
-		// This particular maphack version should be installed.
-		if game.MaphackVersion == v {
-			// Check how many files aren't up to date with maphack.
-			missingMaphackFiles, _, err := s.getFilesToPatch(manifest.Files, game.Location, ignoredMaphackFiles)
-			if err != nil {
-				return false, err
-			}
-
-			// Maphack patch isn't up to date.
-			if len(missingMaphackFiles) > 0 {
-				s.addFilesToModel(missingMaphackFiles)
-				isValid = false
-			}
-		} else {
-			installed, err := isModInstalled(game.Location, ModMaphackIdentifier, manifest)
-			if err != nil {
-				return false, err
-			}
-
-			// Maphack wasn't supposed to be installed, but it is, we need to update.
-			if installed {
-				// Before we return, we need to add these to the patch actions, since they will be removed.
-				err := s.addPatchFilesToBeDeleted(game.Location, manifest.Files)
-				if err != nil {
-					return false, err
-				}
-
-				isValid = false
-			}
-		}
-	}
-
-	return isValid, nil
-}
-
-func (s *service) validateHDVersion(game *storage.Game, versions []string) (bool, error) {
-	isValid := true
-
-	for _, v := range versions {
-		manifest, err := s.getManifest(fmt.Sprintf("hd_%s/manifest.json", v))
-		if err != nil {
-			return false, err
-		}
-
-		// This particular HD version should be installed.
-		if game.HDVersion == v {
-			// Check if the current game install is up to date with the HD patch.
-			missingFiles, _, err := s.getFilesToPatch(manifest.Files, game.Location, nil)
-			if err != nil {
-				return false, err
-			}
-
-			// HD mod isn't up to date.
-			if len(missingFiles) > 0 {
-				s.addFilesToModel(missingFiles)
-				isValid = false
-			}
-		} else {
-			installed, err := isModInstalled(game.Location, ModHDIdentifier, manifest)
-			if err != nil {
-				return false, err
-			}
-
-			// HD wasn't supposed to be installed, but it is, we need to update.
-			if installed {
-				// Before we return, we need to add these to the patch actions, since they will be removed.
-				err := s.addPatchFilesToBeDeleted(game.Location, manifest.Files)
-				if err != nil {
-					return false, err
-				}
-
-				isValid = false
-			}
-		}
-	}
-
-	return isValid, nil
-}
-
-func (s *service) apply113c(path string, state chan PatchState, progress chan float32) error {
+// applyGameVersion will upgrade or downgrade the install to the game version required by the realm.
+func (s *service) applyGameVersion(path string, protected []string, state chan PatchState, progress chan float32) error {
 	state <- PatchState{Message: "Comprobando version del juego..."}
 
-	// Download manifest from patch repository.
-	manifest, err := s.getManifest("1.13c/manifest.json")
+	// Download manifest of the version from patch repository.
+	version, manifest, err := s.getVersionManifest()
 	if err != nil {
 		return err
 	}
 
 	// Figure out which files to patch.
-	patchFiles, patchLength, err := s.getFilesToPatch(manifest.Files, path, nil)
+	patchFiles, patchLength, err := s.getFilesToPatch(manifest.Files, path, protected)
 	if err != nil {
 		return err
 	}
 
 	if len(patchFiles) > 0 {
-		state <- PatchState{Message: fmt.Sprintf("Actualizando %s a 1.13c", path)}
-		if err := s.doPatch(patchFiles, patchLength, "1.13c", path, progress); err != nil {
+		state <- PatchState{Message: fmt.Sprintf("Actualizando %s a %s", path, version)}
+		if err := s.doPatch(patchFiles, patchLength, version, path, progress); err != nil {
 			patchErr := err
 			// Make sure we clean up the failed patch.
 			if err := s.cleanUpFailedPatch(path); err != nil {
@@ -633,7 +590,7 @@ func (s *service) apply113c(path string, state chan PatchState, progress chan fl
 	return nil
 }
 
-func (s *service) applySlashPatch(path string, state chan PatchState, progress chan float32) error {
+func (s *service) applySlashPatch(path string, protected []string, state chan PatchState, progress chan float32) error {
 	state <- PatchState{Message: "Comprobando parche de HiddenGamers Diablo..."}
 
 	// Download manifest from patch repository.
@@ -643,7 +600,7 @@ func (s *service) applySlashPatch(path string, state chan PatchState, progress c
 	}
 
 	// Figure out which files to patch.
-	patchFiles, patchLength, err := s.getFilesToPatch(manifest.Files, path, nil)
+	patchFiles, patchLength, err := s.getFilesToPatch(manifest.Files, path, protected)
 	if err != nil {
 		return err
 	}
@@ -665,74 +622,13 @@ func (s *service) applySlashPatch(path string, state chan PatchState, progress c
 	return nil
 }
 
-func (s *service) applyMaphack(path string, version string, state chan PatchState, progress chan float32, manifestFiles []PatchFile, ignoredFiles []string) error {
-	state <- PatchState{Message: "Comprobando version del Maphack.."}
-
-	// Figure out which files to patch.
-	patchFiles, patchLength, err := s.getFilesToPatch(manifestFiles, path, ignoredFiles)
-	if err != nil {
-		return err
-	}
-
-	if len(patchFiles) > 0 {
-		state <- PatchState{Message: fmt.Sprintf("Actualizando %s a la version del maphack %s", path, version)}
-
-		remoteDir := fmt.Sprintf("maphack_%s", version)
-
-		if err = s.doPatch(patchFiles, patchLength, remoteDir, path, progress); err != nil {
-			patchErr := err
-			// Make sure we clean up the failed patch.
-			if err := s.cleanUpFailedPatch(path); err != nil {
-				return fmt.Errorf("Error de limpieza: %s : %s", patchErr, err)
-			}
-
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (s *service) applyHDMod(path string, version string, state chan PatchState, progress chan float32, manifestFiles []PatchFile) error {
-	// Update UI.
-	state <- PatchState{Message: "Comprobando version del Mod HD..."}
-
-	// Figure out which files to patch.
-	patchFiles, patchLength, err := s.getFilesToPatch(manifestFiles, path, nil)
-	if err != nil {
-		return err
-	}
-
-	if len(patchFiles) > 0 {
-		// Update UI.
-		state <- PatchState{Message: fmt.Sprintf("Actualizando %s la version %s del mod HD", path, version)}
-
-		remoteDir := fmt.Sprintf("hd_%s", version)
-
-		if err = s.doPatch(patchFiles, patchLength, remoteDir, path, progress); err != nil {
-			patchErr := err
-			// Make sure we clean up the failed patch.
-			if err := s.cleanUpFailedPatch(path); err != nil {
-				return fmt.Errorf("Error de limpieza: %s : %s", patchErr, err)
-			}
-
-			return err
-		}
-	}
-
-	return nil
-}
-
 func (s *service) doPatch(patchFiles []PatchAction, patchLength int64, remoteDir string, path string, progress chan float32) error {
-	// Reset progress.
-	progress <- 0.00
-
 	// Create a write counter that will get bytes written per cycle, pass the
 	// progress channel to report the number of bytes written.
-	counter := &WriteCounter{
-		Total:    float32(patchLength),
-		progress: progress,
-	}
+	counter := NewWriteCounter(patchLength, progress)
+
+	// Reset progress.
+	counter.publish(0)
 
 	// Store the downloaded .tmp suffixed files.
 	var tmpFiles []string
@@ -741,11 +637,34 @@ func (s *service) doPatch(patchFiles []PatchAction, patchLength int64, remoteDir
 	for _, action := range patchFiles {
 		// Create the file, but give it a tmp file extension, this means we won't overwrite a
 		// file until it's downloaded, but we'll remove the tmp extension once downloaded.
-		tmpPath := localizePath(fmt.Sprintf("%s/%s.tmp", path, action.File.Name))
+		filePath, err := gameFile(path, action.File.Name)
+		if err != nil {
+			return err
+		}
+
+		tmpPath := fmt.Sprintf("%s.tmp", filePath)
 
 		switch action.Action {
 		case ActionDownload:
-			err := s.downloadFile(action.File.Name, remoteDir, tmpPath, counter)
+			// Files can be in subdirectories of the game, they're only created once the name is known to be safe.
+			if err := os.MkdirAll(filepath.Dir(tmpPath), storage.Permissions); err != nil {
+				return err
+			}
+
+			// The local file can be patched with a delta, which is a lot smaller than the full file.
+			if action.Delta != nil {
+				err := s.downloadDelta(action, remoteDir, path, tmpPath, counter)
+				if err == nil {
+					tmpFiles = append(tmpFiles, tmpPath)
+					break
+				}
+
+				// Delta couldn't be applied, fall back to downloading the full file.
+				s.logger.Error(fmt.Errorf("Error al aplicar delta de %s: %s", action.File.Name, err))
+				counter.addTotal(action.File.downloadLength())
+			}
+
+			err := s.downloadFile(action.File, remoteDir, tmpPath, counter)
 			if err != nil {
 				return err
 			}
@@ -770,7 +689,7 @@ func (s *service) doPatch(patchFiles []PatchAction, patchLength int64, remoteDir
 	return nil
 }
 
-func (s *service) downloadFile(fileName string, remoteDir string, path string, counter *WriteCounter) error {
+func (s *service) downloadFile(file PatchFile, remoteDir string, path string, counter *WriteCounter) error {
 	out, err := os.Create(path)
 	if err != nil {
 		return err
@@ -778,24 +697,128 @@ func (s *service) downloadFile(fileName string, remoteDir string, path string, c
 
 	defer out.Close()
 
+	// Prefer the compressed variant of the file if there is one.
+	compressed := file.Compressed != nil && file.Compressed.supported()
+
+	fileName := file.Name
+	if compressed {
+		fileName = file.Compressed.Name
+	}
+
 	f := fmt.Sprintf("%s/%s", remoteDir, fileName)
 	contents, err := s.hiddengamersdiabloClient.GetFile(f)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(out, io.TeeReader(contents, counter))
+	defer contents.Close()
+
+	// Limit the download speed, the limiter is shared between all downloads.
+	limited := newRateLimitedReader(contents, s.limiter)
+
+	// Progress is measured on the bytes transferred.
+	reader := io.TeeReader(limited, counter)
+
+	if !compressed {
+		_, err = io.Copy(out, reader)
+		return err
+	}
+
+	// Decompress the file while downloading it.
+	decompressed, err := newDecompressor(file.Compressed.Encoding, reader)
+	if err != nil {
+		return err
+	}
+
+	defer decompressed.Close()
+
+	// Hash the decompressed output while writing it, so we know it's the file in the manifest.
+	hash := crc32.New(crc32.MakeTable(polynomial))
+
+	_, err = io.Copy(io.MultiWriter(out, hash), decompressed)
+	if err != nil {
+		return err
+	}
+
+	if hashed := hex.EncodeToString(hash.Sum(nil)); hashed != file.CRC {
+		return fmt.Errorf("%s descomprimido no coincide con el CRC esperado: %s != %s", file.Name, hashed, file.CRC)
+	}
+
+	return nil
+}
+
+func (s *service) downloadDelta(action PatchAction, remoteDir string, path string, tmpPath string, counter *WriteCounter) error {
+	// The local file is the base the delta is applied to.
+	basePath, err := gameFile(path, action.File.Name)
+	if err != nil {
+		return err
+	}
+
+	base, err := os.Open(basePath)
+	if err != nil {
+		return err
+	}
+
+	defer base.Close()
+
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	f := fmt.Sprintf("%s/%s", remoteDir, action.Delta.Name)
+	contents, err := s.hiddengamersdiabloClient.GetFile(f)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	defer contents.Close()
+
+	// Limit the download speed, the limiter is shared between all downloads.
+	limited := newRateLimitedReader(contents, s.limiter)
+
+	err = patchDelta(base, io.TeeReader(limited, counter), out)
+
+	// Close the file before hashing it.
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
 	if err != nil {
 		return err
 	}
 
+	// Make sure the patched file is exactly the file in the manifest.
+	hashed, err := hashCRC32(tmpPath, polynomial)
+	if err != nil {
+		return err
+	}
+
+	if hashed != action.File.CRC {
+		return ErrDeltaMismatch
+	}
+
 	return nil
 }
 
+// LocalPath returns the path on disk of the game location.
+func LocalPath(location string) string {
+	return localizePath(location)
+}
+
+// GameFilePath returns the path on disk to a file in the game directory.
+func GameFilePath(location string, name string) string {
+	return localizePath(fmt.Sprintf("%s/%s", location, name))
+}
+
 func fileExistsOnDisk(fileName string, path string) (bool, error) {
-	filePath := localizePath(fmt.Sprintf("%s/%s", path, fileName))
+	filePath, err := gameFile(path, fileName)
+	if err != nil {
+		return false, err
+	}
 
-	_, err := os.Stat(filePath)
+	_, err = os.Stat(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -809,10 +832,13 @@ func fileExistsOnDisk(fileName string, path string) (bool, error) {
 }
 
 func (s *service) deleteFile(fileName string, path string) error {
-	filePath := localizePath(fmt.Sprintf("%s/%s", path, fileName))
+	filePath, err := gameFile(path, fileName)
+	if err != nil {
+		return err
+	}
 
 	// Check that the file exists.
-	_, err := os.Stat(filePath)
+	_, err = os.Stat(filePath)
 	if err != nil {
 		// File didn't exist on disk, just return nil.
 		if os.IsNotExist(err) {
@@ -828,119 +854,155 @@ func (s *service) deleteFile(fileName string, path string) error {
 		return err
 	}
 
-	return nil
+	// Don't leave the directories of the file behind.
+	return removeEmptyDirs(path, fileName)
 }
 
 func (s *service) cleanUpFailedPatch(dir string) error {
-	files, err := ioutil.ReadDir(localizePath(dir))
+	// Downloads can be in any subdirectory of the game.
+	files, err := findTmpFiles(dir)
 	if err != nil {
 		return err
 	}
 
-	for _, f := range files {
-		fileName := f.Name()
-		if strings.Contains(fileName, ".tmp") {
-			err := os.Remove(localizePath(fmt.Sprintf("%s/%s", dir, fileName)))
-			if err != nil {
-				return err
-			}
+	for _, fileName := range files {
+		err := os.Remove(GameFilePath(dir, fileName))
+		if err != nil {
+			return err
+		}
+
+		// Directories created for the failed downloads are removed too.
+		if err := removeEmptyDirs(dir, fileName); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (s *service) getFilesToPatch(files []PatchFile, d2path string, filesToIgnore []string) ([]PatchAction, int64, error) {
+func (s *service) getFilesToPatch(files []PatchFile, d2path string, protected []string) ([]PatchAction, int64, error) {
 	shouldPatch := make([]PatchAction, 0)
 	var totalContentLength int64
 
 	for _, file := range files {
 		f := file
 
-		// Full path on disk to the patch file.
-		localPath := localizePath(fmt.Sprintf("%s/%s", d2path, f.Name))
+		// Every file must be inside the game directory.
+		if _, err := cleanFileName(f.Name); err != nil {
+			return nil, 0, err
+		}
 
-		// Check if the file should be ignored or not.
-		if filesToIgnore != nil && len(filesToIgnore) > 0 {
-			var ignore bool
-			for _, ignored := range filesToIgnore {
-				// If the current file should be ignored, just skip it.
-				if f.Name == ignored {
-					ignore = true
-					break
-				}
-			}
+		// Protected files are never touched, the user keeps their own copy.
+		if isProtected(f.Name, protected) {
+			continue
+		}
 
-			// File should be ignored, continue with the next.
-			if ignore {
-				continue
-			}
+		action, err := s.getFileAction(f, d2path)
+		if err != nil {
+			return nil, 0, err
 		}
-		// Check if file has been deprecated.
-		if f.Deprecated {
-			exists, err := fileExistsOnDisk(f.Name, d2path)
-			if err != nil {
-				return nil, 0, err
-			}
 
-			// If it still exists locally, queue it to be removed.
-			if exists {
-				// Get the checksum from the patch file on disk.
-				hashed, err := hashCRC32(localPath, polynomial)
-				if err != nil {
-					return nil, 0, err
-				}
-				shouldPatch = append(shouldPatch, PatchAction{
-					File:     f,
-					Action:   ActionDelete,
-					LocalCRC: hashed,
-					D2Path:   d2path,
-				})
-			}
+		// File is up to date.
+		if action == nil {
+			continue
+		}
 
+		shouldPatch = append(shouldPatch, *action)
+		totalContentLength += action.downloadLength()
+	}
+
+	return shouldPatch, totalContentLength, nil
+}
+
+// getProtectedFiles returns the protected files that would have been patched, as skipped actions.
+func (s *service) getProtectedFiles(files []PatchFile, d2path string, protected []string) ([]PatchAction, error) {
+	skipped := make([]PatchAction, 0)
+
+	for _, f := range files {
+		if !isProtected(f.Name, protected) {
 			continue
 		}
 
-		// Get the checksum from the patch file on disk.
-		hashed, err := hashCRC32(localPath, polynomial)
+		action, err := s.getFileAction(f, d2path)
+		if err != nil {
+			return nil, err
+		}
+
+		if action != nil {
+			action.Action = ActionSkip
+			skipped = append(skipped, *action)
+		}
+	}
+
+	return skipped, nil
+}
 
+// getFileAction returns the action needed to get the file on disk up to date, nil if it already is.
+func (s *service) getFileAction(f PatchFile, d2path string) (*PatchAction, error) {
+	// Check if file has been deprecated.
+	if f.Deprecated {
+		exists, err := fileExistsOnDisk(f.Name, d2path)
 		if err != nil {
-			// If the file doesn't exist on disk, we need to patch it.
-			if err == ErrCRCFileNotFound {
-				shouldPatch = append(shouldPatch, PatchAction{
-					File:     f,
-					Action:   ActionDownload,
-					LocalCRC: hashed,
-					D2Path:   d2path,
-				})
-				totalContentLength += f.ContentLength
-				continue
+			return nil, err
+		}
+
+		// If it still exists locally, queue it to be removed.
+		if exists {
+			// Get the checksum from the patch file on disk.
+			hashed, err := s.hashGameFile(d2path, f.Name)
+			if err != nil {
+				return nil, err
 			}
 
-			// Any other error, just return it.
-			return nil, 0, err
+			return &PatchAction{
+				File:     f,
+				Action:   ActionDelete,
+				LocalCRC: hashed,
+				D2Path:   d2path,
+			}, nil
 		}
 
-		// If the file is set to ignore the CRC, this means we don't want
-		// to patch it, even if the content has been changed, as long as it
-		// exists on disk we're good.
-		if f.IgnoreCRC {
-			continue
-		}
+		return nil, nil
+	}
+
+	// Get the checksum from the patch file on disk, unchanged files are served from the hash index.
+	hashed, err := s.hashGameFile(d2path, f.Name)
 
-		// File checksum differs from local copy, we need to get a new one.
-		if hashed != f.CRC {
-			shouldPatch = append(shouldPatch, PatchAction{
+	if err != nil {
+		// If the file doesn't exist on disk, we need to patch it.
+		if err == ErrCRCFileNotFound {
+			return &PatchAction{
 				File:     f,
 				Action:   ActionDownload,
 				LocalCRC: hashed,
 				D2Path:   d2path,
-			})
-			totalContentLength += f.ContentLength
+			}, nil
 		}
+
+		// Any other error, just return it.
+		return nil, err
 	}
 
-	return shouldPatch, totalContentLength, nil
+	// If the file is set to ignore the CRC, this means we don't want
+	// to patch it, even if the content has been changed, as long as it
+	// exists on disk we're good.
+	if f.IgnoreCRC {
+		return nil, nil
+	}
+
+	// File checksum differs from local copy, we need to get a new one.
+	if hashed != f.CRC {
+		return &PatchAction{
+			File:     f,
+			Action:   ActionDownload,
+			LocalCRC: hashed,
+			D2Path:   d2path,
+			// If there's a delta from the local version, we only need to download the delta.
+			Delta: f.deltaFrom(hashed),
+		}, nil
+	}
+
+	return nil, nil
 }
 
 func (s *service) getManifest(path string) (*Manifest, error) {
@@ -959,27 +1021,34 @@ func (s *service) getManifest(path string) (*Manifest, error) {
 		return nil, err
 	}
 
+	// Never trust the file names, they're joined onto the game directory.
+	if err := manifest.normalize(path); err != nil {
+		return nil, err
+	}
+
 	return &manifest, nil
 }
 
-func (s *service) addPatchFilesToBeDeleted(d2path string, files []PatchFile) error {
-	var actions = make([]PatchAction, len(files))
+func (s *service) addPatchFilesToBeDeleted(d2path string, files []PatchFile, protected []string) error {
+	var actions = make([]PatchAction, 0, len(files))
 
-	for i, file := range files {
-		// Full path on disk to the patch file.
-		localPath := localizePath(fmt.Sprintf("%s/%s", d2path, file.Name))
+	for _, file := range files {
+		// Protected files are never removed.
+		if isProtected(file.Name, protected) {
+			continue
+		}
 
-		hashed, err := hashCRC32(localPath, polynomial)
+		hashed, err := s.hashGameFile(d2path, file.Name)
 		if err != nil {
 			return err
 		}
 
-		actions[i] = PatchAction{
+		actions = append(actions, PatchAction{
 			Action:   ActionDelete,
 			File:     file,
 			LocalCRC: hashed,
 			D2Path:   d2path,
-		}
+		})
 	}
 
 	s.addFilesToModel(actions)
@@ -987,6 +1056,18 @@ func (s *service) addPatchFilesToBeDeleted(d2path string, files []PatchFile) err
 	return nil
 }
 
+// addProtectedFilesToModel will show the protected files that won't be patched.
+func (s *service) addProtectedFilesToModel(files []PatchFile, d2path string, protected []string) error {
+	skipped, err := s.getProtectedFiles(files, d2path, protected)
+	if err != nil {
+		return err
+	}
+
+	s.addFilesToModel(skipped)
+
+	return nil
+}
+
 func (s *service) addFilesToModel(patchActions []PatchAction) {
 	for _, action := range patchActions {
 		f := NewFile(nil)
@@ -1018,6 +1099,40 @@ type PatchFile struct {
 	ContentLength int64     `json:"content_length"`
 	IgnoreCRC     bool      `json:"ignore_crc"`
 	Deprecated    bool      `json:"deprecated"`
+
+	// Deltas are optional binary patches from previous versions of the file.
+	Deltas []PatchDelta `json:"deltas"`
+
+	// Compressed is an optional compressed variant of the file.
+	Compressed *CompressedFile `json:"compressed"`
+}
+
+// downloadLength returns the number of bytes transferred when downloading the full file.
+func (f PatchFile) downloadLength() int64 {
+	if f.Compressed != nil && f.Compressed.supported() {
+		return f.Compressed.ContentLength
+	}
+
+	return f.ContentLength
+}
+
+// deltaFrom returns the delta that patches the file with the given CRC, if any.
+func (f PatchFile) deltaFrom(crc string) *PatchDelta {
+	for i := range f.Deltas {
+		if f.Deltas[i].BaseCRC == crc {
+			return &f.Deltas[i]
+		}
+	}
+
+	return nil
+}
+
+// PatchDelta represents a binary delta from a known version of a file to the current one.
+type PatchDelta struct {
+	// Name is the name of the delta file in the remote directory.
+	Name          string `json:"name"`
+	BaseCRC       string `json:"base_crc"`
+	ContentLength int64  `json:"content_length"`
 }
 
 // Action is an action performed while patching.
@@ -1027,6 +1142,18 @@ type Action string
 const (
 	ActionDownload Action = "descargar"
 	ActionDelete   Action = "eliminar"
+
+	// ActionSkip is only shown to the user, the file is protected and won't be patched.
+	ActionSkip Action = "omitido (protegido)"
+
+	// ActionMerge merges the upstream changes into the local file, keeping the user's edits.
+	ActionMerge Action = "combinar"
+
+	// ActionSettings writes the user's settings to the file.
+	ActionSettings Action = "ajustar"
+
+	// ActionUnknown is only shown to the user, the file isn't known and can be quarantined.
+	ActionUnknown Action = "desconocido"
 )
 
 // PatchAction is performed while patching.
@@ -1035,6 +1162,22 @@ type PatchAction struct {
 	File     PatchFile
 	D2Path   string
 	LocalCRC string
+
+	// Delta is set if the local file can be patched instead of downloaded.
+	Delta *PatchDelta
+}
+
+// downloadLength returns the number of bytes the action will download.
+func (a PatchAction) downloadLength() int64 {
+	if a.Action != ActionDownload {
+		return 0
+	}
+
+	if a.Delta != nil {
+		return a.Delta.ContentLength
+	}
+
+	return a.File.downloadLength()
 }
 
 // NewService returns a service with all the dependencies.
@@ -1045,11 +1188,13 @@ func NewService(
 	patchFileModel *FileModel,
 ) Service {
 	s := &service{
-		hiddengamersdiabloClient: hiddengamersdiabloClient,
+		hiddengamersdiabloClient: &hiddengamersdiabloClient,
 		configService:            configuration,
 		logger:                   logger,
 		gameStates:               make(chan execState, 4),
 		patchFileModel:           patchFileModel,
+		limiter:                  &rateLimiter{},
+		hashIndexes:              make(map[string]*hashIndex),
 	}
 
 	// Setup game listener once, will stay alive for the duration
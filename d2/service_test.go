@@ -0,0 +1,177 @@
+package d2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/clients/hiddengamersdiablo"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// fakeSource serves the files of the patch repository from memory.
+type fakeSource struct {
+	mux   sync.Mutex
+	files map[string][]byte
+
+	// Paths that have been fetched, in order.
+	fetched []string
+}
+
+func (f *fakeSource) get(path string) (io.ReadCloser, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.fetched = append(f.fetched, path)
+
+	content, ok := f.files[path]
+	if !ok {
+		return nil, hiddengamersdiablo.ErrNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (f *fakeSource) GetFile(filePath string) (io.ReadCloser, error) {
+	return f.get(filePath)
+}
+
+func (f *fakeSource) GetAvailableMods() (io.ReadCloser, error) {
+	return f.get("available_mods.json")
+}
+
+func (f *fakeSource) GetAllowedFiles() (io.ReadCloser, error) {
+	return f.get("allowed_files.json")
+}
+
+func (f *fakeSource) GetRealm() (io.ReadCloser, error) {
+	return f.get("realm.json")
+}
+
+// fakeLogger keeps the logged errors.
+type fakeLogger struct {
+	mux    sync.Mutex
+	errors []error
+}
+
+func (l *fakeLogger) Info(string) error  { return nil }
+func (l *fakeLogger) Debug(string) error { return nil }
+
+func (l *fakeLogger) Error(err error) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.errors = append(l.errors, err)
+	return nil
+}
+
+// fakeConfig keeps the config in memory, calling anything it doesn't implement panics.
+type fakeConfig struct {
+	config.Service
+
+	mux  sync.Mutex
+	conf storage.Config
+}
+
+func (c *fakeConfig) Read() (*storage.Config, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	// Callers get their own copy, like reading the store.
+	conf := c.conf
+	conf.Games = append([]storage.Game{}, c.conf.Games...)
+
+	return &conf, nil
+}
+
+func (c *fakeConfig) UpdatePackages(id string, packages []storage.Package) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for i := range c.conf.Games {
+		if c.conf.Games[i].ID == id {
+			c.conf.Games[i].Packages = packages
+			return nil
+		}
+	}
+
+	return config.ErrGameNotFound
+}
+
+func (c *fakeConfig) InsertGame(game storage.Game) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	game.ID = fmt.Sprintf("game-%d", len(c.conf.Games)+1)
+	c.conf.Games = append(c.conf.Games, game)
+
+	return game.ID, nil
+}
+
+// newTestService returns a service fetching patches from the fake source.
+func newTestService(source *fakeSource) *service {
+	return &service{
+		hiddengamersdiabloClient: source,
+		logger:                   &fakeLogger{},
+		gameStates:               make(chan execState, 4),
+		limiter:                  &rateLimiter{},
+		hashIndexes:              make(map[string]*hashIndex),
+	}
+}
+
+// newTestGame returns the location of a new game directory with the given files.
+func newTestGame(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "d2test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, filepath.FromSlash(name)), content)
+	}
+
+	return GameLocation(dir)
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, location string, name string) string {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(GameFilePath(location, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+// crcOf returns the checksum of the content, the way manifests have it.
+func crcOf(content string) string {
+	hash := crc32.New(crc32.MakeTable(polynomial))
+	hash.Write([]byte(content))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
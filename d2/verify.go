@@ -0,0 +1,418 @@
+package d2
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// Problems found when verifying a game install.
+const (
+	// ProblemCorrupt is a tracked file that doesn't match its checksum.
+	ProblemCorrupt = "corrupto"
+
+	// ProblemMissing is a tracked file that doesn't exist.
+	ProblemMissing = "faltante"
+
+	// ProblemExtra is a file that shouldn't be there, such as deprecated files and failed downloads.
+	ProblemExtra = "sobrante"
+
+	// ProblemModified is a file that doesn't match its checksum, but is allowed to change.
+	// It's only reported, never repaired.
+	ProblemModified = "modificado"
+)
+
+// VerifyReport is the result of verifying every file tracked in a game install.
+type VerifyReport struct {
+	GameID   string        `json:"game_id"`
+	Location string        `json:"location"`
+	Checked  int           `json:"checked"`
+	Issues   []VerifyIssue `json:"issues"`
+}
+
+// VerifyIssue is a file that isn't what it's supposed to be.
+type VerifyIssue struct {
+	Name     string `json:"name"`
+	Problem  string `json:"problem"`
+	Source   string `json:"source"`
+	CRC      string `json:"crc"`
+	LocalCRC string `json:"local_crc"`
+
+	// What's needed to repair the file.
+	file      PatchFile
+	remoteDir string
+	pkg       *storage.Package
+}
+
+// Broken returns the issues that can be repaired.
+func (r VerifyReport) Broken() []VerifyIssue {
+	var broken []VerifyIssue
+	for _, issue := range r.Issues {
+		if issue.Problem != ProblemModified {
+			broken = append(broken, issue)
+		}
+	}
+
+	return broken
+}
+
+// Count returns the number of issues with the given problem.
+func (r VerifyReport) Count(problem string) int {
+	var count int
+	for _, issue := range r.Issues {
+		if issue.Problem == problem {
+			count++
+		}
+	}
+
+	return count
+}
+
+// trackedFile is a file the launcher has put in the game, and where it came from.
+type trackedFile struct {
+	file      PatchFile
+	source    string
+	remoteDir string
+	pkg       *storage.Package
+}
+
+// Verify will hash every file tracked in the games, and report the ones that are corrupt,
+// missing, extra or modified. Unlike validating, files ignoring the CRC are checked too.
+func (s *service) Verify() ([]VerifyReport, error) {
+	conf, err := s.configService.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Follow the realm settings published right now.
+	s.refreshRealm()
+
+	mods, err := s.getAvailableMods()
+	if err != nil {
+		return nil, err
+	}
+
+	// Manifests by remote directory, they're the same for every game.
+	manifests := make(map[string]*Manifest)
+
+	// Keep what's been hashed for the next time.
+	defer s.saveHashIndexes()
+
+	tracked := make([][]trackedFile, len(conf.Games))
+	installs := make([]gameFiles, len(conf.Games))
+
+	for i := range conf.Games {
+		tracked[i], err = s.getTrackedFiles(&conf.Games[i], mods, manifests)
+		if err != nil {
+			return nil, err
+		}
+
+		installs[i].location = conf.Games[i].Location
+		for _, t := range tracked[i] {
+			installs[i].names = append(installs[i].names, t.file.Name)
+		}
+	}
+
+	// Hash the files of every install in parallel before checking them one by one, a deep
+	// verify doesn't trust the hash index, since corruption doesn't change the size or time.
+	s.prehash(installs, true)
+
+	reports := make([]VerifyReport, 0, len(conf.Games))
+	for i := range conf.Games {
+		report, err := s.verifyFiles(&conf.Games[i], tracked[i])
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, *report)
+	}
+
+	return reports, nil
+}
+
+// getTrackedFiles returns the files the game should have, later manifests override earlier
+// ones, in the same order the game is patched: the game version, the current patch, mods and packages.
+func (s *service) getTrackedFiles(game *storage.Game, mods *config.GameMods, manifests map[string]*Manifest) ([]trackedFile, error) {
+	var (
+		order   []string
+		tracked = make(map[string]trackedFile)
+	)
+
+	add := func(f trackedFile) {
+		key := strings.ToLower(f.file.Name)
+		if _, ok := tracked[key]; !ok {
+			order = append(order, key)
+		}
+		tracked[key] = f
+	}
+
+	manifest := func(remoteDir string) (*Manifest, error) {
+		if m, ok := manifests[remoteDir]; ok {
+			return m, nil
+		}
+
+		m, err := s.getManifest(fmt.Sprintf("%s/manifest.json", remoteDir))
+		if err != nil {
+			return nil, err
+		}
+
+		manifests[remoteDir] = m
+		return m, nil
+	}
+
+	protected := game.ProtectedPatterns()
+
+	gameVersion, err := s.getGameVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, remoteDir := range []string{gameVersion, "current"} {
+		m, err := manifest(remoteDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range m.Files {
+			if !isProtected(f.Name, protected) {
+				add(trackedFile{file: f, source: remoteDir, remoteDir: remoteDir})
+			}
+		}
+	}
+
+	for _, mod := range mods.All() {
+		version := game.ModVersion(mod.Name)
+		if !config.ModEnabled(version) {
+			continue
+		}
+
+		remoteDir := mod.RemoteDirFor(version)
+
+		m, err := manifest(remoteDir)
+		if err != nil {
+			return nil, err
+		}
+
+		// Merged files are expected to differ, they're the user's own.
+		modProtected := modProtectedFiles(game, mod)
+
+		for _, f := range modFiles(mod, m.Files) {
+			if !isProtected(f.Name, modProtected) {
+				add(trackedFile{file: f, source: fmt.Sprintf("%s %s", mod.Name, version), remoteDir: remoteDir})
+			}
+		}
+	}
+
+	for i := range game.Packages {
+		pkg := &game.Packages[i]
+		for _, f := range pkg.Files {
+			if !isProtected(f.Name, protected) {
+				add(trackedFile{file: PatchFile{Name: f.Name, CRC: f.CRC}, source: pkg.Name, pkg: pkg})
+			}
+		}
+	}
+
+	files := make([]trackedFile, len(order))
+	for i, key := range order {
+		files[i] = tracked[key]
+	}
+
+	return files, nil
+}
+
+// verifyFiles will hash the tracked files of the game and report the ones that aren't as expected.
+func (s *service) verifyFiles(game *storage.Game, tracked []trackedFile) (*VerifyReport, error) {
+	report := &VerifyReport{
+		GameID:   game.ID,
+		Location: game.Location,
+		Issues:   make([]VerifyIssue, 0),
+	}
+
+	for _, t := range tracked {
+		report.Checked++
+
+		hashed, err := s.hashGameFile(game.Location, t.file.Name)
+		if err != nil && err != ErrCRCFileNotFound {
+			return nil, err
+		}
+
+		exists := err == nil
+
+		var problem string
+		switch {
+		case t.file.Deprecated:
+			if exists {
+				problem = ProblemExtra
+			}
+		case !exists:
+			problem = ProblemMissing
+		case t.file.CRC == "" || hashed == t.file.CRC:
+			// Up to date, or there's nothing to compare to.
+		case t.file.IgnoreCRC:
+			problem = ProblemModified
+		default:
+			problem = ProblemCorrupt
+		}
+
+		if problem == "" {
+			continue
+		}
+
+		report.Issues = append(report.Issues, VerifyIssue{
+			Name:      t.file.Name,
+			Problem:   problem,
+			Source:    t.source,
+			CRC:       t.file.CRC,
+			LocalCRC:  hashed,
+			file:      t.file,
+			remoteDir: t.remoteDir,
+			pkg:       t.pkg,
+		})
+	}
+
+	// Downloads left behind by a failed patch.
+	files, err := findTmpFiles(game.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range files {
+		report.Issues = append(report.Issues, VerifyIssue{
+			Name:    name,
+			Problem: ProblemExtra,
+			file:    PatchFile{Name: name, Deprecated: true},
+		})
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Name < report.Issues[j].Name
+	})
+
+	return report, nil
+}
+
+// Repair will fix the broken files found when verifying, files that are allowed
+// to be modified are left alone. Progress is reported the same way as patching.
+func (s *service) Repair(reports []VerifyReport, done chan bool) (<-chan float32, <-chan PatchState) {
+	// Progress is buffered so the downloader can publish without waiting on the UI.
+	progress := make(chan float32, 1)
+	state := make(chan PatchState)
+
+	go func() {
+		conf, err := s.configService.Read()
+		if err != nil {
+			state <- PatchState{Error: err}
+			return
+		}
+
+		// Apply the download rate limit set by the user.
+		s.limiter.SetRate(int64(conf.DownloadRateLimit) * 1024)
+
+		for _, report := range reports {
+			if err := s.repairGame(report, state, progress); err != nil {
+				state <- PatchState{Error: err}
+				return
+			}
+		}
+
+		done <- true
+	}()
+
+	return progress, state
+}
+
+// repairGame will repair the broken files of a single game.
+func (s *service) repairGame(report VerifyReport, state chan PatchState, progress chan float32) error {
+	// Downloads grouped by remote directory, in the order they were found.
+	var remoteDirs []string
+	actions := make(map[string][]PatchAction)
+	lengths := make(map[string]int64)
+
+	// Packages are installed from their archives again.
+	packages := make(map[string]*storage.Package)
+
+	for _, issue := range report.Broken() {
+		path := report.Location
+
+		switch {
+		case issue.Problem == ProblemExtra:
+			state <- PatchState{Message: fmt.Sprintf("Eliminando %s de %s", issue.Name, path)}
+
+			if err := s.deleteFile(issue.Name, path); err != nil {
+				return err
+			}
+		case issue.pkg != nil:
+			packages[issue.pkg.Name] = issue.pkg
+		case issue.remoteDir != "":
+			action := PatchAction{
+				Action:   ActionDownload,
+				File:     issue.file,
+				D2Path:   path,
+				LocalCRC: issue.LocalCRC,
+				// A corrupt file might still be a known version of it.
+				Delta: issue.file.deltaFrom(issue.LocalCRC),
+			}
+
+			if _, ok := actions[issue.remoteDir]; !ok {
+				remoteDirs = append(remoteDirs, issue.remoteDir)
+			}
+
+			actions[issue.remoteDir] = append(actions[issue.remoteDir], action)
+			lengths[issue.remoteDir] += action.downloadLength()
+		}
+	}
+
+	// Fail before downloading anything if the install doesn't have room for the repair.
+	batches := make([][]PatchAction, 0, len(remoteDirs))
+	for _, remoteDir := range remoteDirs {
+		batches = append(batches, actions[remoteDir])
+	}
+
+	reinstalled := make([]*storage.Package, 0, len(packages))
+	for _, pkg := range packages {
+		reinstalled = append(reinstalled, pkg)
+	}
+
+	size, err := s.getRepairSize(report.Location, batches, reinstalled)
+	if err != nil {
+		return err
+	}
+
+	if required := size.required(); required > 0 {
+		if err := checkFreeSpace(localizePath(report.Location), required); err != nil {
+			return err
+		}
+	}
+
+	for _, remoteDir := range remoteDirs {
+		state <- PatchState{Message: fmt.Sprintf("Reparando %d archivos de %s en %s", len(actions[remoteDir]), remoteDir, report.Location)}
+
+		if err := s.doPatch(actions[remoteDir], lengths[remoteDir], remoteDir, report.Location, progress); err != nil {
+			patchErr := err
+			// Make sure we clean up the failed repair.
+			if err := s.cleanUpFailedPatch(report.Location); err != nil {
+				return fmt.Errorf("Error de limpieza: %s : %s", patchErr, err)
+			}
+
+			return err
+		}
+	}
+
+	for _, pkg := range packages {
+		state <- PatchState{Message: fmt.Sprintf("Reinstalando el paquete %s en %s", pkg.Name, report.Location)}
+
+		if _, err := os.Stat(pkg.Source); err != nil {
+			return fmt.Errorf("no se puede reparar el paquete %s, el archivo %s no existe", pkg.Name, pkg.Source)
+		}
+
+		if err := s.InstallPackage(report.GameID, pkg.Source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
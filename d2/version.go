@@ -0,0 +1,42 @@
+package d2
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+)
+
+// SHA1 of the different versions of Diablo Game.exe.
+var hashList = map[string]string{
+	"a875b98fa3a8b9300bcc04c84be1fa057eb277b5": "1.12",
+	"af2b33c90b50ede8d9a8bca9b8d9720c87f78641": "1.13c",
+	"27ddadbc457affed122564ae7a4bd2223181e15a": "1.13c", // Custom 1.13c build with HD icon.
+	"11cd918cb6906295769d9be1b3e349e02af6b229": "1.13d",
+	"3e64f12c6ef72847f49d301c2472280d4460589d": "1.14a",
+	"11e940266c6838414c2114c2172227f982d4054e": "1.14b",
+	"928cb9daedc562e04a18cd62acd71c346247e260": "1.14b", // 1.14b personalizado para hiddengamers d2
+	"255691dd53e3bcd646e5c6e1e2e7b16da745b706": "1.14c",
+	"af0ea93d2a652ceb11ac01ee2e4ae1ef613444c2": "1.14d",
+}
+
+// GameVersion returns the Diablo II version of the install, identified by the hash
+// of its Game.exe. The version is empty if the Game.exe isn't a known one.
+func GameVersion(location string) (string, error) {
+	content, err := ioutil.ReadFile(GameFilePath(location, "Game.exe"))
+	if err != nil {
+		return "", err
+	}
+
+	return hashList[fmt.Sprintf("%x", sha1.Sum(content))], nil
+}
+
+// isKnownVersion returns true if the version is one of the known Game.exe versions.
+func isKnownVersion(version string) bool {
+	for _, v := range hashList {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,11 +1,35 @@
 package d2
 
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultProgressInterval is the minimum time between two progress reports.
+	defaultProgressInterval = 100 * time.Millisecond
+
+	// defaultProgressStep is the minimum change in percentage that will be
+	// reported before the interval has passed.
+	defaultProgressStep = 0.01
+)
+
 // WriteCounter counts the number of bytes written to it. It implements to the io.Writer
 // interface and we can pass this into io.TeeReader() which will report progress on each write cycle.
+// Progress is coalesced, so the reader never waits on whoever is listening to the progress.
 type WriteCounter struct {
-	Total    float32
-	Written  float32
+	Total    int64
+	Written  int64
 	progress chan float32
+
+	// Throttling settings.
+	interval time.Duration
+	step     float32
+
+	mux           sync.Mutex
+	lastPublished time.Time
+	lastReported  float32
+	now           func() time.Time
 }
 
 // Write gets every write cycle reported on it.
@@ -13,12 +37,76 @@ func (wc *WriteCounter) Write(p []byte) (int, error) {
 	// Bytes written this cycle.
 	n := len(p)
 
-	// Add the written bytes to the total.
-	wc.Written += float32(n)
-
-	// Calculate the percentage and send it on the channel.
-	wc.progress <- wc.Written / wc.Total
+	wc.add(int64(n))
 
 	// Return the length of the written bytes this cycle.
 	return n, nil
 }
+
+// add will count bytes that were written without going through the counter, such as hardlinked files.
+func (wc *WriteCounter) add(n int64) {
+	wc.mux.Lock()
+	defer wc.mux.Unlock()
+
+	// Add the written bytes to the total.
+	wc.Written += n
+
+	percentage := wc.percentage()
+	now := wc.now()
+
+	// Only report when enough time has passed, when the percentage moved enough
+	// or when we're done, to avoid flooding the listener.
+	if percentage >= 1 ||
+		now.Sub(wc.lastPublished) >= wc.interval ||
+		percentage-wc.lastReported >= wc.step {
+		wc.lastPublished = now
+		wc.lastReported = percentage
+		wc.publish(percentage)
+	}
+}
+
+// addTotal will grow the total, used when more bytes than planned have to be downloaded.
+func (wc *WriteCounter) addTotal(n int64) {
+	wc.mux.Lock()
+	defer wc.mux.Unlock()
+
+	wc.Total += n
+}
+
+// percentage returns the share of the total that has been written, between 0 and 1.
+func (wc *WriteCounter) percentage() float32 {
+	if wc.Total <= 0 || wc.Written >= wc.Total {
+		return 1
+	}
+
+	return float32(float64(wc.Written) / float64(wc.Total))
+}
+
+// publish will send the percentage on the progress channel without blocking,
+// if the channel is full the stale value is replaced with the latest one.
+func (wc *WriteCounter) publish(percentage float32) {
+	for i := 0; i < 2; i++ {
+		select {
+		case wc.progress <- percentage:
+			return
+		default:
+		}
+
+		// Nobody has read the previous value yet, drop it.
+		select {
+		case <-wc.progress:
+		default:
+		}
+	}
+}
+
+// NewWriteCounter returns a write counter reporting progress of total bytes on the given channel.
+func NewWriteCounter(total int64, progress chan float32) *WriteCounter {
+	return &WriteCounter{
+		Total:    total,
+		progress: progress,
+		interval: defaultProgressInterval,
+		step:     defaultProgressStep,
+		now:      time.Now,
+	}
+}
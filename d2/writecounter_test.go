@@ -0,0 +1,161 @@
+package d2
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// newTestCounter returns a counter on a fake clock, with its first report out of the way.
+func newTestCounter(total int64, progress chan float32) (*WriteCounter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	wc := NewWriteCounter(total, progress)
+	wc.now = clock.now
+	wc.lastPublished = clock.t
+
+	return wc, clock
+}
+
+// drain returns every value waiting on the channel.
+func drain(progress chan float32) []float32 {
+	var values []float32
+	for {
+		select {
+		case v := <-progress:
+			values = append(values, v)
+		default:
+			return values
+		}
+	}
+}
+
+func TestWriteCounterThrottlesByTime(t *testing.T) {
+	progress := make(chan float32, 1)
+	wc, clock := newTestCounter(1000000, progress)
+
+	// Tiny writes within the interval aren't reported.
+	for i := 0; i < 5; i++ {
+		wc.Write(make([]byte, 10))
+		clock.advance(10 * time.Millisecond)
+	}
+
+	if values := drain(progress); len(values) != 0 {
+		t.Fatalf("expected no progress within the interval, got %v", values)
+	}
+
+	// Once the interval has passed, the next write is reported.
+	clock.advance(defaultProgressInterval)
+	wc.Write(make([]byte, 10))
+
+	values := drain(progress)
+	if len(values) != 1 {
+		t.Fatalf("expected one progress report after the interval, got %v", values)
+	}
+
+	if want := float32(60) / 1000000; values[0] != want {
+		t.Fatalf("expected progress %v, got %v", want, values[0])
+	}
+}
+
+func TestWriteCounterThrottlesByStep(t *testing.T) {
+	progress := make(chan float32, 1)
+	wc, _ := newTestCounter(1000, progress)
+
+	// Less than a step, the clock doesn't move.
+	wc.Write(make([]byte, 5))
+	if values := drain(progress); len(values) != 0 {
+		t.Fatalf("expected no progress below the step, got %v", values)
+	}
+
+	// Crossing the step is reported without waiting for the interval.
+	wc.Write(make([]byte, 5))
+	values := drain(progress)
+	if len(values) != 1 || values[0] != 0.01 {
+		t.Fatalf("expected progress 0.01 at the step, got %v", values)
+	}
+
+	// The step is counted from the last report.
+	wc.Write(make([]byte, 9))
+	if values := drain(progress); len(values) != 0 {
+		t.Fatalf("expected no progress below the next step, got %v", values)
+	}
+}
+
+func TestWriteCounterReportsCompletion(t *testing.T) {
+	progress := make(chan float32, 1)
+	wc, _ := newTestCounter(1000000, progress)
+
+	wc.Write(make([]byte, 999999))
+	drain(progress)
+
+	// The last byte is always reported, even right after another report.
+	wc.Write(make([]byte, 1))
+	values := drain(progress)
+	if len(values) != 1 || values[0] != 1 {
+		t.Fatalf("expected completion to be reported, got %v", values)
+	}
+}
+
+func TestWriteCounterDropsStaleProgress(t *testing.T) {
+	progress := make(chan float32, 1)
+	wc, clock := newTestCounter(100, progress)
+
+	done := make(chan struct{})
+
+	// Nobody listens, writing must not block.
+	go func() {
+		for i := 0; i < 10; i++ {
+			clock.advance(defaultProgressInterval)
+			wc.Write(make([]byte, 5))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing blocked on a progress channel nobody reads")
+	}
+
+	// Only the latest value is kept.
+	values := drain(progress)
+	if len(values) != 1 || values[0] != 0.5 {
+		t.Fatalf("expected only the latest progress 0.5, got %v", values)
+	}
+}
+
+func TestWriteCounterAdd(t *testing.T) {
+	progress := make(chan float32, 1)
+	wc, _ := newTestCounter(200, progress)
+
+	// Bytes counted without writing them, such as hardlinked files.
+	wc.add(100)
+
+	values := drain(progress)
+	if len(values) != 1 || values[0] != 0.5 {
+		t.Fatalf("expected progress 0.5, got %v", values)
+	}
+
+	if wc.Written != 100 {
+		t.Fatalf("expected 100 bytes written, got %d", wc.Written)
+	}
+
+	// Growing the total lowers the percentage of what's written.
+	wc.addTotal(200)
+	if p := wc.percentage(); p != 0.25 {
+		t.Fatalf("expected percentage 0.25 after growing the total, got %v", p)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build darwin
+// +build darwin
+
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultRoots returns the patterns of the Wine prefixes Diablo II is usually installed in,
+// the default one and the CrossOver bottles.
+func defaultRoots() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	// The home directory is used as it is, only the prefixes are patterns.
+	home = escapeGlob(home)
+
+	return []string{
+		filepath.Join(home, ".wine", "drive_c"),
+		filepath.Join(home, "Library", "Application Support", "CrossOver", "Bottles", "*", "drive_c"),
+	}
+}
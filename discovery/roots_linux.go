@@ -0,0 +1,29 @@
+//go:build linux
+// +build linux
+
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultRoots returns the patterns of the Wine prefixes Diablo II is usually installed in,
+// the default one and the ones made by Lutris and Bottles.
+func defaultRoots() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	// The home directory is used as it is, only the prefixes are patterns.
+	home = escapeGlob(home)
+
+	return []string{
+		filepath.Join(home, ".wine", "drive_c"),
+		filepath.Join(home, "Games", "*", "drive_c"),
+		filepath.Join(home, ".local", "share", "lutris", "prefixes", "*", "drive_c"),
+		filepath.Join(home, ".local", "share", "bottles", "bottles", "*", "drive_c"),
+		filepath.Join(home, ".var", "app", "com.usebottles.bottles", "data", "bottles", "bottles", "*", "drive_c"),
+	}
+}
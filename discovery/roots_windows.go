@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultRoots returns the patterns of the directories Diablo II is usually installed in.
+func defaultRoots() []string {
+	drive := escapeGlob(os.Getenv("SystemDrive") + `\`)
+
+	return []string{
+		escapeGlob(os.Getenv("ProgramFiles")),
+		escapeGlob(os.Getenv("ProgramFiles(x86)")),
+		filepath.Join(drive, "Games"),
+		filepath.Join(drive, "Diablo II"),
+	}
+}
@@ -0,0 +1,181 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/d2"
+)
+
+// maxDepth is how many directories deep installs are looked for under each root.
+const maxDepth = 4
+
+// skippedDirs are never looked into, they're big and never have installs.
+var skippedDirs = map[string]bool{
+	"windows":                   true,
+	"$recycle.bin":              true,
+	"system volume information": true,
+	"dosdevices":                true,
+}
+
+// Candidate is a Diablo II install found on disk that hasn't been set up yet.
+type Candidate struct {
+	Location string `json:"location"`
+
+	// Version is the Diablo II version of the install, empty if it isn't known.
+	Version string `json:"version"`
+}
+
+// Service is responsible for finding Diablo II installs on disk.
+type Service interface {
+	// Discover will look for installs in the common locations and the given roots,
+	// installs already in the config aren't returned.
+	Discover(roots []string) ([]Candidate, error)
+}
+
+type service struct {
+	configService config.Service
+}
+
+// Discover will look for installs in the common locations and the given roots.
+func (s *service) Discover(roots []string) ([]Candidate, error) {
+	return s.discover(defaultRoots(), roots)
+}
+
+// discover will look for installs in the directories matching the patterns and in the given roots.
+// Only the built-in locations are patterns, such as the prefixes of every Wine bottle, the roots
+// given by the user are used as they are, since directories like "Games [old]" are common.
+func (s *service) discover(patterns []string, roots []string) ([]Candidate, error) {
+	conf, err := s.configService.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Installs already set up, or found under more than one root.
+	seen := make(map[string]bool)
+	for _, g := range conf.Games {
+		seen[locationKey(g.Location)] = true
+	}
+
+	var dirs []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		dirs = append(dirs, matches...)
+	}
+
+	for _, root := range roots {
+		if root != "" {
+			dirs = append(dirs, root)
+		}
+	}
+
+	candidates := make([]Candidate, 0)
+
+	for _, dir := range dirs {
+		findInstalls(dir, maxDepth, func(install string, version string) {
+			location := d2.GameLocation(install)
+			if seen[locationKey(location)] {
+				return
+			}
+
+			seen[locationKey(location)] = true
+			candidates = append(candidates, Candidate{Location: location, Version: version})
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Location < candidates[j].Location
+	})
+
+	return candidates, nil
+}
+
+// findInstalls will look for installs in the directory and its subdirectories, up to the given
+// depth. Unreadable directories are skipped and symlinks aren't followed.
+func findInstalls(dir string, depth int, found func(install string, version string)) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	if version, ok := identifyInstall(dir, files); ok {
+		found(dir, version)
+
+		// Installs don't have other installs in them.
+		return
+	}
+
+	if depth == 0 {
+		return
+	}
+
+	for _, f := range files {
+		if !f.IsDir() || skippedDirs[strings.ToLower(f.Name())] {
+			continue
+		}
+
+		findInstalls(filepath.Join(dir, f.Name()), depth-1, found)
+	}
+}
+
+// identifyInstall returns the version of the install in the directory, if it is one. Game.exe is a
+// common name, so it only counts if it's a known Diablo II version, Diablo II.exe always counts.
+func identifyInstall(dir string, files []os.FileInfo) (string, bool) {
+	var hasGame, hasLauncher bool
+	for _, f := range files {
+		switch {
+		case f.IsDir():
+		case strings.EqualFold(f.Name(), "Game.exe"):
+			hasGame = true
+		case strings.EqualFold(f.Name(), "Diablo II.exe"):
+			hasLauncher = true
+		}
+	}
+
+	if !hasGame && !hasLauncher {
+		return "", false
+	}
+
+	var version string
+	if hasGame {
+		version, _ = d2.GameVersion(d2.GameLocation(dir))
+	}
+
+	return version, hasLauncher || version != ""
+}
+
+// escapeGlob returns the path as a pattern that only matches itself, so the directories
+// built-in patterns are made from can have any name.
+func escapeGlob(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		switch r {
+		case '*', '?', '[':
+			b.WriteString("[" + string(r) + "]")
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// locationKey returns the location in a form that can be compared, paths on Windows aren't case sensitive.
+func locationKey(location string) string {
+	return strings.ToLower(strings.TrimRight(strings.Replace(location, "\\", "/", -1), "/"))
+}
+
+// NewService returns a service with all the dependencies.
+func NewService(configService config.Service) Service {
+	return &service{
+		configService: configService,
+	}
+}
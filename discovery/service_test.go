@@ -0,0 +1,230 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/d2"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+type fakeConfig struct {
+	config.Service
+	conf storage.Config
+}
+
+func (c *fakeConfig) Read() (*storage.Config, error) {
+	conf := c.conf
+	return &conf, nil
+}
+
+// newTestTree creates the given files, with paths separated by /, in a temporary directory and returns it.
+func newTestTree(t *testing.T, files ...string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "d2discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte("not really "+f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func installs(t *testing.T, dir string) map[string]bool {
+	t.Helper()
+
+	found := make(map[string]bool)
+	findInstalls(dir, maxDepth, func(install string, version string) {
+		rel, err := filepath.Rel(dir, install)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found[filepath.ToSlash(rel)] = true
+	})
+
+	return found
+}
+
+func TestFindInstalls(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{
+			name:  "root",
+			files: []string{"Diablo II.exe"},
+			want:  []string{"."},
+		},
+		{
+			name:  "nested",
+			files: []string{"Games/Diablo II/Diablo II.exe", "Other/Diablo II/DIABLO II.EXE"},
+			want:  []string{"Games/Diablo II", "Other/Diablo II"},
+		},
+		{
+			name:  "depth limit",
+			files: []string{"a/b/c/d/Diablo II.exe", "a/b/c/d/e/Diablo II.exe"},
+			want:  []string{"a/b/c/d"},
+		},
+		{
+			name:  "skipped directories",
+			files: []string{"Windows/Diablo II/Diablo II.exe", "$Recycle.Bin/Diablo II/Diablo II.exe"},
+			want:  nil,
+		},
+		{
+			name:  "unknown Game.exe",
+			files: []string{"Emulator/Game.exe", "Diablo II/Game.exe", "Diablo II/Diablo II.exe"},
+			want:  []string{"Diablo II"},
+		},
+		{
+			name:  "installs in installs",
+			files: []string{"Diablo II/Diablo II.exe", "Diablo II/Backup/Diablo II.exe"},
+			want:  []string{"Diablo II"},
+		},
+		{
+			name:  "directory named like the game",
+			files: []string{"Diablo II.exe/readme.txt"},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := installs(t, newTestTree(t, tt.files...))
+
+			if len(found) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, found)
+			}
+
+			for _, w := range tt.want {
+				if !found[w] {
+					t.Fatalf("expected %v, got %v", tt.want, found)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentifyInstall(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  bool
+	}{
+		{name: "launcher", files: []string{"Diablo II.exe"}, want: true},
+		{name: "launcher and unknown Game.exe", files: []string{"Diablo II.exe", "Game.exe"}, want: true},
+		{name: "unknown Game.exe", files: []string{"Game.exe"}, want: false},
+		{name: "no executables", files: []string{"d2data.mpq"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestTree(t, tt.files...)
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			version, ok := identifyInstall(dir, files)
+			if ok != tt.want {
+				t.Fatalf("expected %t, got %t", tt.want, ok)
+			}
+
+			// The fake Game.exe isn't a known version.
+			if version != "" {
+				t.Fatalf("expected no version, got %s", version)
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := newTestTree(t,
+		"drive_c/Diablo II/Diablo II.exe",
+		"bottles/first/drive_c/Diablo II/Diablo II.exe",
+		"bottles/second/drive_c/Games/Diablo II/Diablo II.exe",
+		"Games [old]/Diablo II/Diablo II.exe",
+		"Configured/Diablo II.exe",
+	)
+
+	s := &service{configService: &fakeConfig{conf: storage.Config{Games: []storage.Game{
+		{ID: "game", Location: d2.GameLocation(filepath.Join(dir, "Configured"))},
+	}}}}
+
+	patterns := []string{
+		filepath.Join(escapeGlob(dir), "bottles", "*", "drive_c"),
+	}
+
+	roots := []string{
+		// Found twice, under the root and its subdirectory.
+		filepath.Join(dir, "drive_c"),
+		filepath.Join(dir, "drive_c", "Diablo II"),
+		// Not a pattern, the brackets are part of the name.
+		filepath.Join(dir, "Games [old]"),
+		filepath.Join(dir, "Configured"),
+		filepath.Join(dir, "missing"),
+		"",
+	}
+
+	candidates, err := s.discover(patterns, roots)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{
+		"bottles/first/drive_c/Diablo II",
+		"bottles/second/drive_c/Games/Diablo II",
+		"drive_c/Diablo II",
+		"Games [old]/Diablo II",
+	}
+
+	found := make(map[string]bool)
+	for _, c := range candidates {
+		found[c.Location] = true
+	}
+
+	if len(candidates) != len(want) {
+		t.Fatalf("expected %v, got %+v", want, candidates)
+	}
+
+	for _, w := range want {
+		if location := d2.GameLocation(filepath.Join(dir, filepath.FromSlash(w))); !found[location] {
+			t.Fatalf("expected %s to be found, got %+v", location, candidates)
+		}
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	names := []string{"Games [old]", "Diablo II*", "Diablo?", "plain"}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			matched, err := filepath.Match(escapeGlob(name), name)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !matched {
+				t.Fatalf("expected %q to match itself", name)
+			}
+		})
+	}
+}
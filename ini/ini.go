@@ -0,0 +1,170 @@
+package ini
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// File is a parsed INI file, it can be written back without losing comments or formatting.
+type File struct {
+	lines []*line
+
+	// Line endings of the original file, so we write them back the same way.
+	eol          string
+	trailingLine bool
+}
+
+// line is a single line of the file, kept as is unless its value has been changed.
+type line struct {
+	raw     string
+	section string
+
+	// Set for key value lines, prefix is everything before the value, such as "key = ".
+	key    string
+	value  string
+	prefix string
+	isKey  bool
+}
+
+// Parse will parse an INI file. Keys before the first section belong to the "" section.
+func Parse(r io.Reader) (*File, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		eol:          "\n",
+		trailingLine: len(content) == 0 || bytes.HasSuffix(content, []byte("\n")),
+	}
+
+	if bytes.Contains(content, []byte("\r\n")) {
+		f.eol = "\r\n"
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	var section string
+	for scanner.Scan() {
+		raw := strings.TrimSuffix(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(raw)
+
+		l := &line{raw: raw, section: section}
+
+		switch {
+		case trimmed == "", strings.HasPrefix(trimmed, ";"), strings.HasPrefix(trimmed, "#"):
+			// Blank lines and comments are kept as they are.
+
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			l.section = section
+
+		default:
+			i := strings.Index(raw, "=")
+			if i < 0 {
+				// Not a key, keep the line as it is.
+				break
+			}
+
+			// The value starts after the whitespace following the separator.
+			start := i + 1
+			for start < len(raw) && (raw[start] == ' ' || raw[start] == '\t') {
+				start++
+			}
+
+			l.isKey = true
+			l.key = strings.TrimSpace(raw[:i])
+			l.value = strings.TrimSpace(raw[start:])
+			l.prefix = raw[:start]
+		}
+
+		f.lines = append(f.lines, l)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Get returns the value of the key in the section, keys and sections are case insensitive.
+func (f *File) Get(section, key string) (string, bool) {
+	if l := f.find(section, key); l != nil {
+		return l.value, true
+	}
+
+	return "", false
+}
+
+// Set will set the value of the key in the section, adding the key, and the section, if they don't exist.
+func (f *File) Set(section, key, value string) {
+	if l := f.find(section, key); l != nil {
+		if l.value != value {
+			l.value = value
+			l.raw = ""
+		}
+		return
+	}
+
+	l := &line{
+		section: section,
+		key:     key,
+		value:   value,
+		prefix:  fmt.Sprintf("%s=", key),
+		isKey:   true,
+	}
+
+	// Add the key after the last key of the section, or the header if it's empty.
+	last := -1
+	for i, existing := range f.lines {
+		if strings.EqualFold(existing.section, section) && (existing.isKey || last == -1) {
+			last = i
+		}
+	}
+
+	switch {
+	case last == -1 && section == "":
+		// Keys without a section have to come before the first section.
+		f.lines = append([]*line{l}, f.lines...)
+		return
+	case last == -1:
+		f.lines = append(f.lines, &line{raw: fmt.Sprintf("[%s]", section), section: section}, l)
+		return
+	}
+
+	f.lines = append(f.lines[:last+1], append([]*line{l}, f.lines[last+1:]...)...)
+}
+
+func (f *File) find(section, key string) *line {
+	for _, l := range f.lines {
+		if l.isKey && strings.EqualFold(l.section, section) && strings.EqualFold(l.key, key) {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// Bytes returns the file as it should be written to disk.
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+
+	for i, l := range f.lines {
+		if l.raw == "" && l.isKey {
+			buf.WriteString(l.prefix + l.value)
+		} else {
+			buf.WriteString(l.raw)
+		}
+
+		if i < len(f.lines)-1 || f.trailingLine {
+			buf.WriteString(f.eol)
+		}
+	}
+
+	return buf.Bytes()
+}
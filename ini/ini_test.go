@@ -0,0 +1,177 @@
+package ini
+
+import (
+	"strings"
+	"testing"
+)
+
+// testFile looks like the settings of the HD mod.
+const testFile = `; D2HD settings
+global = yes
+
+[D2HD]
+# resolution of the game
+Width = 1068
+	Height=600
+
+Fullscreen  =  0
+not a key
+
+[Extra]
+Zoom=1
+`
+
+func parse(t *testing.T, content string) *File {
+	t.Helper()
+
+	f, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "file", content: testFile},
+		{name: "crlf", content: strings.Replace(testFile, "\n", "\r\n", -1)},
+		{name: "no trailing line", content: strings.TrimSuffix(testFile, "\n")},
+		{name: "blank lines", content: "\n\n[D2HD]\n\n\nWidth=1068\n\n"},
+		{name: "empty", content: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(parse(t, tt.content).Bytes()); got != tt.content {
+				t.Fatalf("expected the file to be kept as is, got %q", got)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	f := parse(t, testFile)
+
+	tests := []struct {
+		section string
+		key     string
+		want    string
+		ok      bool
+	}{
+		{section: "", key: "global", want: "yes", ok: true},
+		{section: "D2HD", key: "Width", want: "1068", ok: true},
+		{section: "D2HD", key: "Height", want: "600", ok: true},
+		{section: "D2HD", key: "Fullscreen", want: "0", ok: true},
+		{section: "d2hd", key: "WIDTH", want: "1068", ok: true},
+		{section: "EXTRA", key: "zoom", want: "1", ok: true},
+		{section: "Extra", key: "Width"},
+		{section: "", key: "Width"},
+		{section: "D2HD", key: "not a key"},
+		{section: "Missing", key: "Width"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.section+"/"+tt.key, func(t *testing.T) {
+			got, ok := f.Get(tt.section, tt.key)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("expected %q %t, got %q %t", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		key     string
+		value   string
+		want    string
+	}{
+		{
+			name:    "existing key",
+			section: "D2HD",
+			key:     "Width",
+			value:   "1280",
+			want:    strings.Replace(testFile, "Width = 1068", "Width = 1280", 1),
+		},
+		{
+			name:    "existing key with indentation",
+			section: "d2hd",
+			key:     "height",
+			value:   "720",
+			want:    strings.Replace(testFile, "\tHeight=600", "\tHeight=720", 1),
+		},
+		{
+			name:    "same value",
+			section: "D2HD",
+			key:     "Fullscreen",
+			value:   "0",
+			want:    testFile,
+		},
+		{
+			name:    "new key",
+			section: "D2HD",
+			key:     "Vsync",
+			value:   "1",
+			want:    strings.Replace(testFile, "Fullscreen  =  0\n", "Fullscreen  =  0\nVsync=1\n", 1),
+		},
+		{
+			name:    "new key without a section",
+			section: "",
+			key:     "debug",
+			value:   "no",
+			want:    strings.Replace(testFile, "global = yes\n", "global = yes\ndebug=no\n", 1),
+		},
+		{
+			name:    "new section",
+			section: "Audio",
+			key:     "Volume",
+			value:   "80",
+			want:    testFile + "[Audio]\nVolume=80\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := parse(t, testFile)
+			f.Set(tt.section, tt.key, tt.value)
+
+			if got := string(f.Bytes()); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+
+			if got, ok := f.Get(tt.section, tt.key); !ok || got != tt.value {
+				t.Fatalf("expected %q, got %q", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestSetKeepsLineEndings(t *testing.T) {
+	f := parse(t, "[D2HD]\r\nWidth=1068\r\n")
+
+	f.Set("D2HD", "Height", "600")
+	f.Set("Audio", "Volume", "80")
+
+	want := "[D2HD]\r\nWidth=1068\r\nHeight=600\r\n[Audio]\r\nVolume=80\r\n"
+	if got := string(f.Bytes()); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSetWithoutSections(t *testing.T) {
+	f := parse(t, "[D2HD]\nWidth=1068\n")
+
+	// Keys without a section go before the first section.
+	f.Set("", "global", "yes")
+
+	want := "global=yes\n[D2HD]\nWidth=1068\n"
+	if got := string(f.Bytes()); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,263 @@
+package lootfilter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// FileName is the name of the loot filter config in the game directory.
+const FileName = "BH.cfg"
+
+// Kinds of lines in the config.
+const (
+	LineBlank = iota
+	LineComment
+	LineSetting
+	LineRule
+
+	// LineInvalid is a line that couldn't be parsed, it's kept as is.
+	LineInvalid
+)
+
+// rulePrefix starts every item display rule.
+const rulePrefix = "ItemDisplay["
+
+// Line is a single line of the config, kept as is unless it's been changed.
+// Rule lines are written from the rule, since rules can be moved between lines.
+type Line struct {
+	Kind    int
+	Raw     string
+	Setting *Setting
+	Rule    *Rule
+}
+
+// Setting is a key value setting, such as "Reveal Mode: 1".
+type Setting struct {
+	Key   string
+	Value string
+
+	original string
+}
+
+// Config is a parsed BH.cfg, it can be written back without losing comments or formatting.
+type Config struct {
+	Lines []*Line
+
+	// Line endings of the original file, so we write them back the same way.
+	eol          string
+	trailingLine bool
+}
+
+// Parse will parse a BH.cfg into a config.
+func Parse(r io.Reader) (*Config, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{
+		eol:          "\n",
+		trailingLine: bytes.HasSuffix(content, []byte("\n")),
+	}
+
+	if bytes.Contains(content, []byte("\r\n")) {
+		c.eol = "\r\n"
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	// Some filters have very long lines.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		c.Lines = append(c.Lines, parseLine(strings.TrimSuffix(scanner.Text(), "\r")))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func parseLine(raw string) *Line {
+	trimmed := strings.TrimSpace(raw)
+
+	switch {
+	case trimmed == "":
+		return &Line{Kind: LineBlank, Raw: raw}
+
+	case strings.HasPrefix(trimmed, "//"):
+		// Rules are disabled by commenting them out.
+		uncommented := strings.TrimSpace(strings.TrimPrefix(trimmed, "//"))
+		if strings.HasPrefix(uncommented, rulePrefix) {
+			if rule, err := parseRule(uncommented); err == nil {
+				rule.Enabled = false
+				rule.raw = raw
+				rule.original = rule.fields()
+				return &Line{Kind: LineRule, Raw: raw, Rule: rule}
+			}
+		}
+
+		return &Line{Kind: LineComment, Raw: raw}
+
+	case strings.HasPrefix(trimmed, rulePrefix):
+		rule, err := parseRule(trimmed)
+		if err != nil {
+			return &Line{Kind: LineInvalid, Raw: raw}
+		}
+
+		rule.raw = raw
+		rule.original = rule.fields()
+		return &Line{Kind: LineRule, Raw: raw, Rule: rule}
+	}
+
+	i := strings.Index(trimmed, ":")
+	if i <= 0 {
+		return &Line{Kind: LineInvalid, Raw: raw}
+	}
+
+	setting := &Setting{
+		Key:   strings.TrimSpace(trimmed[:i]),
+		Value: strings.TrimSpace(trimmed[i+1:]),
+	}
+	setting.original = setting.Value
+
+	return &Line{Kind: LineSetting, Raw: raw, Setting: setting}
+}
+
+// Rules returns the item display rules in the order they're applied.
+func (c *Config) Rules() []*Rule {
+	var rules []*Rule
+	for _, l := range c.Lines {
+		if l.Kind == LineRule {
+			rules = append(rules, l.Rule)
+		}
+	}
+
+	return rules
+}
+
+// MoveRule will move the rule at index from to index to, counting rules only.
+// Comments and settings stay where they are.
+func (c *Config) MoveRule(from, to int) error {
+	var slots []*Line
+	for _, l := range c.Lines {
+		if l.Kind == LineRule {
+			slots = append(slots, l)
+		}
+	}
+
+	if from < 0 || from >= len(slots) || to < 0 || to >= len(slots) {
+		return fmt.Errorf("regla fuera de rango: %d", from)
+	}
+
+	rules := c.Rules()
+	moved := rules[from]
+	rules = append(rules[:from], rules[from+1:]...)
+	rules = append(rules[:to], append([]*Rule{moved}, rules[to:]...)...)
+
+	// Rules keep their own raw line, so unchanged rules are written back as they were.
+	for i, slot := range slots {
+		slot.Rule = rules[i]
+	}
+
+	return nil
+}
+
+// Setting returns the value of the setting with the given key.
+func (c *Config) Setting(key string) (string, bool) {
+	for _, l := range c.Lines {
+		if l.Kind == LineSetting && l.Setting.Key == key {
+			return l.Setting.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// SetSetting will set the value of the setting, adding it to the end if it doesn't exist.
+func (c *Config) SetSetting(key, value string) {
+	for _, l := range c.Lines {
+		if l.Kind == LineSetting && l.Setting.Key == key {
+			l.Setting.Value = value
+			return
+		}
+	}
+
+	c.Lines = append(c.Lines, &Line{
+		Kind:    LineSetting,
+		Setting: &Setting{Key: key, Value: value},
+	})
+}
+
+// Validate returns an error for every rule that BH wouldn't understand.
+func (c *Config) Validate() []error {
+	var errs []error
+	for i, l := range c.Lines {
+		switch l.Kind {
+		case LineInvalid:
+			errs = append(errs, fmt.Errorf("linea %d: no se pudo leer: %s", i+1, strings.TrimSpace(l.Raw)))
+		case LineRule:
+			if err := l.Rule.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("linea %d: %s", i+1, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+// ValidateChanges returns an error for every rule changed since parsing that BH wouldn't understand.
+// Unchanged lines are written back as they were, so whatever BH made of them doesn't change.
+func (c *Config) ValidateChanges() []error {
+	var errs []error
+	for i, l := range c.Lines {
+		if l.Kind != LineRule || !l.Rule.changed() {
+			continue
+		}
+
+		if err := l.Rule.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("linea %d: %s", i+1, err))
+		}
+	}
+
+	return errs
+}
+
+// Bytes returns the config as it should be written to disk.
+func (c *Config) Bytes() []byte {
+	var buf bytes.Buffer
+
+	for i, l := range c.Lines {
+		buf.WriteString(l.String())
+
+		if i < len(c.Lines)-1 || c.trailingLine {
+			buf.WriteString(c.eol)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// String returns the line, only rewriting it if it's been changed.
+func (l *Line) String() string {
+	switch l.Kind {
+	case LineSetting:
+		// Settings added after parsing don't have a line yet.
+		if l.Raw == "" || l.Setting.Value != l.Setting.original {
+			return fmt.Sprintf("%s: %s", l.Setting.Key, l.Setting.Value)
+		}
+	case LineRule:
+		if l.Rule.changed() {
+			return l.Rule.String()
+		}
+
+		return l.Rule.raw
+	}
+
+	return l.Raw
+}
@@ -0,0 +1,282 @@
+package lootfilter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testConfig has a bit of everything BH.cfg can have.
+const testConfig = `// BH Config File
+Reveal Mode: 1
+Show Ethereal:   True
+
+//// Runes
+ItemDisplay[r33]: %ORANGE%%NAME% // Zod
+ItemDisplay[r32]: %ORANGE%%NAME%
+//ItemDisplay[r01]: %GRAY%%NAME%
+	ItemDisplay[SOCK>0]:   %GRAY%%NAME%
+This line is nonsense
+ItemDisplay[r02: broken
+`
+
+func parse(t *testing.T, content string) *Config {
+	t.Helper()
+
+	c, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func conditions(c *Config) []string {
+	var conditions []string
+	for _, r := range c.Rules() {
+		conditions = append(conditions, r.Condition)
+	}
+
+	return conditions
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "config", content: testConfig},
+		{name: "crlf", content: strings.Replace(testConfig, "\n", "\r\n", -1)},
+		{name: "no trailing line", content: strings.TrimSuffix(testConfig, "\n")},
+		{name: "blank lines", content: "\n\nReveal Mode: 1\n\n\n"},
+		{name: "empty", content: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(parse(t, tt.content).Bytes()); got != tt.content {
+				t.Fatalf("expected the config to be kept as is, got %q", got)
+			}
+		})
+	}
+}
+
+func TestParseLineKinds(t *testing.T) {
+	c := parse(t, testConfig)
+
+	want := []int{
+		LineComment, LineSetting, LineSetting, LineBlank, LineComment,
+		LineRule, LineRule, LineRule, LineRule, LineInvalid, LineInvalid,
+	}
+
+	if len(c.Lines) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(c.Lines))
+	}
+
+	for i, l := range c.Lines {
+		if l.Kind != want[i] {
+			t.Fatalf("expected line %d to be kind %d, got %d", i+1, want[i], l.Kind)
+		}
+	}
+
+	rules := c.Rules()
+	if rules[0].Comment != "Zod" || !rules[0].Enabled || rules[2].Enabled {
+		t.Fatalf("expected the rules to be parsed, got %+v", rules)
+	}
+}
+
+func TestMoveRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		want     []string
+	}{
+		{name: "down", from: 0, to: 2, want: []string{"r32", "r01", "r33", "SOCK>0"}},
+		{name: "up", from: 3, to: 0, want: []string{"SOCK>0", "r33", "r32", "r01"}},
+		{name: "to the end", from: 1, to: 3, want: []string{"r33", "r01", "SOCK>0", "r32"}},
+		{name: "same place", from: 2, to: 2, want: []string{"r33", "r32", "r01", "SOCK>0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := parse(t, testConfig)
+
+			if err := c.MoveRule(tt.from, tt.to); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got := conditions(c); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+
+			// Comments, settings and unknown lines stay where they are.
+			lines := strings.Split(string(c.Bytes()), "\n")
+			for _, i := range []int{0, 1, 2, 3, 4, 9, 10} {
+				if lines[i] != c.Lines[i].Raw {
+					t.Fatalf("expected line %d to be kept, got %q", i+1, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMoveRuleKeepsRuleLines(t *testing.T) {
+	c := parse(t, testConfig)
+
+	if err := c.MoveRule(3, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Rules move with their own formatting.
+	lines := strings.Split(string(c.Bytes()), "\n")
+	if lines[5] != "\tItemDisplay[SOCK>0]:   %GRAY%%NAME%" || lines[6] != "ItemDisplay[r33]: %ORANGE%%NAME% // Zod" {
+		t.Fatalf("expected the rules to keep their lines, got %q", lines[5:9])
+	}
+}
+
+func TestMoveRuleOutOfRange(t *testing.T) {
+	moves := [][2]int{{-1, 0}, {0, -1}, {4, 0}, {0, 4}}
+
+	for _, move := range moves {
+		c := parse(t, testConfig)
+
+		if err := c.MoveRule(move[0], move[1]); err == nil {
+			t.Fatalf("expected moving %d to %d to fail", move[0], move[1])
+		}
+
+		if got := string(c.Bytes()); got != testConfig {
+			t.Fatalf("expected the config to be unchanged, got %q", got)
+		}
+	}
+}
+
+func TestToggleRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+		line  int
+		want  string
+	}{
+		{name: "disable", index: 0, line: 5, want: "//ItemDisplay[r33]: %ORANGE%%NAME% // Zod"},
+		{name: "enable", index: 2, line: 7, want: "ItemDisplay[r01]: %GRAY%%NAME%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := parse(t, testConfig)
+			rule := c.Rules()[tt.index]
+
+			rule.Enabled = !rule.Enabled
+
+			lines := strings.Split(string(c.Bytes()), "\n")
+			if lines[tt.line] != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, lines[tt.line])
+			}
+
+			// Toggling it back writes the original line.
+			rule.Enabled = !rule.Enabled
+
+			if got := string(c.Bytes()); got != testConfig {
+				t.Fatalf("expected the config to be unchanged, got %q", got)
+			}
+		})
+	}
+}
+
+func TestSetSetting(t *testing.T) {
+	c := parse(t, testConfig)
+
+	c.SetSetting("Reveal Mode", "2")
+	c.SetSetting("Experience Meter", "On")
+
+	if value, ok := c.Setting("Reveal Mode"); !ok || value != "2" {
+		t.Fatalf("expected the setting to be changed, got %q", value)
+	}
+
+	lines := strings.Split(string(c.Bytes()), "\n")
+	if lines[1] != "Reveal Mode: 2" || lines[2] != "Show Ethereal:   True" {
+		t.Fatalf("expected only the changed setting to be rewritten, got %q", lines[1:3])
+	}
+
+	if lines[len(lines)-2] != "Experience Meter: On" {
+		t.Fatalf("expected the new setting at the end, got %q", lines[len(lines)-2])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := parse(t, testConfig+"ItemDisplay[(r33]: %NAME%\n")
+
+	errs := c.Validate()
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %v", errs)
+	}
+
+	for i, line := range []string{"linea 10", "linea 11", "linea 12"} {
+		if !strings.HasPrefix(errs[i].Error(), line) {
+			t.Fatalf("expected an error in %s, got %s", line, errs[i])
+		}
+	}
+}
+
+func TestValidateChanges(t *testing.T) {
+	c := parse(t, testConfig+"//ItemDisplay[(r33]: %NAME%\n")
+
+	// Lines BH already has to deal with don't block saving.
+	if errs := c.ValidateChanges(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+
+	// Moving rules doesn't change them either.
+	if err := c.MoveRule(4, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if errs := c.ValidateChanges(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+
+	// Enabling the broken rule does.
+	c.Rules()[0].Enabled = true
+
+	errs := c.ValidateChanges()
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "linea 6") {
+		t.Fatalf("expected an error in linea 6, got %v", errs)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lootfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, FileName)
+	s := &service{path: path, config: parse(t, testConfig+"//ItemDisplay[(r33]: %NAME%\n")}
+
+	// Unknown and invalid lines the user hasn't touched are written back as they were.
+	s.config.Rules()[0].Enabled = false
+
+	if err := s.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := strings.Replace(testConfig, "ItemDisplay[r33]", "//ItemDisplay[r33]", 1) + "//ItemDisplay[(r33]: %NAME%\n"
+	if got, _ := ioutil.ReadFile(path); string(got) != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// Changed rules BH can't read block saving.
+	s.config.Rules()[4].Enabled = true
+
+	if err := s.Save(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got, _ := ioutil.ReadFile(path); string(got) != want {
+		t.Fatalf("expected the saved filter to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package lootfilter
+
+import (
+	"github.com/therecipe/qt/core"
+)
+
+// RuleItem represents an item display rule in the model.
+type RuleItem struct {
+	core.QObject
+
+	Condition string
+	Display   string
+	Comment   string
+	Enabled   bool
+	Error     string
+}
+
+// Model Roles.
+const (
+	Condition = int(core.Qt__UserRole) + 1<<iota
+	Display
+	Comment
+	Enabled
+	Error
+)
+
+// RuleModel is the model used for the item display rules of a game.
+type RuleModel struct {
+	core.QAbstractListModel
+
+	_ func() `constructor:"init"`
+
+	_ map[int]*core.QByteArray `property:"roles"`
+	_ []*RuleItem              `property:"rules"`
+
+	_ func(*RuleItem) `slot:"addRule"`
+	_ func()          `slot:"clear"`
+}
+
+func (m *RuleModel) init() {
+	m.SetRoles(map[int]*core.QByteArray{
+		Condition: core.NewQByteArray2("condition", -1),
+		Display:   core.NewQByteArray2("display", -1),
+		Comment:   core.NewQByteArray2("comment", -1),
+		Enabled:   core.NewQByteArray2("enabled", -1),
+		Error:     core.NewQByteArray2("error", -1),
+	})
+
+	m.ConnectData(m.data)
+	m.ConnectRowCount(m.rowCount)
+	m.ConnectColumnCount(m.columnCount)
+	m.ConnectRoleNames(m.roleNames)
+	m.ConnectAddRule(m.addRule)
+	m.ConnectClear(m.clear)
+}
+
+func (m *RuleModel) rowCount(*core.QModelIndex) int {
+	return len(m.Rules())
+}
+
+func (m *RuleModel) columnCount(*core.QModelIndex) int {
+	return 1
+}
+
+func (m *RuleModel) roleNames() map[int]*core.QByteArray {
+	return m.Roles()
+}
+
+func (m *RuleModel) data(index *core.QModelIndex, role int) *core.QVariant {
+	if !index.IsValid() {
+		return core.NewQVariant()
+	}
+
+	if index.Row() >= len(m.Rules()) {
+		return core.NewQVariant()
+	}
+
+	item := m.Rules()[index.Row()]
+
+	switch role {
+	case Condition:
+		return core.NewQVariant1(item.Condition)
+	case Display:
+		return core.NewQVariant1(item.Display)
+	case Comment:
+		return core.NewQVariant1(item.Comment)
+	case Enabled:
+		return core.NewQVariant1(item.Enabled)
+	case Error:
+		return core.NewQVariant1(item.Error)
+	default:
+		return core.NewQVariant()
+	}
+}
+
+// addRule adds a rule to the model.
+func (m *RuleModel) addRule(r *RuleItem) {
+	m.BeginInsertRows(core.NewQModelIndex(), len(m.Rules()), len(m.Rules()))
+	m.SetRules(append(m.Rules(), r))
+	m.EndInsertRows()
+}
+
+func (m *RuleModel) clear() {
+	m.BeginResetModel()
+	m.SetRules([]*RuleItem{})
+	m.EndResetModel()
+}
+
+func init() {
+	RuleModel_QRegisterMetaType()
+	RuleItem_QRegisterMetaType()
+}
@@ -0,0 +1,173 @@
+package lootfilter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Rule is an item display rule, such as "ItemDisplay[r33]: %ORANGE%%NAME%".
+// Items matching the condition are shown with the display, an empty display hides them.
+type Rule struct {
+	Condition string
+	Display   string
+
+	// Comment is the trailing comment of the rule, without the slashes.
+	Comment string
+
+	// Disabled rules are commented out.
+	Enabled bool
+
+	// The line the rule was parsed from, and its fields at the time.
+	raw      string
+	original ruleFields
+}
+
+type ruleFields struct {
+	condition string
+	display   string
+	comment   string
+	enabled   bool
+}
+
+var (
+	// ErrRuleNoCondition is used when a rule doesn't have a condition.
+	ErrRuleNoCondition = errors.New("la regla no tiene condicion")
+
+	// ErrRuleParentheses is used when the parentheses of a condition aren't balanced.
+	ErrRuleParentheses = errors.New("los parentesis de la condicion no estan balanceados")
+)
+
+// comparisons are the operators allowed in a condition, such as "SOCK>0".
+const comparisons = "<>=~"
+
+// parseRule will parse a rule without the leading comment slashes.
+func parseRule(line string) (*Rule, error) {
+	rest := strings.TrimPrefix(line, rulePrefix)
+
+	end := strings.Index(rest, "]")
+	if end < 0 {
+		return nil, fmt.Errorf("falta ] en la regla: %s", line)
+	}
+
+	display := strings.TrimSpace(rest[end+1:])
+	if !strings.HasPrefix(display, ":") {
+		return nil, fmt.Errorf("falta : en la regla: %s", line)
+	}
+
+	rule := &Rule{
+		Condition: strings.TrimSpace(rest[:end]),
+		Display:   strings.TrimSpace(strings.TrimPrefix(display, ":")),
+		Enabled:   true,
+	}
+
+	// Trailing comments are separated by whitespace, so links in the display aren't cut.
+	padded := " " + rule.Display
+	for _, sep := range []string{" //", "\t//"} {
+		if i := strings.Index(padded, sep); i >= 0 {
+			rule.Comment = strings.TrimSpace(padded[i+len(sep):])
+			rule.Display = strings.TrimSpace(padded[:i])
+			break
+		}
+	}
+
+	return rule, nil
+}
+
+// Validate will make sure BH can understand the rule.
+func (r *Rule) Validate() error {
+	condition := strings.TrimSpace(r.Condition)
+	if condition == "" {
+		return ErrRuleNoCondition
+	}
+
+	if strings.ContainsAny(condition, "[]") || strings.ContainsAny(r.Display, "\r\n") {
+		return fmt.Errorf("caracteres invalidos en la regla: %s", r.String())
+	}
+
+	depth := 0
+	for _, c := range condition {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+
+		if depth < 0 {
+			return ErrRuleParentheses
+		}
+	}
+
+	if depth != 0 {
+		return ErrRuleParentheses
+	}
+
+	// Every comparison needs a value, such as "CLVL>80".
+	for _, token := range strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(condition)) {
+		if strings.ContainsAny(token[len(token)-1:], comparisons) {
+			return fmt.Errorf("la comparacion %s no tiene valor", token)
+		}
+	}
+
+	return validateDisplay(r.Display)
+}
+
+// validateDisplay makes sure every keyword in the display, such as %NAME%, is closed.
+func validateDisplay(display string) error {
+	rest := display
+	for {
+		start := strings.Index(rest, "%")
+		if start < 0 {
+			return nil
+		}
+
+		end := strings.Index(rest[start+1:], "%")
+		if end < 0 {
+			return fmt.Errorf("falta %% al final de la palabra clave en: %s", display)
+		}
+
+		keyword := rest[start+1 : start+1+end]
+		if keyword == "" || strings.ContainsAny(keyword, " \t") {
+			return fmt.Errorf("palabra clave invalida %%%s%% en: %s", keyword, display)
+		}
+
+		rest = rest[start+end+2:]
+	}
+}
+
+// String returns the rule as it's written in the config.
+func (r *Rule) String() string {
+	var b strings.Builder
+
+	if !r.Enabled {
+		b.WriteString("//")
+	}
+
+	b.WriteString(fmt.Sprintf("%s%s]:", rulePrefix, r.Condition))
+
+	// Rules without a display hide the item.
+	if r.Display != "" {
+		b.WriteString(fmt.Sprintf(" %s", r.Display))
+	}
+
+	if r.Comment != "" {
+		b.WriteString(fmt.Sprintf(" // %s", r.Comment))
+	}
+
+	return b.String()
+}
+
+func (r *Rule) fields() ruleFields {
+	return ruleFields{
+		condition: r.Condition,
+		display:   r.Display,
+		comment:   r.Comment,
+		enabled:   r.Enabled,
+	}
+}
+
+// changed tells if the rule has been changed since it was parsed.
+func (r *Rule) changed() bool {
+	return r.raw == "" || r.fields() != r.original
+}
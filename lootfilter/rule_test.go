@@ -0,0 +1,119 @@
+package lootfilter
+
+import (
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		line      string
+		condition string
+		display   string
+		comment   string
+	}{
+		{line: "ItemDisplay[r33]: %ORANGE%%NAME%", condition: "r33", display: "%ORANGE%%NAME%"},
+		{line: "ItemDisplay[ SOCK>0 ]:   %GRAY%%NAME%  ", condition: "SOCK>0", display: "%GRAY%%NAME%"},
+		{line: "ItemDisplay[hp1]:", condition: "hp1", display: ""},
+		{line: "ItemDisplay[r33]: %ORANGE%%NAME% // Zod", condition: "r33", display: "%ORANGE%%NAME%", comment: "Zod"},
+		{line: "ItemDisplay[r33]: %ORANGE%%NAME%\t// Zod", condition: "r33", display: "%ORANGE%%NAME%", comment: "Zod"},
+		{line: "ItemDisplay[hp1]: // hidden", condition: "hp1", display: "", comment: "hidden"},
+		{line: "ItemDisplay[r33]: %NAME% http://example.com", condition: "r33", display: "%NAME% http://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			rule, err := parseRule(tt.line)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if rule.Condition != tt.condition || rule.Display != tt.display || rule.Comment != tt.comment {
+				t.Fatalf("expected %q %q %q, got %q %q %q", tt.condition, tt.display, tt.comment, rule.Condition, rule.Display, rule.Comment)
+			}
+
+			if !rule.Enabled {
+				t.Fatal("expected the rule to be enabled")
+			}
+		})
+	}
+}
+
+func TestParseRuleInvalid(t *testing.T) {
+	lines := []string{
+		"ItemDisplay[r33: %NAME%",
+		"ItemDisplay[r33] %NAME%",
+	}
+
+	for _, line := range lines {
+		t.Run(line, func(t *testing.T) {
+			if rule, err := parseRule(line); err == nil {
+				t.Fatalf("expected an error, got %+v", rule)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "valid", rule: Rule{Condition: "r33", Display: "%ORANGE%%NAME%"}},
+		{name: "hidden", rule: Rule{Condition: "hp1", Display: ""}},
+		{name: "comparison", rule: Rule{Condition: "SOCK>0 CLVL<90", Display: "%NAME%"}},
+		{name: "parentheses", rule: Rule{Condition: "(r33 OR r32) AND !ETH", Display: "%NAME%"}},
+		{name: "no condition", rule: Rule{Condition: "  ", Display: "%NAME%"}, wantErr: true},
+		{name: "brackets", rule: Rule{Condition: "r33]", Display: "%NAME%"}, wantErr: true},
+		{name: "new line in display", rule: Rule{Condition: "r33", Display: "%NAME%\n"}, wantErr: true},
+		{name: "unclosed parenthesis", rule: Rule{Condition: "(r33 OR r32", Display: "%NAME%"}, wantErr: true},
+		{name: "closed parenthesis first", rule: Rule{Condition: ")r33(", Display: "%NAME%"}, wantErr: true},
+		{name: "comparison without value", rule: Rule{Condition: "CLVL>", Display: "%NAME%"}, wantErr: true},
+		{name: "unclosed keyword", rule: Rule{Condition: "r33", Display: "%ORANGE%%NAME"}, wantErr: true},
+		{name: "empty keyword", rule: Rule{Condition: "r33", Display: "%%"}, wantErr: true},
+		{name: "keyword with spaces", rule: Rule{Condition: "r33", Display: "%ORANGE NAME%"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want string
+	}{
+		{rule: Rule{Condition: "r33", Display: "%NAME%", Enabled: true}, want: "ItemDisplay[r33]: %NAME%"},
+		{rule: Rule{Condition: "r33", Display: "%NAME%"}, want: "//ItemDisplay[r33]: %NAME%"},
+		{rule: Rule{Condition: "hp1", Enabled: true}, want: "ItemDisplay[hp1]:"},
+		{rule: Rule{Condition: "r33", Display: "%NAME%", Comment: "Zod", Enabled: true}, want: "ItemDisplay[r33]: %NAME% // Zod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.rule.String(); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+
+			// Written rules parse back to the same rule.
+			line := parseLine(tt.want)
+			if line.Kind != LineRule {
+				t.Fatalf("expected a rule, got kind %d", line.Kind)
+			}
+
+			if line.Rule.fields() != tt.rule.fields() {
+				t.Fatalf("expected %+v, got %+v", tt.rule.fields(), line.Rule.fields())
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package lootfilter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/d2"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
+)
+
+// Service is responsible for editing the loot filter of the games.
+type Service interface {
+	// Load will read the loot filter of the game and set its rules on the model.
+	Load(gameID string) error
+
+	// ToggleRule will enable or disable the rule at the given index.
+	ToggleRule(index int) error
+
+	// MoveRule will move the rule at index from to index to.
+	MoveRule(from, to int) error
+
+	// Save will validate the rules changed in the loot filter and write it back to the game.
+	Save() error
+}
+
+// ErrNotLoaded is used when editing before a loot filter has been loaded.
+var ErrNotLoaded = errors.New("no hay un filtro de objetos cargado")
+
+type service struct {
+	configService config.Service
+	ruleModel     *RuleModel
+	mux           sync.Mutex
+
+	// The loot filter being edited, and where it's written to.
+	path   string
+	config *Config
+}
+
+// Load will read the loot filter of the game and set its rules on the model.
+func (s *service) Load(gameID string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	conf, err := s.configService.Read()
+	if err != nil {
+		return err
+	}
+
+	var game *storage.Game
+	for i := range conf.Games {
+		if conf.Games[i].ID == gameID {
+			game = &conf.Games[i]
+		}
+	}
+
+	if game == nil {
+		return config.ErrGameNotFound
+	}
+
+	path := d2.GameFilePath(game.Location, FileName)
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s no existe, instale el maphack primero", FileName)
+		}
+
+		return err
+	}
+
+	c, err := Parse(bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+
+	s.path = path
+	s.config = c
+	s.updateModel()
+
+	return nil
+}
+
+// ToggleRule will enable or disable the rule at the given index.
+func (s *service) ToggleRule(index int) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.config == nil {
+		return ErrNotLoaded
+	}
+
+	rules := s.config.Rules()
+	if index < 0 || index >= len(rules) {
+		return fmt.Errorf("regla fuera de rango: %d", index)
+	}
+
+	rules[index].Enabled = !rules[index].Enabled
+	s.updateModel()
+
+	return nil
+}
+
+// MoveRule will move the rule at index from to index to.
+func (s *service) MoveRule(from, to int) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.config == nil {
+		return ErrNotLoaded
+	}
+
+	if err := s.config.MoveRule(from, to); err != nil {
+		return err
+	}
+
+	s.updateModel()
+
+	return nil
+}
+
+// Save will validate the rules changed in the loot filter and write it back to the game.
+func (s *service) Save() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.config == nil {
+		return ErrNotLoaded
+	}
+
+	// Never write a rule BH can't read, the lines the user hasn't touched are kept as they were.
+	if errs := s.config.ValidateChanges(); len(errs) > 0 {
+		return fmt.Errorf("el filtro tiene %d errores, %s", len(errs), errs[0])
+	}
+
+	// Write to a temporary file first, so the filter is never left half written.
+	tmpPath := fmt.Sprintf("%s.tmp", s.path)
+	if err := ioutil.WriteFile(tmpPath, s.config.Bytes(), storage.Permissions); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+// updateModel will set the rules of the loaded loot filter on the model.
+func (s *service) updateModel() {
+	s.ruleModel.Clear()
+
+	for _, r := range s.config.Rules() {
+		item := NewRuleItem(nil)
+		item.Condition = r.Condition
+		item.Display = r.Display
+		item.Comment = r.Comment
+		item.Enabled = r.Enabled
+
+		if err := r.Validate(); err != nil {
+			item.Error = err.Error()
+		}
+
+		s.ruleModel.AddRule(item)
+	}
+}
+
+// NewService returns a service with all the dependencies.
+func NewService(
+	configService config.Service,
+	ruleModel *RuleModel,
+) Service {
+	return &service{
+		configService: configService,
+		ruleModel:     ruleModel,
+	}
+}
@@ -5,12 +5,15 @@ package main
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"os"
 	"strconv"
 
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/bridge"
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/config"
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/d2"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/discovery"
+	"github.com/lhermosilla/hiddengamersdiablo-launcher/lootfilter"
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/news"
 	"github.com/lhermosilla/hiddengamersdiablo-launcher/storage"
 	"github.com/nokka/goqmlframeless"
@@ -36,6 +39,11 @@ func main() {
 	core.QCoreApplication_SetOrganizationDomain("hiddengamers.cl")
 	core.QCoreApplication_SetApplicationVersion("1.0.1")
 
+	// Commands run from the command line don't start the launcher.
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	// Enable high dpi scaling, useful for devices with high pixel density displays.
 	core.QCoreApplication_SetAttribute(core.Qt__AA_EnableHighDpiScaling, true)
 
@@ -76,13 +84,13 @@ func main() {
 	// Setup local storage.
 	store := storage.NewStore(configPath)
 	if err := store.Load(); err != nil {
-		logger.Error(errors.New("unable to load config"))
+		logger.Error(fmt.Errorf("unable to load config: %s", err))
 		os.Exit(0)
 	}
 
 	conf, err := store.Read()
 	if err != nil {
-		logger.Error(errors.New("unable to read config"))
+		logger.Error(fmt.Errorf("unable to read config: %s", err))
 		os.Exit(0)
 	}
 
@@ -91,6 +99,7 @@ func main() {
 	gm := config.NewGameModel(nil)
 	nm := news.NewModel(nil)
 	fm := d2.NewFileModel(nil)
+	rm := lootfilter.NewRuleModel(nil)
 
 	// Setup clients.
 	md := hiddengamersdiablo.NewClient()
@@ -102,16 +111,15 @@ func main() {
 	d2s := d2.NewService(md, cs, logger, fm)
 	ls := ladder.NewService(lc, lm)
 	ns := news.NewService(md, nm)
-
-	// Populate the game model with the game config
-	// before passing it to the config bridge.
-	populateGameModel(conf, gm)
+	lfs := lootfilter.NewService(cs, rm)
+	ds := discovery.NewService(cs)
 
 	// Setup QML bridges with all dependencies.
-	diabloBridge := bridge.NewDiablo(d2s, fm, conf.LaunchDelay, logger)
-	configBridge := bridge.NewConfig(cs, gm, configPath, logger)
+	diabloBridge := bridge.NewDiablo(d2s, cs, fm, conf.LaunchDelay, conf.DownloadRateLimit, logger)
+	configBridge := bridge.NewConfig(cs, ds, gm, configPath, logger)
 	ladderBridge := bridge.NewLadder(ls, lm, logger)
 	newsBridge := bridge.NewNews(ns, nm, logger)
+	lootFilterBridge := bridge.NewLootFilter(lfs, rm, logger)
 
 	// Add bridges to QML.
 	qmlWidget.RootContext().SetContextProperty("diablo", diabloBridge)
@@ -126,6 +134,9 @@ func main() {
 	qmlWidget.RootContext().SetContextProperty("news", newsBridge)
 	newsBridge.Connect()
 
+	qmlWidget.RootContext().SetContextProperty("lootFilter", lootFilterBridge)
+	lootFilterBridge.Connect()
+
 	// Set build version on the bridge to inform the gui.
 	configBridge.SetBuildVersion(buildVersion)
 
@@ -157,21 +168,6 @@ func getConfigPath() (string, error) {
 	return locations[0], nil
 }
 
-func populateGameModel(conf *storage.Config, gm *config.GameModel) {
-	for _, game := range conf.Games {
-		g := config.NewGame(nil)
-		g.ID = game.ID
-		g.Location = game.Location
-		g.Instances = game.Instances
-		g.OverrideBHCfg = game.OverrideBHCfg
-		g.Flags = game.Flags
-		g.HDVersion = game.HDVersion
-		g.MaphackVersion = game.MaphackVersion
-
-		gm.AddGame(g)
-	}
-}
-
 // enableDebugger will capture stdout and stderr output.
 func enableDebugger(logger log.Logger) {
 	r, w, err := os.Pipe()
@@ -0,0 +1,65 @@
+import QtQuick 2.12
+import QtQuick.Dialogs 1.3      // FileDialog
+
+// BootstrapGame creates a new install from the files of the original installers, such as the
+// contents of the discs, and patches it to the current version.
+Column {
+    id: bootstrapGame
+    spacing: 5
+
+    // Folder with the original installer files, kept until the target is chosen.
+    property string source: ""
+
+    // Emitted when the install has started.
+    signal started()
+
+    Title {
+        text: "Instalar desde los archivos originales"
+        font.bold: true
+
+        MouseArea {
+            anchors.fill: parent
+            cursorShape: Qt.PointingHandCursor
+            enabled: !diablo.patching
+            onClicked: sourceDialog.open()
+        }
+    }
+
+    SText {
+        text: "Elige la carpeta con los MPQ de los discos de Diablo II y Lord of Destruction."
+        width: parent.width
+        wrapMode: Text.WordWrap
+        font.pixelSize: 10
+        color: "#676767"
+    }
+
+    // Installer files dialog.
+    FileDialog {
+        id: sourceDialog
+        title: "Archivos originales"
+        selectFolder: true
+        folder: shortcuts.home
+
+        onAccepted: {
+            var path = sourceDialog.fileUrl.toString()
+            bootstrapGame.source = path.replace(/^(file:\/{2})/,"")
+            targetDialog.open()
+        }
+    }
+
+    // Install target dialog.
+    FileDialog {
+        id: targetDialog
+        title: "Carpeta de la nueva instalacion"
+        selectFolder: true
+        folder: shortcuts.home
+
+        onAccepted: {
+            var path = targetDialog.fileUrl.toString()
+            path = path.replace(/^(file:\/{2})/,"")
+
+            diablo.bootstrapGame(bootstrapGame.source, path)
+            bootstrapGame.started()
+        }
+    }
+}
@@ -0,0 +1,97 @@
+import QtQuick 2.12
+import QtQuick.Dialogs 1.3      // FileDialog
+
+// DiscoveredGames lists the Diablo II installs found on disk, so they can be added with a click.
+Column {
+    id: discoveredGames
+    spacing: 5
+
+    property var candidates: JSON.parse(settings.discoveredGames)
+
+    // Emitted when an install has been added to the game model.
+    signal added()
+
+    Row {
+        spacing: 15
+
+        Title {
+            text: (settings.discovering ? "Buscando instalaciones..." : "Buscar instalaciones")
+            font.bold: true
+
+            MouseArea {
+                anchors.fill: parent
+                cursorShape: Qt.PointingHandCursor
+                enabled: !settings.discovering
+                onClicked: settings.discoverGames("")
+            }
+        }
+
+        Title {
+            text: "Buscar en otra carpeta"
+            visible: !settings.discovering
+            color: "#676767"
+
+            MouseArea {
+                anchors.fill: parent
+                cursorShape: Qt.PointingHandCursor
+                onClicked: rootDialog.open()
+            }
+        }
+    }
+
+    Repeater {
+        model: discoveredGames.candidates
+
+        delegate: Item {
+            width: discoveredGames.width
+            height: 36
+
+            Column {
+                width: parent.width - 80
+                anchors.verticalCenter: parent.verticalCenter
+
+                SText {
+                    text: modelData.location
+                    width: parent.width
+                    elide: Text.ElideMiddle
+                    font.pixelSize: 11
+                    color: "#a3a3a3"
+                }
+
+                SText {
+                    text: (modelData.version != "" ? "Version " + modelData.version : "Version desconocida")
+                    font.pixelSize: 10
+                    color: "#676767"
+                }
+            }
+
+            Title {
+                text: "+ Agregar"
+                anchors.right: parent.right
+                anchors.verticalCenter: parent.verticalCenter
+
+                MouseArea {
+                    anchors.fill: parent
+                    cursorShape: Qt.PointingHandCursor
+                    onClicked: {
+                        settings.addDiscoveredGame(modelData.location)
+                        discoveredGames.added()
+                    }
+                }
+            }
+        }
+    }
+
+    // Folder dialog to look for installs somewhere else.
+    FileDialog {
+        id: rootDialog
+        selectFolder: true
+        folder: shortcuts.home
+
+        onAccepted: {
+            var path = rootDialog.fileUrl.toString()
+            path = path.replace(/^(file:\/{2})/,"")
+            settings.discoverGames(path)
+        }
+    }
+}
@@ -9,8 +9,16 @@ Item {
     property bool depError: false
     property int activeHDIndex: 0
     property int activeMaphackIndex: 0
+    property int activeResolutionIndex: 0
+
+    // Set once the user changes the HD settings, they're only saved then,
+    // so saving anything else keeps the settings already in the game.
+    property bool hdSettingsChanged: false
     property int boxHeight: 58
 
+    // Emitted when the game has started cloning, progress is shown the same way as patching.
+    signal cloneStarted()
+
     function setGame(current) {
         // Set current game instance to the view.
         game = current
@@ -25,6 +33,7 @@ Item {
         updateToggleBoxes(current)
         updateHDVersions(current)
         updateMaphackVersions(current)
+        updateHDSettings(current)
 
     }
 
@@ -76,6 +85,16 @@ Item {
         maphackVersion.currentIndex = 0
     }
 
+    // updateHDSettings will set the HD mod settings of the game.
+    function updateHDSettings(current) {
+        // Default to the resolution the mod ships with.
+        var index = settings.availableHDResolutions.indexOf(current.hd_resolution)
+        activeResolutionIndex = (index == -1 ? 0 : index + 1)
+        hdResolution.currentIndex = activeResolutionIndex
+        hdFullscreenSwitch.checked = (current.hd_fullscreen != undefined ? current.hd_fullscreen : false)
+        hdSettingsChanged = false
+    }
+
     function makeFlagList() {
         var flags = []
         if(windowModeFlag.active) {
@@ -116,7 +135,14 @@ Item {
                 hd_version: hdVersion.currentText,
                 maphack_version: maphackVersion.currentText
             }
-            
+
+            if(hdSettingsChanged) {
+                body.hd_settings = {
+                    resolution: (hdResolution.currentIndex > 0 ? hdResolution.currentText : ""),
+                    fullscreen: hdFullscreenSwitch.checked
+                }
+            }
+
             settings.upsertGame(JSON.stringify(body))
         }
     }
@@ -158,7 +184,7 @@ Item {
 
                     TextField {
                         id: d2pathInput
-                        width: fileDialogBox.width * 0.80; height: 35
+                        width: fileDialogBox.width * (d2pathInput.text.length > 0 ? 0.65 : 0.80); height: 35
                         font.pixelSize: 11
                         color: "#676767"
                         readOnly: true
@@ -180,6 +206,33 @@ Item {
                         onClicked: d2PathDialog.open()
                     }
 
+                    // Copies the install into another folder, as a new game with the same settings.
+                    SButton {
+                        label: "Clonar"
+                        visible: (d2pathInput.text.length > 0)
+                        borderRadius: 0
+                        borderColor: "#373737"
+                        width: fileDialogBox.width * 0.15; height: 35
+                        cursorShape: Qt.PointingHandCursor
+
+                        onClicked: cloneDialog.open()
+                    }
+
+                    // Clone target dialog.
+                    FileDialog {
+                        id: cloneDialog
+                        selectFolder: true
+                        folder: shortcuts.home
+
+                        onAccepted: {
+                            var path = cloneDialog.fileUrl.toString()
+                            path = path.replace(/^(file:\/{2})/,"")
+
+                            diablo.cloneGame(game.id, path)
+                            cloneStarted()
+                        }
+                    }
+
                     // File dialog.
                     FileDialog {
                         id: d2PathDialog
@@ -411,6 +464,81 @@ Item {
                 Separator{}
             }
 
+            // HD settings, written to the HD mod when it's installed.
+            Item {
+                visible: (hdVersion.currentIndex > 0)
+                Layout.preferredWidth: settingsLayout.width
+                Layout.preferredHeight: boxHeight
+
+                Row {
+                    topPadding: 10
+
+                    Column {
+                        width: (settingsLayout.width - hdSettingsControls.width)
+                        Title {
+                            text: "AJUSTES HD MOD"
+                            font.pixelSize: 13
+                        }
+
+                        SText {
+                            text: "Resolucion y pantalla completa, se mantienen al cambiar de version"
+                            font.pixelSize: 11
+                            topPadding: 5
+                            color: "#676767"
+                        }
+                    }
+                    Row {
+                        id: hdSettingsControls
+                        width: 170
+                        spacing: 10
+
+                        Dropdown{
+                            id: hdResolution
+                            currentIndex: activeResolutionIndex
+                            model: ["Por defecto"].concat(settings.availableHDResolutions)
+                            height: 30
+                            width: 110
+
+                            onActivated: {
+                                hdSettingsChanged = true
+                                updateGameModel()
+                            }
+                        }
+
+                        SSwitch{
+                            id: hdFullscreenSwitch
+                            onToggled: {
+                                hdSettingsChanged = true
+                                updateGameModel()
+                            }
+                        }
+                    }
+                }
+
+                Separator{}
+            }
+
+            // Mod issue, shown when the chosen mods don't work together.
+            Item {
+                visible: (settings.modIssue.length > 0)
+                Layout.preferredWidth: settingsLayout.width
+                Layout.preferredHeight: 30
+
+                Rectangle {
+                    anchors.fill: parent
+                    color: "#8f3131"
+                    border.width: 1
+                    border.color: "#000000"
+
+                    SText {
+                        text: settings.modIssue
+                        font.pixelSize: 11
+                        anchors.centerIn: parent
+                        color: "#ffffff"
+                    }
+                }
+            }
+
             // Use default maphack config.
             Item {
                 Layout.preferredWidth: settingsLayout.width
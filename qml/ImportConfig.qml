@@ -0,0 +1,166 @@
+import QtQuick 2.12
+import QtQuick.Dialogs 1.3      // FileDialog
+
+// ImportConfig shows the games of the shared config being imported, and where they'll be imported to.
+Rectangle {
+    id: importConfig
+    visible: (settings.importPlan != "")
+    color: "#0f0f0f"
+    border.color: "#000000"
+    border.width: 1
+
+    property var plan: (settings.importPlan != "" ? JSON.parse(settings.importPlan) : { "games": [] })
+
+    // Index of the game being mapped to another install.
+    property int mappingIndex: -1
+
+    // Emitted when the games have been imported.
+    signal imported()
+
+    // Don't let clicks through to the settings below.
+    MouseArea {
+        anchors.fill: parent
+    }
+
+    Title {
+        id: importTitle
+        text: "IMPORTAR CONFIGURACION"
+        anchors.top: parent.top
+        anchors.left: parent.left
+        anchors.topMargin: 20
+        anchors.leftMargin: 30
+        font.pixelSize: 15
+        font.bold: true
+    }
+
+    Column {
+        id: importGames
+        width: parent.width - 60
+        anchors.top: importTitle.bottom
+        anchors.left: parent.left
+        anchors.topMargin: 20
+        anchors.leftMargin: 30
+        spacing: 10
+
+        Repeater {
+            model: importConfig.plan.games
+
+            delegate: Item {
+                width: importGames.width
+                height: importColumn.height
+
+                Column {
+                    id: importColumn
+                    width: parent.width - 100
+                    spacing: 2
+
+                    SText {
+                        text: modelData.location
+                        width: parent.width
+                        elide: Text.ElideMiddle
+                        font.pixelSize: 11
+                        color: (modelData.found ? "#a3a3a3" : "#8f3131")
+                    }
+
+                    SText {
+                        text: (modelData.found ? modelData.shared : "No se encontro Diablo II, elige donde esta instalado o se importara sin ubicacion")
+                        width: parent.width
+                        elide: Text.ElideMiddle
+                        font.pixelSize: 10
+                        color: "#676767"
+                    }
+
+                    Repeater {
+                        model: modelData.issues
+
+                        SText {
+                            text: modelData.reason
+                            width: importColumn.width
+                            wrapMode: Text.WordWrap
+                            font.pixelSize: 10
+                            color: (modelData.severity == "error" ? "#8f3131" : "#a3a3a3")
+                        }
+                    }
+                }
+
+                Title {
+                    text: "Cambiar"
+                    anchors.right: parent.right
+                    anchors.top: parent.top
+
+                    MouseArea {
+                        anchors.fill: parent
+                        cursorShape: Qt.PointingHandCursor
+                        onClicked: {
+                            importConfig.mappingIndex = index
+                            locationDialog.open()
+                        }
+                    }
+                }
+            }
+        }
+
+        SText {
+            text: settings.shareError
+            visible: (settings.shareError != "")
+            width: parent.width
+            wrapMode: Text.WordWrap
+            font.pixelSize: 11
+            color: "#8f3131"
+        }
+    }
+
+    Row {
+        spacing: 15
+        anchors.bottom: parent.bottom
+        anchors.left: parent.left
+        anchors.bottomMargin: 30
+        anchors.leftMargin: 30
+
+        // Keeps the current games, the ones in the same installs are updated.
+        PlainButton {
+            label: "COMBINAR"
+            width: 130
+            height: 50
+
+            onClicked: {
+                if(settings.applyImport(false)) {
+                    importConfig.imported()
+                }
+            }
+        }
+
+        PlainButton {
+            label: "REEMPLAZAR"
+            width: 130
+            height: 50
+
+            onClicked: {
+                if(settings.applyImport(true)) {
+                    importConfig.imported()
+                }
+            }
+        }
+
+        PlainButton {
+            label: "CANCELAR"
+            width: 130
+            height: 50
+
+            onClicked: settings.cancelImport()
+        }
+    }
+
+    // Install location dialog.
+    FileDialog {
+        id: locationDialog
+        selectFolder: true
+        folder: shortcuts.home
+
+        onAccepted: {
+            var path = locationDialog.fileUrl.toString()
+            path = path.replace(/^(file:\/{2})/,"")
+            settings.setImportLocation(importConfig.mappingIndex, path)
+        }
+    }
+}
@@ -38,7 +38,7 @@ Item {
             height: row.height
 
             Text {
-                color: (model.fileAction == "descargar" ? "#64d168" : "#fa5757")
+                color: (model.fileAction == "descargar" || model.fileAction == "combinar" || model.fileAction == "ajustar" ? "#64d168" : (model.fileAction == "eliminar" || model.fileAction == "desconocido" ? "#fa5757" : "#969696"))
                 font.pixelSize: 12
                 font.family: beaufortbold.name
                 text: model.fileAction
@@ -126,5 +126,25 @@ Popup {
 
             onClicked: patchPopup.close()
         }
+
+        // Unknown files can be moved out of the game, they might get the player banned.
+        PlainButton {
+            label: "CUARENTENA"
+            width: 120
+            height: 50
+            visible: diablo.rogueFiles > 0
+            anchors.bottom: parent.bottom
+            anchors.bottomMargin: -25
+            anchors.left: closeButton.right
+            anchors.leftMargin: 10
+
+            onClicked: {
+                if(diablo.quarantineFiles()) {
+                    // Check the games again, so the quarantined files are gone from the list.
+                    diablo.patchFiles.clear()
+                    diablo.validateVersion()
+                }
+            }
+        }
     }
 }
@@ -105,13 +105,42 @@ Item {
         visible: (!diablo.patching && !diablo.errored && !diablo.validatingVersion && diablo.validVersion)
 
         Title {
+            id: upToDate
             anchors.left: parent.left
             anchors.verticalCenter: parent.verticalCenter
             anchors.leftMargin: 30
-            text: "Juego actualizado a la fecha"
+            text: (diablo.rogueFiles > 0 ? diablo.rogueFiles + " archivos desconocidos en el juego" : "Juego actualizado a la fecha")
+            color: (diablo.rogueFiles > 0 ? "#8f3131" : "#c7cbd1")
             font.pixelSize: 15
         }
 
+        // Unknown files are listed with the patch actions, where they can be quarantined.
+        Image {
+            fillMode: Image.Pad
+            anchors.verticalCenter: parent.verticalCenter
+            anchors.left: upToDate.right
+            anchors.leftMargin: 10
+            width: 16
+            height: 16
+            visible: diablo.rogueFiles > 0
+            source: "assets/icons/patch.png"
+            opacity: patchFilesHovered ? 1.0 : 0.5
+
+            MouseArea {
+                anchors.fill: parent
+                hoverEnabled: true
+                cursorShape: Qt.PointingHandCursor
+                onClicked: patchPopup.open()
+
+                onEntered: {
+                    patchFilesHovered = true
+                }
+                onExited: {
+                    patchFilesHovered = false
+                }
+            }
+        }
+
         Item {
             width: 300; height: parent.height
             anchors.verticalCenter: parent.verticalCenter
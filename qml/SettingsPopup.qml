@@ -17,7 +17,10 @@ Popup {
         "override_bh_cfg": 264,
         "flags": 272,
         "hd_version": 288,
-        "maphack_version": 320
+        "maphack_version": 320,
+        "protected_files": 384,
+        "hd_resolution": 512,
+        "hd_fullscreen": 768
     }
 
     modal: true
@@ -101,6 +104,7 @@ Popup {
 
                 // Add new game button.
                 Title {
+                    id: addGame
                     visible: (gamesList.count <= 3)
                     text: "+ Agregar instalacion Diablo II"
                     anchors.top: gamesList.bottom
@@ -113,7 +117,7 @@ Popup {
                         anchors.fill: parent
                         cursorShape: Qt.PointingHandCursor
                         onClicked: {
-                            // Add the game to the model, without persisting it to the store.
+                            // Add the game to the store, the model follows.
                             settings.addGame()
 
                             // Set last index as current.
@@ -121,6 +125,40 @@ Popup {
                         }
                     }
                 }
+
+                // Installs found on disk.
+                DiscoveredGames {
+                    id: discoveredGames
+                    visible: (gamesList.count <= 3)
+                    width: parent.width - 60
+                    anchors.top: addGame.bottom
+                    anchors.left: parent.left
+                    anchors.topMargin: 15
+                    anchors.leftMargin: 30
+
+                    onAdded: gamesList.currentIndex = (gamesList.count-1)
+                }
+
+                // New installs from the original installer files.
+                BootstrapGame {
+                    visible: (gamesList.count <= 3)
+                    width: parent.width - 60
+                    anchors.top: discoveredGames.bottom
+                    anchors.left: parent.left
+                    anchors.topMargin: 15
+                    anchors.leftMargin: 30
+
+                    onStarted: settingsPopup.close()
+                }
+
+                // Setups shared between machines.
+                ShareConfig {
+                    width: parent.width - 60
+                    anchors.bottom: parent.bottom
+                    anchors.left: parent.left
+                    anchors.bottomMargin: 30
+                    anchors.leftMargin: 30
+                }
             }
 
              // Right column.
@@ -324,6 +362,25 @@ Popup {
                                 onClicked: settings.addGame()
                             }
                         }
+
+                        // Installs can be found instead of set up by hand.
+                        DiscoveredGames {
+                            width: intro.width
+
+                            onAdded: gamesList.currentIndex = (gamesList.count-1)
+                        }
+
+                        // Or created from the original installer files.
+                        BootstrapGame {
+                            width: intro.width
+
+                            onStarted: settingsPopup.close()
+                        }
+
+                        // Or imported from another machine.
+                        ShareConfig {
+                            width: intro.width
+                        }
                     }
                 }
 
@@ -338,6 +395,8 @@ Popup {
                         anchors.top: parent.top
                         anchors.topMargin: 40
                         anchors.horizontalCenter: parent.horizontalCenter
+
+                        onCloneStarted: settingsPopup.close()
                     }
                 }
 
@@ -382,14 +441,12 @@ Popup {
                         // Reset error.
                         errored = false
                         
+                        // Changes are saved as they're made, only make sure every game is set up.
                         if(validateGames()) {
-                            var success = settings.persistGameModel()
-                            if(success) {
-                                // Validate the game versions after changes has been made to the settings.
-                                diablo.patchFiles.clear()
-                                diablo.validateVersion()
-                                settingsPopup.close()
-                            }
+                            // Validate the game versions after changes has been made to the settings.
+                            diablo.patchFiles.clear()
+                            diablo.validateVersion()
+                            settingsPopup.close()
                         } else {
                             // Show error.
                             errored = true
@@ -399,6 +456,93 @@ Popup {
                         }
                     }
                 }
+
+                // Download rate limit, applied to all downloads while patching.
+                Item {
+                    visible: (gamesList.count > 0)
+                    width: 220
+                    height: 30
+                    anchors.verticalCenter: doneButton.verticalCenter
+                    anchors.left: doneButton.right
+                    anchors.leftMargin: 30
+
+                    Title {
+                        anchors.right: rateLimit.left
+                        anchors.verticalCenter: parent.verticalCenter
+                        anchors.rightMargin: 10
+                        text: "Limite de descarga"
+                        font.pixelSize: 12
+                    }
+
+                    Dropdown {
+                        id: rateLimit
+                        anchors.right: parent.right
+                        anchors.verticalCenter: parent.verticalCenter
+                        height: 30
+                        width: 110
+
+                        // Limits in KB/s, 0 means unlimited.
+                        property var limits: [0, 256, 512, 1024, 2048, 5120]
+
+                        model: ["Sin limite", "256 KB/s", "512 KB/s", "1 MB/s", "2 MB/s", "5 MB/s"]
+
+                        // Sets the correct index when the component has loaded.
+                        Component.onCompleted: {
+                            var index = limits.indexOf(diablo.downloadRateLimit)
+                            this.currentIndex = (index == -1 ? 0 : index)
+                        }
+
+                        onActivated: diablo.updateDownloadRateLimit(limits[index])
+                    }
+                }
+
+                // Deep verify of every game, broken files can then be repaired.
+                PlainButton {
+                    id: verifyButton
+                    visible: (gamesList.count > 0)
+                    label: (diablo.repairNeeded ? "REPARAR" : "VERIFICAR")
+                    width: 100
+                    height: 50
+                    anchors.verticalCenter: doneButton.verticalCenter
+                    anchors.right: parent.right
+                    anchors.rightMargin: 20
+
+                    onClicked: {
+                        if(diablo.verifying) {
+                            return
+                        }
+
+                        if(diablo.repairNeeded) {
+                            // Repairing is shown the same way as patching.
+                            diablo.repairGames()
+                            settingsPopup.close()
+                        } else {
+                            diablo.verifyGames()
+                        }
+                    }
+                }
+
+                SText {
+                    visible: (gamesList.count > 0)
+                    text: (diablo.verifying ? "Verificando archivos..." : diablo.verifySummary)
+                    anchors.right: verifyButton.right
+                    anchors.bottom: verifyButton.top
+                    anchors.bottomMargin: 8
+                    font.pixelSize: 11
+                    color: "#a3a3a3"
+                }
+            }
+        }
+
+        // Games of a shared config being imported, shown over the settings.
+        ImportConfig {
+            anchors.fill: parent
+
+            onImported: {
+                // Validate the game versions of the imported games.
+                diablo.patchFiles.clear()
+                diablo.validateVersion()
+                gamesList.currentIndex = 0
             }
         }
     }
@@ -430,6 +574,8 @@ Popup {
                 "flags": model.data(model.index(gamesList.currentIndex, 0), gameRoles.flags),
                 "hd_version": model.data(model.index(gamesList.currentIndex, 0), gameRoles.hd_version),
                 "maphack_version": model.data(model.index(gamesList.currentIndex, 0), gameRoles.maphack_version),
+                "hd_resolution": model.data(model.index(gamesList.currentIndex, 0), gameRoles.hd_resolution),
+                "hd_fullscreen": model.data(model.index(gamesList.currentIndex, 0), gameRoles.hd_fullscreen),
             })
         }
     }
@@ -0,0 +1,72 @@
+import QtQuick 2.12
+import QtQuick.Dialogs 1.3      // FileDialog
+
+// ShareConfig exports the launcher setup to a file, and imports one made on another machine.
+Column {
+    id: shareConfig
+    spacing: 5
+
+    Row {
+        spacing: 15
+
+        Title {
+            text: "Exportar configuracion"
+            font.bold: true
+
+            MouseArea {
+                anchors.fill: parent
+                cursorShape: Qt.PointingHandCursor
+                onClicked: exportDialog.open()
+            }
+        }
+
+        Title {
+            text: "Importar"
+            font.bold: true
+
+            MouseArea {
+                anchors.fill: parent
+                cursorShape: Qt.PointingHandCursor
+                onClicked: importDialog.open()
+            }
+        }
+    }
+
+    SText {
+        text: settings.shareError
+        visible: (settings.shareError != "")
+        width: parent.width
+        wrapMode: Text.WordWrap
+        font.pixelSize: 10
+        color: "#8f3131"
+    }
+
+    // Export file dialog.
+    FileDialog {
+        id: exportDialog
+        title: "Exportar configuracion"
+        selectExisting: false
+        nameFilters: ["Configuracion (*.json)"]
+        folder: shortcuts.home
+
+        onAccepted: {
+            var path = exportDialog.fileUrl.toString()
+            path = path.replace(/^(file:\/{2})/,"")
+            settings.exportConfig(path)
+        }
+    }
+
+    // Import file dialog, the games are shown before importing them.
+    FileDialog {
+        id: importDialog
+        title: "Importar configuracion"
+        nameFilters: ["Configuracion (*.json)"]
+        folder: shortcuts.home
+
+        onAccepted: {
+            var path = importDialog.fileUrl.toString()
+            path = path.replace(/^(file:\/{2})/,"")
+            settings.readImport(path)
+        }
+    }
+}
@@ -1,15 +1,30 @@
 package storage
 
+import "time"
+
 // DefaultLaunchDelay is used if a launch delay hasn't been set by a user.
 const DefaultLaunchDelay = 1000
 
+// Names of the mods that have their own fields on a game.
+const (
+	ModMaphack = "maphack"
+	ModHD      = "hd"
+)
+
 // Config is the configuration required to run the app.
 type Config struct {
+	// SchemaVersion is the version of the config, older configs are migrated when loaded.
+	SchemaVersion int `json:"schema_version"`
+
 	Games       []Game `json:"games"`
 	LaunchDelay int    `json:"launch_delay"`
+
+	// DownloadRateLimit is the maximum download speed in KB/s, 0 means unlimited.
+	DownloadRateLimit int `json:"download_rate_limit"`
 }
 
-// Game represents a game setup by the user.
+// Game represents a game setup by the user. The user's lines are kept when upstream changes to
+// merged config files, like BH.cfg, conflict with them, OverrideBHCfg doesn't keep upstream next to them.
 type Game struct {
 	ID             string   `json:"id"`
 	Location       string   `json:"location"`
@@ -18,4 +33,56 @@ type Game struct {
 	Flags          []string `json:"flags"`
 	HDVersion      string   `json:"hd_version"`
 	MaphackVersion string   `json:"maphack_version"`
+
+	// Mods are the versions of any other mods, keyed by mod name.
+	Mods map[string]string `json:"mods,omitempty"`
+
+	// ProtectedFiles are paths or globs of files the user has changed and
+	// never wants to be patched, reset or deleted.
+	ProtectedFiles []string `json:"protected_files,omitempty"`
+
+	// Packages are the local mod packages installed in the game.
+	Packages []Package `json:"packages,omitempty"`
+
+	// HDSettings are written to the HD mod settings whenever it's installed.
+	HDSettings *HDSettings `json:"hd_settings,omitempty"`
+}
+
+// HDSettings are the settings of the HD mod chosen by the user.
+type HDSettings struct {
+	// Resolution is the game resolution, such as "1068x600", empty keeps the mod default.
+	Resolution string `json:"resolution"`
+	Fullscreen bool   `json:"fullscreen"`
+}
+
+// ProtectedPatterns returns every file pattern protected in the game.
+func (g *Game) ProtectedPatterns() []string {
+	return append([]string{}, g.ProtectedFiles...)
+}
+
+// Package represents a local mod package installed from an archive.
+type Package struct {
+	Name        string        `json:"name"`
+	Source      string        `json:"source"`
+	InstalledAt time.Time     `json:"installed_at"`
+	Files       []PackageFile `json:"files"`
+}
+
+// PackageFile is a file installed by a package.
+type PackageFile struct {
+	Name string `json:"name"`
+	CRC  string `json:"crc"`
+}
+
+// ModVersion returns the version of the given mod chosen for the game,
+// an empty string means the mod hasn't been chosen.
+func (g *Game) ModVersion(name string) string {
+	switch name {
+	case ModMaphack:
+		return g.MaphackVersion
+	case ModHD:
+		return g.HDVersion
+	default:
+		return g.Mods[name]
+	}
 }
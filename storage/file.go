@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFile will write the file atomically, the contents are written to a temporary file
+// that replaces the file once it's been flushed to disk. A crash while writing leaves
+// either the old or the new file, never a partial one.
+func writeFile(path string, body []byte) error {
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, Permissions)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	syncDir(filepath.Dir(path))
+
+	return nil
+}
+
+// syncDir will flush the directory to disk, so a rename in it survives a crash.
+// Not every OS can sync a directory, Windows can't open one, so it's best effort.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is the version of the config written by this version of the launcher,
+// there's a migration for every version before it.
+const SchemaVersion = 1
+
+// ModVersionNone is the mod version of games that haven't chosen the mod.
+const ModVersionNone = "ninguno"
+
+// ErrConfigNotObject is used when the config isn't a JSON object, such as a config that is null.
+var ErrConfigNotObject = errors.New("la configuracion no es un objeto JSON")
+
+// migration upgrades the config from the version before it. It works on the decoded JSON,
+// so fields that have been renamed or removed from Config can still be read.
+type migration func(raw map[string]interface{}) error
+
+// migrations are in the order they're applied, migrations[i] upgrades version i to i+1.
+var migrations = []migration{
+	migrateModVersionNone,
+}
+
+// migrate will upgrade the config body to the current schema version, step by step.
+// It returns the upgraded body and the version the config was in.
+func migrate(body []byte) ([]byte, int, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, 0, err
+	}
+
+	// A null config decodes without errors, but there's nothing to migrate.
+	if raw == nil {
+		return nil, 0, ErrConfigNotObject
+	}
+
+	// Configs written before the schema was versioned don't have the field.
+	var version int
+	if v, ok := raw["schema_version"].(float64); ok {
+		version = int(v)
+	}
+
+	if version < 0 {
+		return nil, version, fmt.Errorf("la configuracion tiene un esquema invalido: %d", version)
+	}
+
+	if version > SchemaVersion {
+		return nil, version, fmt.Errorf("la configuracion es de una version mas nueva del lanzador (esquema %d, se soporta hasta %d)", version, SchemaVersion)
+	}
+
+	if version == SchemaVersion {
+		return body, version, nil
+	}
+
+	for v := version; v < SchemaVersion; v++ {
+		if err := migrations[v](raw); err != nil {
+			return nil, version, fmt.Errorf("no se pudo migrar la configuracion a la version %d: %s", v+1, err)
+		}
+
+		raw["schema_version"] = v + 1
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, version, err
+	}
+
+	return migrated, version, nil
+}
+
+// migrateModVersionNone replaces the mod version used by the upstream launcher for
+// games without the mod, "none", with our own.
+func migrateModVersionNone(raw map[string]interface{}) error {
+	games, _ := raw["games"].([]interface{})
+
+	for _, g := range games {
+		game, ok := g.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("juego invalido: %v", g)
+		}
+
+		for _, key := range []string{"hd_version", "maphack_version"} {
+			if game[key] == "none" {
+				game[key] = ModVersionNone
+			}
+		}
+
+		mods, _ := game["mods"].(map[string]interface{})
+		for name, version := range mods {
+			if version == "none" {
+				mods[name] = ModVersionNone
+			}
+		}
+	}
+
+	// Old configs could have a null list of games.
+	if games == nil {
+		raw["games"] = make([]interface{}, 0)
+	}
+
+	return nil
+}
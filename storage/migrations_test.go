@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMigrateGolden migrates every testdata/migrations/*.before.json config and
+// compares it with the config expected after migrating, in the .after.json next to it.
+func TestMigrateGolden(t *testing.T) {
+	befores, err := filepath.Glob(filepath.Join("testdata", "migrations", "*.before.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(befores) == 0 {
+		t.Fatal("no migration fixtures found")
+	}
+
+	for _, before := range befores {
+		name := strings.TrimSuffix(filepath.Base(before), ".before.json")
+
+		t.Run(name, func(t *testing.T) {
+			body, err := ioutil.ReadFile(before)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := ioutil.ReadFile(strings.TrimSuffix(before, ".before.json") + ".after.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			migrated, _, err := migrate(body)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			assertSameJSON(t, want, migrated)
+
+			// The migrated config is a valid config in the current schema.
+			var conf Config
+			if err := json.Unmarshal(migrated, &conf); err != nil {
+				t.Fatalf("expected the migrated config to be readable: %s", err)
+			}
+
+			if conf.SchemaVersion != SchemaVersion {
+				t.Fatalf("expected schema version %d, got %d", SchemaVersion, conf.SchemaVersion)
+			}
+
+			if conf.Games == nil {
+				t.Fatal("expected a list of games")
+			}
+		})
+	}
+}
+
+func TestMigrateVersion(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{body: `{"games": []}`, want: 0},
+		{body: `{"schema_version": 0, "games": []}`, want: 0},
+		{body: `{"schema_version": 1, "games": []}`, want: 1},
+	}
+
+	for _, tt := range tests {
+		_, version, err := migrate([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("unexpected error migrating %s: %s", tt.body, err)
+		}
+
+		if version != tt.want {
+			t.Fatalf("expected %s to be version %d, got %d", tt.body, tt.want, version)
+		}
+	}
+}
+
+func TestMigrateInvalid(t *testing.T) {
+	bodies := []string{
+		``,
+		`null`,
+		`[]`,
+		`"config"`,
+		`42`,
+		`{"games": [`,
+		`{"games": ["game"]}`,
+		`{"schema_version": 2, "games": []}`,
+		`{"schema_version": -1, "games": []}`,
+	}
+
+	for _, body := range bodies {
+		t.Run(body, func(t *testing.T) {
+			if _, _, err := migrate([]byte(body)); err == nil {
+				t.Fatalf("expected %q to be rejected", body)
+			}
+		})
+	}
+}
+
+// assertSameJSON fails the test if the JSON documents aren't the same, regardless of formatting.
+func assertSameJSON(t *testing.T, want []byte, got []byte) {
+	t.Helper()
+
+	var w, g interface{}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(w, g) {
+		indented, _ := json.MarshalIndent(g, "", "  ")
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, indented)
+	}
+}
+
+func TestLoadMigrates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	original, err := ioutil.ReadFile(filepath.Join("testdata", "migrations", "v0_none.before.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, configName), original, Permissions); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStore(dir)
+	if err := s.Load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conf, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.SchemaVersion != SchemaVersion || conf.Games[0].HDVersion != ModVersionNone {
+		t.Fatalf("expected the config to be migrated, got %+v", conf)
+	}
+
+	// The original is kept for older launchers.
+	backup, err := ioutil.ReadFile(filepath.Join(dir, configName+".v0.bak"))
+	if err != nil {
+		t.Fatalf("expected a backup of the original config: %s", err)
+	}
+
+	if string(backup) != string(original) {
+		t.Fatal("expected the backup to be the original config")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"sync"
+	"time"
 )
 
 const (
@@ -14,6 +15,9 @@ const (
 
 	// Permissions are the directory permissions for storage.
 	Permissions = 0755
+
+	// backupCount is the number of backups of the config kept, one for each of the last writes.
+	backupCount = 3
 )
 
 // Store represents the data store while hiding implementation behind the interface.
@@ -27,11 +31,14 @@ type store struct {
 	path       string
 	configName string
 	writeMutex sync.Mutex
+
+	// now returns the current time, corrupt configs are named after it.
+	now func() time.Time
 }
 
 // Read will return the current configuration.
 func (s *store) Read() (*Config, error) {
-	body, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", s.path, configName))
+	body, err := ioutil.ReadFile(s.configPath())
 	if err != nil {
 		return nil, err
 	}
@@ -51,23 +58,90 @@ func (s *store) Write(config *Config) error {
 	// Unlock it when we're done writing.
 	defer s.writeMutex.Unlock()
 
+	// Configs are always written in the current schema.
+	config.SchemaVersion = SchemaVersion
+
 	// Marshal the data into json.
 	body, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
 
+	// Keep a copy of the config being written, in case it's lost.
+	if err := s.rotateBackups(body); err != nil {
+		return err
+	}
+
 	// Write to the file, replacing the existing config with the new updated one.
-	return ioutil.WriteFile(
-		fmt.Sprintf("%s/%s", s.path, configName),
-		body,
-		Permissions,
-	)
+	return writeFile(s.configPath(), body)
+}
+
+// rotateBackups will make the config about to be written the newest backup, dropping the oldest one.
+// The newest backup is always the last config saved, so recovering from it doesn't lose anything.
+func (s *store) rotateBackups(body []byte) error {
+	for i := backupCount - 1; i > 0; i-- {
+		if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return writeFile(s.backupPath(1), body)
+}
+
+// recoverFromBackup will replace a config that can't be read with the newest backup that can,
+// the broken config is kept next to it. It returns an error if no backup can be read.
+func (s *store) recoverFromBackup() error {
+	for i := 1; i <= backupCount; i++ {
+		body, err := ioutil.ReadFile(s.backupPath(i))
+		if err != nil || !validConfig(body) {
+			continue
+		}
+
+		if err := os.Rename(s.configPath(), s.corruptPath()); err != nil {
+			return err
+		}
+
+		return writeFile(s.configPath(), body)
+	}
+
+	return fmt.Errorf("la configuracion %s no se puede leer y no hay copias de seguridad validas", s.configPath())
+}
+
+// validConfig returns true if the body can be read as a config, a null config decodes
+// without errors but isn't a config.
+func validConfig(body []byte) bool {
+	var conf *Config
+	return json.Unmarshal(body, &conf) == nil && conf != nil
+}
+
+func (s *store) configPath() string {
+	return fmt.Sprintf("%s/%s", s.path, configName)
+}
+
+// backupPath returns the path of the nth backup, 1 being the newest.
+func (s *store) backupPath(n int) string {
+	return fmt.Sprintf("%s.bak.%d", s.configPath(), n)
+}
+
+// corruptPath returns a path to keep a config that can't be read, every one of them is
+// kept, so they're named after the time they were found and numbered if needed.
+func (s *store) corruptPath() string {
+	base := fmt.Sprintf("%s.corrupt.%s", s.configPath(), s.now().Format("20060102150405"))
+
+	path := base
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); err != nil {
+			return path
+		}
+
+		path = fmt.Sprintf("%s.%d", base, n)
+	}
 }
 
 // Load will create the directory and config file if it doesn't
 // exist, and will load a default config, if the config exists
-// it will be set on the store.
+// it will be migrated to the current schema version. A config that
+// can't be read is recovered from the newest valid backup.
 func (s *store) Load() error {
 	// if the config doesn't exist, create it.
 	configExists, err := s.configExists()
@@ -84,11 +158,54 @@ func (s *store) Load() error {
 		return s.Write(c)
 	}
 
-	return nil
+	body, err := ioutil.ReadFile(s.configPath())
+	if err != nil {
+		return err
+	}
+
+	// The config might have been lost in a crash while writing it with an older launcher.
+	if !validConfig(body) {
+		if err := s.recoverFromBackup(); err != nil {
+			return err
+		}
+	}
+
+	return s.migrate()
+}
+
+// migrate will upgrade the config to the current schema version, keeping a backup of the original.
+func (s *store) migrate() error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	configPath := s.configPath()
+
+	body, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	migrated, version, err := migrate(body)
+	if err != nil {
+		return err
+	}
+
+	// Already up to date.
+	if version == SchemaVersion {
+		return nil
+	}
+
+	// Keep the original, in case the user goes back to an older launcher.
+	backupPath := fmt.Sprintf("%s.v%d.bak", configPath, version)
+	if err := writeFile(backupPath, body); err != nil {
+		return err
+	}
+
+	return writeFile(configPath, migrated)
 }
 
 func (s *store) configExists() (bool, error) {
-	_, err := os.Stat(fmt.Sprintf("%s/%s", s.path, configName))
+	_, err := os.Stat(s.configPath())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -105,5 +222,6 @@ func (s *store) configExists() (bool, error) {
 func NewStore(path string) Store {
 	return &store{
 		path: path,
+		now:  time.Now,
 	}
 }
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store in a new directory, on a clock that doesn't move.
+func newTestStore(t *testing.T) *store {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s := NewStore(dir).(*store)
+	s.now = func() time.Time { return time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+	return s
+}
+
+// writeDelays writes a config for every launch delay, in order.
+func writeDelays(t *testing.T, s *store, delays ...int) {
+	t.Helper()
+
+	for _, delay := range delays {
+		if err := s.Write(&Config{Games: make([]Game, 0), LaunchDelay: delay}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readDelay(t *testing.T, path string) int {
+	t.Helper()
+
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conf Config
+	if err := json.Unmarshal(body, &conf); err != nil {
+		t.Fatalf("expected %s to be a config: %s", path, err)
+	}
+
+	return conf.LaunchDelay
+}
+
+func corruptConfig(t *testing.T, s *store, body string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(s.configPath(), []byte(body), Permissions); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteRotatesBackups(t *testing.T) {
+	s := newTestStore(t)
+	writeDelays(t, s, 1, 2, 3, 4)
+
+	if delay := readDelay(t, s.configPath()); delay != 4 {
+		t.Fatalf("expected the config to have delay 4, got %d", delay)
+	}
+
+	// The newest backup is the last config written.
+	for n, want := range []int{4, 3, 2} {
+		if delay := readDelay(t, s.backupPath(n+1)); delay != want {
+			t.Fatalf("expected backup %d to have delay %d, got %d", n+1, want, delay)
+		}
+	}
+
+	if _, err := os.Stat(s.backupPath(backupCount + 1)); !os.IsNotExist(err) {
+		t.Fatalf("expected only %d backups, got %v", backupCount, err)
+	}
+}
+
+func TestLoadRecoversLastSave(t *testing.T) {
+	bodies := map[string]string{
+		"truncated": `{"games": [`,
+		"empty":     ``,
+		"null":      `null`,
+		"array":     `[]`,
+	}
+
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStore(t)
+			writeDelays(t, s, 1, 2, 3)
+
+			// The config is lost, such as in a crash while writing it with an older launcher.
+			corruptConfig(t, s, body)
+
+			if err := s.Load(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			conf, err := s.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if conf.LaunchDelay != 3 {
+				t.Fatalf("expected the last save to be recovered, got delay %d", conf.LaunchDelay)
+			}
+
+			// The broken config is kept.
+			kept, err := ioutil.ReadFile(s.configPath() + ".corrupt.20200101120000")
+			if err != nil {
+				t.Fatalf("expected the broken config to be kept: %s", err)
+			}
+
+			if string(kept) != body {
+				t.Fatalf("expected the broken config %q to be kept, got %q", body, kept)
+			}
+		})
+	}
+}
+
+func TestLoadSkipsBrokenBackups(t *testing.T) {
+	s := newTestStore(t)
+	writeDelays(t, s, 1, 2, 3)
+
+	corruptConfig(t, s, `{"games": [`)
+	if err := ioutil.WriteFile(s.backupPath(1), []byte(`null`), Permissions); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if delay := readDelay(t, s.configPath()); delay != 2 {
+		t.Fatalf("expected the newest valid backup to be recovered, got delay %d", delay)
+	}
+}
+
+func TestLoadKeepsEveryCorruptConfig(t *testing.T) {
+	s := newTestStore(t)
+	writeDelays(t, s, 1)
+
+	corruptConfig(t, s, `first`)
+	if err := s.Load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	corruptConfig(t, s, `second`)
+	if err := s.Load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Both happened within the same second.
+	want := map[string]string{
+		s.configPath() + ".corrupt.20200101120000":   "first",
+		s.configPath() + ".corrupt.20200101120000.2": "second",
+	}
+
+	for path, body := range want {
+		kept, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("expected %s to be kept: %s", filepath.Base(path), err)
+		}
+
+		if string(kept) != body {
+			t.Fatalf("expected %s to be %q, got %q", filepath.Base(path), body, kept)
+		}
+	}
+}
+
+func TestLoadWithoutValidBackups(t *testing.T) {
+	s := newTestStore(t)
+	corruptConfig(t, s, `{"games": [`)
+
+	if err := s.Load(); err == nil {
+		t.Fatal("expected loading a broken config without backups to fail")
+	}
+
+	// Nothing is touched, the user might be able to fix it.
+	body, err := ioutil.ReadFile(s.configPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != `{"games": [` {
+		t.Fatalf("expected the config to be left alone, got %q", body)
+	}
+}
+
+func TestLoadCreatesConfig(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.Load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conf, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.SchemaVersion != SchemaVersion || conf.Games == nil {
+		t.Fatalf("expected a new config, got %+v", conf)
+	}
+}